@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// adminUser is the user name for HTTP basic authentication of the admin pages.
+const adminUser = "admin"
+
+// handleAdmin wraps handler so that it requires HTTP basic authentication with user
+// adminUser and the admin token as the password.
+// Basic authentication is used, rather than e.g. a bearer token, so that the admin pages,
+// including event streams, work directly in a browser.
+func handleAdmin(token string, handler func(_ http.ResponseWriter, _ *http.Request)) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != adminUser || subtle.ConstantTimeCompare([]byte(password), []byte(token)) != 1 {
+			log.Print("admin authentication failed: ", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Basic realm="godict admin"`)
+			writeError(w, r, http.StatusUnauthorized, "Admin credentials are required.", nil)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// logEvent is a single parsed log line.
+type logEvent struct {
+	// ID identifies the event, see logBroadcaster.
+	ID      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Message string    `json:"message"`
+}
+
+// logBroadcaster is an io.Writer for the standard logger that keeps the most recent log
+// events and passes new ones to subscribers, so that the log can be watched remotely.
+// The IDs of the events count up from the time the broadcaster was created, in
+// nanoseconds, so that they keep growing across restarts.
+type logBroadcaster struct {
+	mu          sync.Mutex
+	recent      []logEvent
+	size        int
+	lastID      int64
+	subscribers map[chan logEvent]bool
+}
+
+// newLogBroadcaster returns a broadcaster keeping the size most recent log events.
+func newLogBroadcaster(size int) *logBroadcaster {
+	return &logBroadcaster{size: size, lastID: time.Now().UnixNano(), subscribers: make(map[chan logEvent]bool)}
+}
+
+// parseLogLine parses a line written by the standard logger with the flags set in main,
+// i.e. "2006/01/02 15:04:05.000000 file.go:123: message".
+func parseLogLine(line string) logEvent {
+	line = strings.TrimSuffix(line, "\n")
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) == 4 {
+		t, err := time.ParseInLocation("2006/01/02 15:04:05.000000", fields[0]+" "+fields[1], time.Local)
+		if err == nil && strings.HasSuffix(fields[2], ":") {
+			return logEvent{Time: t, Source: strings.TrimSuffix(fields[2], ":"), Message: fields[3]}
+		}
+	}
+	return logEvent{Time: time.Now(), Message: line}
+}
+
+// Write implements io.Writer. The standard logger writes each log entry with a single call.
+// It must not log itself.
+func (b *logBroadcaster) Write(p []byte) (int, error) {
+	e := parseLogLine(string(p))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	e.ID = b.lastID
+	if len(b.recent) == b.size {
+		b.recent = b.recent[1:]
+	}
+	b.recent = append(b.recent, e)
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// The subscriber is not keeping up; drop the event rather than block logging.
+		}
+	}
+	return len(p), nil
+}
+
+// subscribe returns the recent log events after the event with the ID after, and a
+// channel receiving new ones. The channel must be released with unsubscribe.
+func (b *logBroadcaster) subscribe(after int64) ([]logEvent, chan logEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan logEvent, 64)
+	b.subscribers[ch] = true
+	var recent []logEvent
+	for _, e := range b.recent {
+		if e.ID > after {
+			recent = append(recent, e)
+		}
+	}
+	return recent, ch
+}
+
+// unsubscribe stops passing log events to ch.
+func (b *logBroadcaster) unsubscribe(ch chan logEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, ch)
+}
+
+// handleAdminLogs handles requests to "/admin/logs".
+// It streams the recent and all new log events as server-sent events, each one as JSON
+// with its ID as the event ID. Clients reconnecting with the Last-Event-ID header only get
+// the events after that one.
+// The optional "source" query argument limits the events to those logged from the given
+// source file (e.g. "proxy.go", which roughly corresponds to a route) and "q" to those
+// whose message contains the given text.
+func handleAdminLogs(logs *logBroadcaster) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		flusher, err := openStream(w)
+		if err != nil {
+			log.Print("failed to stream logs: ", err)
+			writeError(w, req, http.StatusInternalServerError, "Streaming is not supported.", nil)
+			return
+		}
+		source := req.FormValue("source")
+		q := req.FormValue("q")
+		match := func(e logEvent) bool {
+			if source != "" && !strings.HasPrefix(e.Source, source+":") {
+				return false
+			}
+			return strings.Contains(e.Message, q)
+		}
+
+		// Without a valid ID, all recent events are sent.
+		after, _ := strconv.ParseInt(req.Header.Get("Last-Event-ID"), 10, 64)
+		recent, ch := logs.subscribe(after)
+		defer logs.unsubscribe(ch)
+		send := func(e logEvent) {
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.ID, data)
+		}
+		for _, e := range recent {
+			if match(e) {
+				send(e)
+			}
+		}
+		flusher.Flush()
+		for {
+			select {
+			case e := <-ch:
+				if match(e) {
+					send(e)
+					flusher.Flush()
+				}
+			case <-req.Context().Done():
+				return
+			case <-streams:
+				return
+			}
+		}
+	}
+}
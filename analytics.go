@@ -0,0 +1,354 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// analyticsFile is the name of the analytics rollups in the data directory.
+const analyticsFile = "analytics.json"
+
+// analyticsTopWords is the maximum number of words kept in a rollup.
+const analyticsTopWords = 20
+
+// analyticsDay is the rollup of the searches of a day, in UTC.
+type analyticsDay struct {
+	Date     string `json:"date"`
+	Searches int    `json:"searches"`
+	// NotFound counts the searches that found no definitions.
+	NotFound int `json:"not_found"`
+	// Clients counts the distinct clients searching. It may count a client twice if the
+	// server was restarted during the day.
+	Clients   int            `json:"clients"`
+	Languages map[string]int `json:"languages"`
+	// Words are the most searched words found, which were searched by at least
+	// analytics.minClients distinct clients, with the number of searches.
+	Words map[string]int `json:"words"`
+}
+
+// analyticsWord counts the searches of a word during the current day.
+type analyticsWord struct {
+	searches int
+	clients  map[string]bool
+}
+
+// analytics aggregates searches into daily rollups, for instance admins, when enabled by
+// $GODICT_ANALYTICS=1. It keeps no record of single searches: the searches of the current
+// day are counted in memory only, and rolled up when the day ends or the server stops.
+// Client IP addresses are not kept at all; distinct clients are counted by a keyed hash
+// of their address, with a random key that changes every day and is never stored, so
+// that clients cannot be followed from day to day. Of the words searched, only those
+// found and searched by several clients are kept in the rollups, so that rare words do not
+// identify anybody. Requests in privacy mode are not counted. A nil *analytics counts
+// nothing.
+type analytics struct {
+	path string
+	// retention is the number of days rollups are kept for, and minClients the number of
+	// distinct clients a word must be searched by to be kept.
+	retention  int
+	minClients int
+
+	mu   sync.Mutex
+	days []analyticsDay
+	// The searches of the current day.
+	date      string
+	key       []byte
+	searches  int
+	notFound  int
+	clients   map[string]bool
+	languages map[string]int
+	words     map[string]*analyticsWord
+}
+
+// loadAnalytics returns the analytics stored in dataDir, if enabled. The rollups are kept
+// for $GODICT_ANALYTICS_DAYS days, 365 by default, and words searched by
+// $GODICT_ANALYTICS_MIN_CLIENTS distinct clients, 3 by default, are kept in them.
+func loadAnalytics(dataDir string) *analytics {
+	if dataDir == "" || os.Getenv("GODICT_ANALYTICS") != "1" {
+		return nil
+	}
+	a := &analytics{
+		path:       path.Join(dataDir, analyticsFile),
+		retention:  intEnv("GODICT_ANALYTICS_DAYS", 365),
+		minClients: intEnv("GODICT_ANALYTICS_MIN_CLIENTS", 3),
+	}
+	data, err := os.ReadFile(a.path)
+	if err == nil {
+		err = json.Unmarshal(data, &a.days)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Print("failed to read analytics: ", err)
+	}
+	a.reset(time.Now().UTC().Format("2006-01-02"))
+	log.Print("analytics enabled: ", a.path)
+	go func() {
+		// The day is rolled up even if nobody searches after it ends.
+		for range time.Tick(time.Minute) {
+			a.mu.Lock()
+			a.rollover(time.Now())
+			a.mu.Unlock()
+		}
+	}()
+	return a
+}
+
+// reset starts counting the searches of date.
+func (a *analytics) reset(date string) {
+	a.date = date
+	a.key = make([]byte, 32)
+	rand.Read(a.key)
+	a.searches, a.notFound = 0, 0
+	a.clients = make(map[string]bool)
+	a.languages = make(map[string]int)
+	a.words = make(map[string]*analyticsWord)
+}
+
+// rollover rolls up the current day if it ended before now.
+func (a *analytics) rollover(now time.Time) {
+	if date := now.UTC().Format("2006-01-02"); date != a.date {
+		a.rollup()
+		a.reset(date)
+	}
+}
+
+// record counts a search of req for word in language lang, which found definitions if
+// found is set. Searches are recorded through the recorder of req, see recorder.search,
+// which leaves out requests in privacy mode.
+func (a *analytics) record(req *http.Request, word, lang string, found bool) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rollover(time.Now())
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(clientAddr(req)))
+	client := hex.EncodeToString(mac.Sum(nil)[:8])
+	a.searches++
+	a.clients[client] = true
+	a.languages[lang]++
+	if !found {
+		a.notFound++
+		return
+	}
+	key := lang + "/" + normalizeWord(word)
+	w, ok := a.words[key]
+	if !ok {
+		w = &analyticsWord{clients: make(map[string]bool)}
+		a.words[key] = w
+	}
+	w.searches++
+	w.clients[client] = true
+}
+
+// current returns the rollup of the current day so far.
+func (a *analytics) current() analyticsDay {
+	day := analyticsDay{
+		Date:      a.date,
+		Searches:  a.searches,
+		NotFound:  a.notFound,
+		Clients:   len(a.clients),
+		Languages: make(map[string]int, len(a.languages)),
+		Words:     make(map[string]int),
+	}
+	for lang, n := range a.languages {
+		day.Languages[lang] = n
+	}
+	var words []string
+	for key, w := range a.words {
+		if len(w.clients) >= a.minClients {
+			words = append(words, key)
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if a.words[words[i]].searches != a.words[words[j]].searches {
+			return a.words[words[i]].searches > a.words[words[j]].searches
+		}
+		return words[i] < words[j]
+	})
+	if len(words) > analyticsTopWords {
+		words = words[:analyticsTopWords]
+	}
+	for _, key := range words {
+		day.Words[key] = a.words[key].searches
+	}
+	return day
+}
+
+// rollup adds the current day to the rollups and saves them. If the day was already rolled
+// up, e.g. before a restart, the counts are added to it.
+func (a *analytics) rollup() {
+	if a.searches == 0 {
+		return
+	}
+	day := a.current()
+	if n := len(a.days); n > 0 && a.days[n-1].Date == day.Date {
+		a.days[n-1] = mergeDays(a.days[n-1], day)
+	} else {
+		a.days = append(a.days, day)
+	}
+	if len(a.days) > a.retention {
+		a.days = a.days[len(a.days)-a.retention:]
+	}
+	if err := a.save(); err != nil {
+		log.Print("failed to save analytics: ", err)
+	}
+}
+
+// mergeDays returns the sum of the rollups d and e of the same day.
+func mergeDays(d, e analyticsDay) analyticsDay {
+	sum := analyticsDay{
+		Date:      d.Date,
+		Searches:  d.Searches + e.Searches,
+		NotFound:  d.NotFound + e.NotFound,
+		Clients:   d.Clients + e.Clients,
+		Languages: make(map[string]int),
+		Words:     make(map[string]int),
+	}
+	for _, day := range []analyticsDay{d, e} {
+		for lang, n := range day.Languages {
+			sum.Languages[lang] += n
+		}
+		for word, n := range day.Words {
+			sum.Words[word] += n
+		}
+	}
+	return sum
+}
+
+func (a *analytics) save() error {
+	data, err := json.MarshalIndent(a.days, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := a.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.path)
+}
+
+// close rolls up the current day, so that its counts are not lost when the server stops.
+func (a *analytics) close() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rollup()
+	a.reset(a.date)
+}
+
+// report returns the rollups of the last days days, oldest first, including the current
+// day so far.
+func (a *analytics) report(days int) []analyticsDay {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rollover(time.Now())
+	report := append([]analyticsDay(nil), a.days...)
+	today := a.current()
+	if n := len(report); n > 0 && report[n-1].Date == today.Date {
+		// The rollup of an earlier run of the server today is shown along with the
+		// current counts.
+		report[n-1] = mergeDays(report[n-1], today)
+	} else if today.Searches > 0 {
+		report = append(report, today)
+	}
+	if len(report) > days {
+		report = report[len(report)-days:]
+	}
+	return report
+}
+
+// trending returns the n words in language lang most searched in the last days days, the
+// most searched first. Only the words kept in the rollups are counted, see analyticsDay.
+func (a *analytics) trending(lang string, days, n int) []string {
+	if a == nil {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, d := range a.report(days) {
+		for key, c := range d.Words {
+			if word := strings.TrimPrefix(key, lang+"/"); word != key {
+				counts[word] += c
+			}
+		}
+	}
+	words := sortedKeys(counts)
+	if len(words) > n {
+		words = words[:n]
+	}
+	return words
+}
+
+// handleAdminAnalytics handles requests to "/admin/analytics".
+// It returns the daily rollups of the last "days" days, 30 by default, as JSON, or as CSV
+// if the "format" query argument is "csv". The CSV has a row for each count of a day:
+// "date,metric,key,count", where metric is "searches", "not_found", "clients", "language"
+// or "word", and key is the language or word.
+func handleAdminAnalytics(a *analytics) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if a == nil {
+			writeError(w, req, http.StatusNotFound, "Analytics are not enabled.", nil)
+			return
+		}
+		p := requestParams(req)
+		days := p.integer("days", 30, 1, a.retention+1)
+		format := p.oneOf("format", "json", "json", "csv")
+		if !p.check(w) {
+			return
+		}
+		report := a.report(days)
+		if format == "json" {
+			writeJSON(w, http.StatusOK, report)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="godict-analytics.csv"`)
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"date", "metric", "key", "count"})
+		for _, d := range report {
+			cw.Write([]string{d.Date, "searches", "", strconv.Itoa(d.Searches)})
+			cw.Write([]string{d.Date, "not_found", "", strconv.Itoa(d.NotFound)})
+			cw.Write([]string{d.Date, "clients", "", strconv.Itoa(d.Clients)})
+			for _, lang := range sortedKeys(d.Languages) {
+				cw.Write([]string{d.Date, "language", lang, strconv.Itoa(d.Languages[lang])})
+			}
+			for _, word := range sortedKeys(d.Words) {
+				cw.Write([]string{d.Date, "word", word, strconv.Itoa(d.Words[word])})
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			log.Print("failed to write analytics: ", err)
+		}
+	}
+}
+
+// sortedKeys returns the keys of m, the greatest counts first.
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
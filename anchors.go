@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// wordPrefix is the path prefix of the permanent links to words.
+// Requests to wordPrefix + "{word}" show the same page as searching for the word.
+const wordPrefix = "/word/"
+
+// anchorSlug returns s in lower case, with runs of characters other than letters and
+// digits replaced by a single "-", for use in anchors.
+func anchorSlug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "meaning"
+	}
+	return b.String()
+}
+
+// assignIDs sets the IDs of the meanings and definitions in words, which link to them
+// within a result page, e.g. "/word/set#noun-3" for the third definition of set as a
+// noun. IDs only depend on the order of the meanings and definitions in the entries, so
+// they are stable as long as the upstream data does not change.
+//
+// Definitions are numbered per part of speech across all entries. Meanings are
+// identified by their part of speech, with a number appended for repeated parts of
+// speech, e.g. "noun", "noun-meaning-2".
+func assignIDs(words []Word) {
+	meanings := make(map[string]int)
+	definitions := make(map[string]int)
+	for i := range words {
+		for j := range words[i].Meanings {
+			m := &words[i].Meanings[j]
+			pos := anchorSlug(m.PartOfSpeech)
+			meanings[pos]++
+			m.ID = pos
+			if n := meanings[pos]; n > 1 {
+				m.ID = fmt.Sprintf("%s-meaning-%d", pos, n)
+			}
+			for k := range m.Definitions {
+				definitions[pos]++
+				m.Definitions[k].ID = fmt.Sprintf("%s-%d", pos, definitions[pos])
+			}
+		}
+	}
+}
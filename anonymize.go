@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+)
+
+// Anonymizations of client addresses, see withAnonymizedAddr.
+const (
+	// anonymizeTruncate keeps the network of addresses: the first 24 bits of IPv4 and the
+	// first 48 bits of IPv6 addresses.
+	anonymizeTruncate = "truncate"
+	// anonymizeHash replaces addresses by a keyed hash.
+	anonymizeHash = "hash"
+)
+
+// withAnonymizedAddr wraps handler so that the address of the client of each request,
+// req.RemoteAddr, is anonymized as configured by mode, one of the anonymizations above,
+// before anything records it, like the logs, the rate limiter and the analytics; see
+// clientAddr. Addresses are hashed with key, see anonymizationKey. An empty mode keeps
+// the addresses.
+func withAnonymizedAddr(mode string, key []byte, handler http.Handler) http.Handler {
+	if mode == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, port, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host, port = r.RemoteAddr, "0"
+		}
+		r = r.Clone(r.Context())
+		r.RemoteAddr = net.JoinHostPort(anonymizeIP(mode, key, host), port)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// anonymizationKey returns the key client addresses are hashed with, derived from the
+// session key, so that the session cookies and the hashes of addresses, which end up in
+// the logs, are not signed with the same key.
+func anonymizationKey(sessionKey []byte) []byte {
+	mac := hmac.New(sha256.New, sessionKey)
+	mac.Write([]byte("godict client address anonymization"))
+	return mac.Sum(nil)
+}
+
+// anonymizeIP returns the IP address host anonymized as configured by mode. Hosts that
+// are not IP addresses are hashed.
+func anonymizeIP(mode string, key []byte, host string) string {
+	if ip := net.ParseIP(host); ip != nil && mode == anonymizeTruncate {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(host))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
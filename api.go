@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// definePrefix is the path prefix of the definitions API.
+// Requests to definePrefix + "{word}" return the entries of the word as JSON, in the
+// normalized format of Word, including the IDs of meanings and definitions. The language
+// is given by the "lang" query argument, English by default. The "labels" query argument
+// adds the labels of the parts of speech in a language, see labelParts, and the "asof"
+// query argument looks the word up as it was on a date, see withAsOf. Like all API
+// routes, it is also served under each version, e.g. "/api/v1/define/", see handleAPI.
+const definePrefix = "/api/define/"
+
+// writeJSON writes v as a JSON response with the status code status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Print("failed to write JSON response: ", err)
+	}
+}
+
+// handleDefine handles requests to the definitions API.
+// Errors are returned as an APIError, with the status code of the dictionary for its
+// error responses, e.g. 404 if the word is not found, and 502 if it could not be reached.
+// English entries have the spelling variants of their word, see spellingVariants; so do
+// the details of 404 errors, e.g. the correct spelling of a common misspelling.
+func handleDefine(provider Provider) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		word := strings.TrimPrefix(req.URL.Path, definePrefix)
+		logSearch(req.Context(), "handle define: %s", word)
+		if word == "" || strings.Contains(word, "/") {
+			writeError(w, req, http.StatusNotFound, "Usage: "+definePrefix+"{word}", nil)
+			return
+		}
+		ctx := withLanguage(req.Context(), requestLanguage(req))
+		p := requestParams(req)
+		t, ok := p.asOf("asof")
+		labels := p.labelLanguage("labels", false)
+		if !p.check(w) {
+			return
+		}
+		if ok {
+			ctx = withAsOf(ctx, t)
+		}
+		words, err := provider.Lookup(ctx, word)
+		_, asOf := asOfFrom(ctx)
+		rec := recorderFrom(ctx)
+		var providerErr *ProviderError
+		switch {
+		case errors.As(err, &providerErr):
+			if providerErr.Status == http.StatusNotFound && !asOf {
+				rec.noResult(word, provider.Name())
+				rec.search(req, word, languageFrom(ctx), false)
+			}
+			if v, ok := spellingVariants(word); ok && providerErr.Status == http.StatusNotFound && languageFrom(ctx) == defaultLanguage {
+				e := *providerErr
+				e.Response.Variants = &v
+				providerErr = &e
+			}
+			writeProviderError(w, req, providerErr)
+		case err != nil:
+			log.Print(err)
+			writeError(w, req, http.StatusBadGateway, "The dictionary could not be reached.", nil)
+		default:
+			if !asOf {
+				rec.search(req, word, languageFrom(ctx), true)
+			}
+			assignIDs(words)
+			if languageFrom(ctx) == defaultLanguage {
+				for i := range words {
+					if v, ok := spellingVariants(words[i].Word); ok {
+						words[i].Variants = &v
+					}
+				}
+			}
+			if labels != "" {
+				labelParts(words, labels)
+			}
+			writeJSON(w, http.StatusOK, words)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// The codes of API errors, see APIError. They are stable, so that clients can branch on
+// them; new codes may be added.
+//
+//	BAD_REQUEST         400  invalid parameters; the details list them as FieldError
+//	UNAUTHORIZED        401  missing or wrong admin credentials
+//	NOT_FOUND           404  the word, or another resource, does not exist; for words,
+//	                         the details are the response of the dictionary, with the
+//	                         spelling variants of the word
+//	METHOD_NOT_ALLOWED  405  the method is not supported by the route
+//	UNSUPPORTED_VERSION 406  the API version asked for is not supported; the details list
+//	                         the "supported" versions, see handleAPI
+//	TOO_LARGE           413  the request body is larger than the route allows, see
+//	                         routeLimits
+//	UNSUPPORTED_TYPE    415  the media type of the request body is not supported by the
+//	                         route
+//	RATE_LIMITED        429  too many requests; the details give "retry_after" in seconds
+//	INTERNAL            500  the server failed
+//	UPSTREAM_DOWN       502  the dictionary could not be reached or failed to answer
+//	UNAVAILABLE         503  the server is in maintenance mode
+const (
+	codeBadRequest         = "BAD_REQUEST"
+	codeUnauthorized       = "UNAUTHORIZED"
+	codeNotFound           = "NOT_FOUND"
+	codeMethodNotAllowed   = "METHOD_NOT_ALLOWED"
+	codeUnsupportedVersion = "UNSUPPORTED_VERSION"
+	codeTooLarge           = "TOO_LARGE"
+	codeUnsupportedType    = "UNSUPPORTED_TYPE"
+	codeRateLimited        = "RATE_LIMITED"
+	codeInternal           = "INTERNAL"
+	codeUpstreamDown       = "UPSTREAM_DOWN"
+	codeUnavailable        = "UNAVAILABLE"
+)
+
+// requestIDHeader is the header carrying the ID of a request, see withRequestID.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern matches the request IDs accepted from clients and proxies.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// APIError is the response of all API routes to requests that fail.
+type APIError struct {
+	// Code is the machine-readable error code, one of the codes above, and Message a
+	// description for humans, which may change.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Details depend on the code.
+	Details any `json:"details,omitempty"`
+	// RequestID identifies the request, e.g. to find it in the logs; see withRequestID.
+	RequestID string `json:"request_id"`
+}
+
+// isAPIPath reports whether path is an API route, which answers errors with an APIError
+// rather than a page. Those are the routes under "/api/" and "/admin/", and exportPath.
+func isAPIPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/admin/") || path == exportPath
+}
+
+// errorCode returns the code of API errors with the HTTP status code status.
+func errorCode(status int) string {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return codeUnauthorized
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusMethodNotAllowed:
+		return codeMethodNotAllowed
+	case http.StatusNotAcceptable:
+		return codeUnsupportedVersion
+	case http.StatusRequestEntityTooLarge:
+		return codeTooLarge
+	case http.StatusUnsupportedMediaType:
+		return codeUnsupportedType
+	case http.StatusTooManyRequests:
+		return codeRateLimited
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return codeUpstreamDown
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	}
+	if status/100 == 5 {
+		return codeInternal
+	}
+	return codeBadRequest
+}
+
+// writeError writes an APIError with the HTTP status code status, the code for it, see
+// errorCode, message and details, which may be nil.
+func writeError(w http.ResponseWriter, req *http.Request, status int, message string, details any) {
+	writeJSON(w, status, APIError{
+		Code:      errorCode(status),
+		Message:   message,
+		Details:   details,
+		RequestID: requestIDFrom(req.Context()),
+	})
+}
+
+// writeProviderError writes the error of a provider as an APIError. Server errors of the
+// dictionary are answered with 502 Bad Gateway.
+func writeProviderError(w http.ResponseWriter, req *http.Request, err *ProviderError) {
+	status := err.Status
+	if status/100 == 5 {
+		status = http.StatusBadGateway
+	}
+	writeError(w, req, status, err.Response.Message, err.Response)
+}
+
+// handleAPINotFound handles requests to API routes that do not exist.
+func handleAPINotFound(w http.ResponseWriter, req *http.Request) {
+	writeError(w, req, http.StatusNotFound, "No such API route.", nil)
+}
+
+type requestIDKey struct{}
+
+// withRequestID wraps handler so that every request has an ID, which is returned in the
+// requestIDHeader header and in API errors. The ID is taken from the header of the
+// request, if a client or proxy set a valid one, so that requests can be followed across
+// services; otherwise, it is random.
+func withRequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		w.Header().Set(requestIDHeader, id)
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestIDFrom returns the ID of the request with context ctx, see withRequestID.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiVersion is a version of the JSON API. A new version is added when a route changes
+// in a way that breaks clients, e.g. when fields are removed or change their meaning;
+// adding fields or routes does not need one.
+type apiVersion struct {
+	Name string
+	// Deprecated is when the version was deprecated in favor of the next one, and Sunset
+	// when it is going to be removed. They are zero for versions that are not deprecated.
+	Deprecated time.Time
+	Sunset     time.Time
+}
+
+// apiVersions are the supported versions of the JSON API, oldest first. To deprecate a
+// version after adding a new one, set its Deprecated and Sunset times; its responses then
+// carry Deprecation and Sunset headers, see withAPIVersion, and a Link header pointing to
+// the same route in the next version. The version is removed from the list after the
+// sunset.
+var apiVersions = []apiVersion{
+	{Name: "v1"},
+}
+
+const (
+	// apiVersionHeader is the header by which clients ask for a version of the API on
+	// unversioned routes, and which tells the version of every API response.
+	apiVersionHeader = "API-Version"
+	// apiMediaType is the media type by which clients may also ask for a version, in the
+	// Accept header: apiMediaType + "." + version + "+json".
+	apiMediaType = "application/vnd.godict"
+)
+
+type apiVersionKey struct{}
+
+// handleAPI registers handler for the API route pattern, e.g. "/api/define/", in every
+// supported version, e.g. as "/api/v1/define/", and as pattern itself. Requests to pattern
+// are served in the version the client asks for, see negotiateAPIVersion, and in the
+// oldest supported version by default, so that clients that never asked for a version keep
+// working for as long as possible. Handlers see the unversioned path, and the version by
+// apiVersionFrom, if they need to answer differently in different versions.
+func handleAPI(pattern string, handler func(_ http.ResponseWriter, _ *http.Request)) {
+	route := strings.TrimPrefix(pattern, "/api")
+	for i := range apiVersions {
+		v := apiVersions[i]
+		prefix := "/api/" + v.Name
+		http.HandleFunc(prefix+route, withAPIVersion(v, func(w http.ResponseWriter, req *http.Request) {
+			r := *req
+			u := *req.URL
+			u.Path = "/api" + strings.TrimPrefix(u.Path, prefix)
+			r.URL = &u
+			handler(w, &r)
+		}))
+	}
+	http.HandleFunc(pattern, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Vary", apiVersionHeader+", Accept")
+		v, ok := negotiateAPIVersion(req)
+		if !ok {
+			names := make([]string, len(apiVersions))
+			for i, v := range apiVersions {
+				names[i] = v.Name
+			}
+			writeError(w, req, http.StatusNotAcceptable, "Unsupported API version.", map[string][]string{"supported": names})
+			return
+		}
+		withAPIVersion(v, handler)(w, req)
+	})
+}
+
+// withAPIVersion wraps handler so that it serves requests in the API version v. It sets the
+// apiVersionHeader of the response and, if v is deprecated, the Deprecation, Sunset and
+// Link headers of RFC 9745 and RFC 8594.
+func withAPIVersion(v apiVersion, handler func(_ http.ResponseWriter, _ *http.Request)) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		h := w.Header()
+		h.Set(apiVersionHeader, v.Name)
+		if !v.Deprecated.IsZero() {
+			h.Set("Deprecation", "@"+strconv.FormatInt(v.Deprecated.Unix(), 10))
+			if !v.Sunset.IsZero() {
+				h.Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if next, ok := nextAPIVersion(v.Name); ok {
+				path := "/api/" + next.Name + strings.TrimPrefix(unversionedPath(req.URL.Path), "/api")
+				h.Add("Link", "<"+path+`>; rel="successor-version"`)
+			}
+		}
+		handler(w, req.WithContext(context.WithValue(req.Context(), apiVersionKey{}, v.Name)))
+	}
+}
+
+// negotiateAPIVersion returns the API version asked for by req, in the apiVersionHeader,
+// as e.g. "v1" or "1", or in the Accept header as e.g. "application/vnd.godict.v1+json".
+// Without either, the oldest supported version is returned. The second return value is
+// false if the version asked for is not supported.
+func negotiateAPIVersion(req *http.Request) (apiVersion, bool) {
+	name := req.Header.Get(apiVersionHeader)
+	if name == "" {
+		for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+			mediaType, _, _ := strings.Cut(strings.TrimSpace(accept), ";")
+			if strings.HasPrefix(mediaType, apiMediaType+".") {
+				name = strings.TrimSuffix(strings.TrimPrefix(mediaType, apiMediaType+"."), "+json")
+				break
+			}
+		}
+	}
+	if name == "" {
+		return apiVersions[0], true
+	}
+	if !strings.HasPrefix(name, "v") {
+		name = "v" + name
+	}
+	for _, v := range apiVersions {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return apiVersion{}, false
+}
+
+// nextAPIVersion returns the version following the API version name.
+func nextAPIVersion(name string) (apiVersion, bool) {
+	for i, v := range apiVersions[:len(apiVersions)-1] {
+		if v.Name == name {
+			return apiVersions[i+1], true
+		}
+	}
+	return apiVersion{}, false
+}
+
+// unversionedPath returns path, of an API route in any version, without the version.
+func unversionedPath(path string) string {
+	for _, v := range apiVersions {
+		if prefix := "/api/" + v.Name + "/"; strings.HasPrefix(path, prefix) {
+			return "/api/" + strings.TrimPrefix(path, prefix)
+		}
+	}
+	return path
+}
+
+// versionedPath returns path, of an unversioned API route, in the latest API version, for
+// links returned to clients.
+func versionedPath(path string) string {
+	return "/api/" + apiVersions[len(apiVersions)-1].Name + strings.TrimPrefix(path, "/api")
+}
+
+// apiVersionFrom returns the API version a request with context ctx is served in, see
+// handleAPI.
+func apiVersionFrom(ctx context.Context) string {
+	v, _ := ctx.Value(apiVersionKey{}).(string)
+	return v
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// audioPrefix is the path prefix of the pronunciation proxy. Requests to
+// audioPrefix + "{word}/{index}" serve the audio recording of the index-th phonetic of the
+// entries of word, counting from 0 across all entries, in the language of the "lang" query
+// argument.
+const audioPrefix = "/audio/"
+
+const (
+	// audioTTL is how long audio recordings are cached; they hardly ever change.
+	audioTTL = 90 * 24 * time.Hour
+	// maxAudioSize is the maximum size of an audio recording.
+	maxAudioSize = 10 << 20
+)
+
+// audioURL returns the URL of the index-th phonetic of word on the pronunciation proxy.
+func audioURL(word, lang string, index int) string {
+	u := audioPrefix + url.PathEscape(word) + "/" + strconv.Itoa(index)
+	if lang != defaultLanguage {
+		u += "?lang=" + url.QueryEscape(lang)
+	}
+	return u
+}
+
+// proxyAudio replaces the audio URLs of the phonetics in words, the entries of word, with
+// their URLs on the pronunciation proxy, so that the recordings are served locally.
+func proxyAudio(word, lang string, words []Word) {
+	n := 0
+	for i := range words {
+		for j := range words[i].Phonetics {
+			if words[i].Phonetics[j].Audio != "" {
+				words[i].Phonetics[j].Audio = audioURL(word, lang, n)
+			}
+			n++
+		}
+	}
+}
+
+// fetchAudio downloads the audio recording at src and returns it with its content type.
+func fetchAudio(client *http.Client, src string) ([]byte, string, error) {
+	u, err := url.Parse(src)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, "", fmt.Errorf("invalid audio URL: %s", src)
+	}
+	resp, err := client.Get(src)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s answered %s", src, resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if t, _, err := mime.ParseMediaType(contentType); err != nil || (!strings.HasPrefix(t, "audio/") && t != "application/ogg") {
+		// Some hosts serve audio as application/octet-stream; go by the extension then.
+		contentType = mime.TypeByExtension(path.Ext(u.Path))
+		if !strings.HasPrefix(contentType, "audio/") {
+			return nil, "", fmt.Errorf("%s is not audio", src)
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAudioSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxAudioSize {
+		return nil, "", errors.New("audio recording too large: " + src)
+	}
+	return data, contentType, nil
+}
+
+// handleAudio handles requests to the pronunciation proxy. Recordings are cached in the
+// ".audio" subdirectory of cacheDir, in files named by cacheFileName, with the content
+// type in a file of the same name with a ".type" suffix.
+func handleAudio(provider Provider, cacheDir string) func(_ http.ResponseWriter, _ *http.Request) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	return func(w http.ResponseWriter, req *http.Request) {
+		word, index, ok := strings.Cut(strings.TrimPrefix(req.URL.Path, audioPrefix), "/")
+		n, err := strconv.Atoi(index)
+		if !ok || word == "" || err != nil || n < 0 {
+			http.Error(w, "Oops", http.StatusNotFound)
+			return
+		}
+		lang := requestLanguage(req)
+		logSearch(req.Context(), "handle audio: %s/%d (%s)", word, n, lang)
+		var cacheFile string
+		if cacheDir != "" {
+			cacheFile = path.Join(cacheDir, ".audio", cacheFileName(lang+"/"+normalizeWord(word)+"/"+index))
+			data, expires, err := readCacheFile(cacheFile)
+			contentType, _, typeErr := readCacheFile(cacheFile + ".type")
+			if err == nil && typeErr == nil && time.Now().Before(expires) {
+				serveAudio(w, string(contentType), data)
+				return
+			}
+		}
+
+		words, err := provider.Lookup(withLanguage(req.Context(), lang), word)
+		if err != nil {
+			log.Print("failed to look up audio: ", err)
+			http.Error(w, "Oops", http.StatusNotFound)
+			return
+		}
+		var src string
+		i := 0
+		for _, w := range words {
+			for _, p := range w.Phonetics {
+				if i == n {
+					src = p.Audio
+				}
+				i++
+			}
+		}
+		if src == "" {
+			http.Error(w, "Oops", http.StatusNotFound)
+			return
+		}
+		data, contentType, err := fetchAudio(client, src)
+		if err != nil {
+			logSearch(req.Context(), "failed to fetch audio: %s", err)
+			http.Error(w, "Oops", http.StatusBadGateway)
+			return
+		}
+		if cacheFile != "" {
+			expires := time.Now().Add(audioTTL)
+			err := writeCacheFile(cacheFile, data, expires)
+			if err == nil {
+				err = writeCacheFile(cacheFile+".type", []byte(contentType), expires)
+			}
+			if err != nil {
+				log.Print("failed to write audio cache file: ", err)
+			}
+		}
+		serveAudio(w, contentType, data)
+	}
+}
+
+// serveAudio writes the audio recording data with the given content type.
+func serveAudio(w http.ResponseWriter, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(data)
+}
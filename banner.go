@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"path"
+	"runtime/debug"
+	"time"
+)
+
+// startupBanner is the line written on startup with -json-logs, once the server accepts
+// connections. It lets scripts wait for the server and check its configuration without
+// parsing the log.
+type startupBanner struct {
+	Event     string           `json:"event"`
+	Time      time.Time        `json:"time"`
+	Listen    string           `json:"listen"`
+	Cache     bannerCache      `json:"cache"`
+	Providers []bannerProvider `json:"providers"`
+	Version   string           `json:"version"`
+}
+
+type bannerCache struct {
+	// Backend is "sqlite", or "none" if caching is disabled.
+	Backend string `json:"backend"`
+	Path    string `json:"path,omitempty"`
+}
+
+type bannerProvider struct {
+	Name string `json:"name"`
+	// Role is "primary", or "shadow" for the shadow upstream.
+	Role string `json:"role"`
+}
+
+// buildVersion returns the version of the binary, as recorded by the Go toolchain: the
+// module version, or the VCS revision for builds from a checkout.
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && (version == "" || version == "(devel)") {
+			version = s.Value
+		}
+	}
+	if version == "" {
+		version = "unknown"
+	}
+	return version
+}
+
+// writeStartupBanner writes the startup banner of a server listening on listen as a single
+// JSON line to w.
+func writeStartupBanner(w io.Writer, listen, cacheDir string, cache *entryCache, provider Provider, shadow *shadow) error {
+	b := startupBanner{
+		Event:     "ready",
+		Time:      time.Now().UTC(),
+		Listen:    listen,
+		Cache:     bannerCache{Backend: "none"},
+		Providers: []bannerProvider{{Name: provider.Name(), Role: "primary"}},
+		Version:   buildVersion(),
+	}
+	if cache != nil {
+		b.Cache = bannerCache{Backend: "sqlite", Path: path.Join(cacheDir, cacheDBFile)}
+	}
+	if shadow != nil {
+		b.Providers = append(b.Providers, bannerProvider{Name: shadow.upstream.BaseURL, Role: "shadow"})
+	}
+	return json.NewEncoder(w).Encode(b)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// errCircuitOpen is returned for upstream requests that are not sent because the
+// upstream is failing, see breaker.
+var errCircuitOpen = errors.New("upstream is failing; circuit breaker open")
+
+// breaker is a circuit breaker for upstream requests. After threshold consecutive
+// failures it opens: requests fail right away with errCircuitOpen for cooldown, so that
+// lookups are answered from the cache and the offline dictionary instead of waiting for
+// an upstream that is down. Then a single trial request is let through, which closes the
+// breaker if it succeeds and opens it again otherwise. A nil *breaker lets all requests
+// through.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	// trial is set while the trial request is in flight.
+	trial bool
+}
+
+// newBreaker returns a circuit breaker opening after threshold consecutive failures for
+// cooldown. If threshold is 0, nil is returned.
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	if threshold == 0 {
+		return nil
+	}
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a request may be sent. Each request allowed must be followed by
+// a call to record or to skip.
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.trial || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// record records whether a request succeeded, and opens or closes the breaker.
+func (b *breaker) record(ok bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	trial := b.trial
+	b.trial = false
+	if ok {
+		if b.failures >= b.threshold {
+			log.Print("upstream recovered; circuit breaker closed")
+		}
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures == b.threshold || trial {
+		log.Printf("upstream failed %d times in a row; circuit breaker open for %s", b.failures, b.cooldown)
+	}
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// skip records that a request allowed was given up on, e.g. because the client went away,
+// without telling whether the upstream works.
+func (b *breaker) skip() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// jitter returns a random duration between d/2 and 3d/2, so that clients retrying at the
+// same time spread out.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
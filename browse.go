@@ -0,0 +1,133 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// browsePrefix is the path prefix of the browsing pages.
+// Requests to browsePrefix + "{letter}" list the known words starting with the letter.
+const browsePrefix = "/browse/"
+
+// browsePageSize is the number of words listed per page.
+const browsePageSize = 100
+
+// BrowseContext is the data of the browsing pages.
+type BrowseContext struct {
+	// Letters are the initial letters of the known words, in collation order.
+	Letters []string
+	// Letter is the letter browsed, or "" on the index page.
+	Letter string
+	Words  []string
+	// Page is the current page, starting at 1, of Pages.
+	Page  int
+	Pages int
+	// PrevPage and NextPage are the adjacent pages, or 0 if there is none.
+	PrevPage int
+	NextPage int
+}
+
+// browseCollator returns the collator for the language preferred in the Accept-Language
+// header of req, English by default.
+func browseCollator(req *http.Request) *collate.Collator {
+	tag := language.English
+	if tags, _, err := language.ParseAcceptLanguage(req.Header.Get("Accept-Language")); err == nil && len(tags) > 0 {
+		tag = tags[0]
+	}
+	return collate.New(tag)
+}
+
+// initialLetter returns the first letter of word in lower case and without diacritics,
+// so that for example "apple" and "Äpfel" are listed under the same letter.
+func initialLetter(word string) string {
+	r, _ := utf8.DecodeRuneInString(foldWord(word))
+	return string(r)
+}
+
+// handleBrowse handles requests to the browsing pages, which list the headwords of the
+// cache and the offline dictionary, see headwords, alphabetically, sorted by the
+// collation rules of the user's language.
+func handleBrowse(tmpl *template.Template, index *headwords) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		letter := strings.TrimPrefix(req.URL.Path, browsePrefix)
+		log.Print("handle browse: ", letter)
+		if utf8.RuneCountInString(letter) > 1 {
+			http.Error(w, "Oops", http.StatusNotFound)
+			return
+		}
+		c := browseCollator(req)
+		ctx := BrowseContext{Letters: index.letters(), Letter: letter}
+		c.SortStrings(ctx.Letters)
+		if letter != "" {
+			letter = initialLetter(letter)
+			ctx.Letter = letter
+			// Only the words of the letter are collated, the index keeps them together.
+			ctx.Words = index.list(letter, "", -1)
+			c.SortStrings(ctx.Words)
+			ctx.Pages = (len(ctx.Words) + browsePageSize - 1) / browsePageSize
+			ctx.Page = 1
+			if p, err := strconv.Atoi(req.FormValue("page")); err == nil && p > 1 && p <= ctx.Pages {
+				ctx.Page = p
+			}
+			start := (ctx.Page - 1) * browsePageSize
+			end := start + browsePageSize
+			if end > len(ctx.Words) {
+				end = len(ctx.Words)
+			}
+			ctx.Words = ctx.Words[start:end]
+			if ctx.Page > 1 {
+				ctx.PrevPage = ctx.Page - 1
+			}
+			if ctx.Page < ctx.Pages {
+				ctx.NextPage = ctx.Page + 1
+			}
+		}
+		if err := tmpl.Execute(w, ctx); err != nil {
+			log.Print("failed to execute template: ", err)
+			http.Error(w, "Oops", http.StatusInternalServerError)
+		}
+	}
+}
+
+// IndexPage is the response of the index API, see handleIndex. If there are more words,
+// Next is the cursor of the next page.
+type IndexPage struct {
+	Prefix string   `json:"prefix"`
+	Words  []string `json:"words"`
+	More   bool     `json:"more"`
+	Next   string   `json:"next,omitempty"`
+}
+
+// indexMaxLimit is the maximum number of words returned by the index API.
+const indexMaxLimit = 1000
+
+// handleIndex handles requests to the index API, which returns the headwords of the cache
+// and the offline dictionary starting with the "prefix" parameter, in alphabetical order
+// ignoring case and diacritics; see headwords. At most "limit" words are returned, 50 by
+// default; "more" tells whether there are further words, which the next request gets
+// with the "after" parameter set to "next", the last word returned.
+func handleIndex(index *headwords) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		p := requestParams(req)
+		prefix := p.str("prefix", "", maxParamLength)
+		after := p.str("after", "", maxParamLength)
+		limit := p.integer("limit", 50, 1, indexMaxLimit)
+		if !p.check(w) {
+			return
+		}
+		logSearch(req.Context(), "handle index: prefix %q, after %q, limit %d", prefix, after, limit)
+		page := IndexPage{Prefix: prefix, Words: index.list(prefix, after, limit+1)}
+		if len(page.Words) > limit {
+			page.Words = page.Words[:limit]
+			page.More, page.Next = true, page.Words[limit-1]
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// adminJobsPrefix is the path prefix of the jobs, see handleAdminJobs.
+const adminJobsPrefix = "/admin/jobs/"
+
+// handleAdminBulk handles requests to the bulk operations under "/admin/bulk/". Each
+// operation is started by a POST request and runs as a job, which is returned with
+// 202 Accepted; its progress and result are available under adminJobsPrefix.
+//
+//   - "purge" removes the cache entries starting with the "prefix" query argument,
+//     optionally only those in the language of the "lang" query argument.
+//   - "refetch" fetches the cache entries fetched before the "before" query argument, a
+//     date (2006-01-02) or time (RFC 3339), again from the upstream.
+//   - "reindex" rebuilds the indices of the cache database.
+//   - "stats" exports statistics about the cache as the result of the job.
+//   - "prefetch" prefetches the words in the request body, a word list like for the
+//     "prefetch" subcommand sent as text/plain, sending an upstream request at most every
+//     "rate" (1s by default).
+//   - "wordlist" installs the word list at the URL in the "src" query argument under the
+//     name in the "name" query argument, like "wordlist install".
+func handleAdminBulk(jobs *jobTracker, cache *entryCache, upstream *Upstream, provider Provider, dataDir string) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		op := strings.TrimPrefix(req.URL.Path, "/admin/bulk/")
+		var j *job
+		switch op {
+		case "purge":
+			p := requestParams(req)
+			prefix, lang := strings.ToLower(p.required("prefix", maxParamLength)), p.language("lang", "")
+			if !p.check(w) {
+				return
+			}
+			j = jobs.start("purge "+prefix, func(j *job) (any, error) {
+				keys, err := cache.keys(`lower(word) >= ? AND lower(word) < ? AND (? = '' OR lang = ?)`, prefix, prefix+"\xff", lang, lang)
+				if err != nil {
+					return nil, err
+				}
+				for i, k := range keys {
+					if err := cache.remove(k.Word, k.Lang); err != nil {
+						return nil, err
+					}
+					j.progress(i+1, len(keys))
+				}
+				return map[string]int{"removed": len(keys)}, nil
+			})
+		case "refetch":
+			p := requestParams(req)
+			p.required("before", maxParamLength)
+			before, _ := p.timestamp("before")
+			if !p.check(w) {
+				return
+			}
+			j = jobs.start("refetch before "+before.Format(time.RFC3339), func(j *job) (any, error) {
+				keys, err := cache.keys(`fetched_at < ?`, before.Unix())
+				if err != nil {
+					return nil, err
+				}
+				failed := 0
+				for i, k := range keys {
+					if err := upstream.update(context.Background(), cache, k.Word, k.Lang); err != nil {
+						j.logf("failed to refetch %s/%s: %s", k.Lang, k.Word, err)
+						failed++
+					}
+					j.progress(i+1, len(keys))
+				}
+				return map[string]int{"refetched": len(keys) - failed, "failed": failed}, nil
+			})
+		case "reindex":
+			j = jobs.start("reindex", func(j *job) (any, error) {
+				j.progress(0, 1)
+				if err := cache.reindex(); err != nil {
+					return nil, err
+				}
+				j.progress(1, 1)
+				return nil, nil
+			})
+		case "stats":
+			j = jobs.start("stats", func(j *job) (any, error) {
+				return cache.stats(100)
+			})
+		case "prefetch":
+			// The body is the word list, so the form must not be parsed from it.
+			p := queryParams(req)
+			rate := p.duration("rate", time.Second, time.Millisecond, time.Hour)
+			if !p.check(w) {
+				return
+			}
+			// The body is limited by withRouteLimits.
+			words, err := parseWordList(req.Body)
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				writeError(w, req, http.StatusRequestEntityTooLarge, fmt.Sprintf("The word list must be at most %d bytes long.", maxErr.Limit), nil)
+				return
+			}
+			if err != nil || len(words) == 0 {
+				writeError(w, req, http.StatusBadRequest, "The body must be a non-empty word list.", nil)
+				return
+			}
+			j = jobs.start(fmt.Sprintf("prefetch %d words", len(words)), func(j *job) (any, error) {
+				limiter := time.NewTicker(rate)
+				defer limiter.Stop()
+				counts := make(map[string]int)
+				for i, word := range words {
+					status := prefetchWord(word, cache, provider, limiter.C)
+					counts[status]++
+					if status == prefetchFailed {
+						j.logf("failed to prefetch %s", word)
+					}
+					j.progress(i+1, len(words))
+				}
+				return counts, nil
+			})
+		case "wordlist":
+			if dataDir == "" {
+				writeError(w, req, http.StatusNotFound, "Word lists need a data directory.", nil)
+				return
+			}
+			p := requestParams(req)
+			name, src := p.required("name", maxParamLength), p.required("src", 2048)
+			if name != "" && !validWordListName(name) {
+				p.fail("name", "must not start with a dot or contain slashes")
+			}
+			if src != "" && !strings.Contains(src, "://") {
+				p.fail("src", "must be a URL")
+			}
+			if !p.check(w) {
+				return
+			}
+			j = jobs.start("install word list "+name, func(j *job) (any, error) {
+				j.logf("downloading %s", src)
+				n, err := installWordList(dataDir, name, src)
+				if err != nil {
+					return nil, err
+				}
+				j.logf("installed %d words", n)
+				return map[string]int{"words": n}, nil
+			})
+		default:
+			writeError(w, req, http.StatusNotFound, "Unknown bulk operation.", nil)
+			return
+		}
+		writeJobStarted(w, versionedPath(jobsPrefix), j)
+	}
+}
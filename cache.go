@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// The cache stores the upstream responses in the version 2 format in a SQLite database,
+// cacheDBFile in the cache dir, keyed by word and language. Next to the payload, each
+// entry records when it was fetched and when it expires, and how often and when it was
+// last used. The most recently used entries are also held in memory.
+
+// cacheDBFile is the name of the cache database in the cache dir.
+const cacheDBFile = "cache.db"
+
+// errCacheMiss is returned by entryCache.get for words that are not cached.
+var errCacheMiss = errors.New("not cached")
+
+// entryCache is the cache of upstream responses. A nil *entryCache caches nothing.
+type entryCache struct {
+	db  *sql.DB
+	mem *lru
+	// snapshots enables keeping the versions of entries, see addSnapshot.
+	snapshots bool
+	// headwords is the index of the cached words kept up to date, if any; see
+	// newHeadwords.
+	headwords *headwords
+
+	// usage are the uses of entries not yet written to the database, see use.
+	usageMu sync.Mutex
+	usage   map[cacheKey]entryUses
+	stop    chan struct{}
+}
+
+// entryUses are the uses of an entry since they were last written to the database.
+type entryUses struct {
+	hits   int
+	usedAt int64
+}
+
+// cacheUsageInterval is how often the uses of entries are written to the database.
+const cacheUsageInterval = 30 * time.Second
+
+// openCache opens the cache database in cacheDir, creating it if needed. Entries of the
+// earlier cache format, one file per word, are moved into the database. If the cache
+// cannot be opened, the error is logged and nil is returned, which disables caching.
+// The most recently used entries are held in memory, within the share of the memory limit
+// $GODICT_MEMORY_LIMIT for cache entries; see memoryLimitEnv. If $GODICT_SNAPSHOTS is
+// "1", snapshots of the entries are kept.
+func openCache(cacheDir string) *entryCache {
+	if cacheDir == "" {
+		return nil
+	}
+	db, err := sql.Open("sqlite", "file:"+path.Join(cacheDir, cacheDBFile)+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		log.Print("failed to open cache: ", err)
+		return nil
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS entries (
+			word TEXT NOT NULL,
+			lang TEXT NOT NULL,
+			payload BLOB NOT NULL,
+			fetched_at INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL,
+			PRIMARY KEY (word, lang)
+		);
+		CREATE INDEX IF NOT EXISTS entries_prefix ON entries (lang, lower(word));`)
+	if err == nil {
+		err = addUsageColumns(db)
+	}
+	if err == nil {
+		err = createSnapshots(db)
+	}
+	if err != nil {
+		log.Print("failed to create cache: ", err)
+		db.Close()
+		return nil
+	}
+	c := &entryCache{
+		db:        db,
+		mem:       newLRU(cacheMemory(memoryLimitEnv())),
+		snapshots: os.Getenv("GODICT_SNAPSHOTS") == "1",
+		usage:     make(map[cacheKey]entryUses),
+		stop:      make(chan struct{}),
+	}
+	go c.writeUsagePeriodically()
+	if n, err := c.migrateFiles(cacheDir); err != nil {
+		log.Print("failed to migrate cache files: ", err)
+	} else if n > 0 {
+		log.Printf("moved %d cache files into the cache database", n)
+	}
+	return c
+}
+
+// addUsageColumns adds the columns recording the use of entries to caches created
+// before they existed.
+func addUsageColumns(db *sql.DB) error {
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM pragma_table_info('entries') WHERE name = 'hits'`).Scan(&n); err != nil || n > 0 {
+		return err
+	}
+	_, err := db.Exec(`
+		ALTER TABLE entries ADD COLUMN hits INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE entries ADD COLUMN used_at INTEGER NOT NULL DEFAULT 0;`)
+	return err
+}
+
+// setMemoryLimit limits the memory used by entries held in memory to maxBytes.
+func (c *entryCache) setMemoryLimit(maxBytes int64) {
+	if c != nil {
+		c.mem.resize(maxBytes)
+	}
+}
+
+// close writes the uses of entries and closes the cache database.
+func (c *entryCache) close() error {
+	if c == nil {
+		return nil
+	}
+	close(c.stop)
+	if err := c.writeUsage(); err != nil {
+		log.Print("failed to record cache use: ", err)
+	}
+	return c.db.Close()
+}
+
+// backupCache writes a consistent snapshot of the cache database in cacheDir to the file
+// name, which must not exist or be empty, while it may be in use.
+func backupCache(cacheDir, name string) error {
+	db, err := sql.Open("sqlite", "file:"+path.Join(cacheDir, cacheDBFile)+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec(`VACUUM INTO ?`, name)
+	return err
+}
+
+// memKey returns the key of the entry of word in language lang in memory.
+func memKey(word, lang string) string {
+	return lang + "/" + word
+}
+
+// get returns the cached entry of word in language lang and its expiry time, and
+// records its use with the recorder of ctx, see recorder.use. It returns errCacheMiss if there is none.
+func (c *entryCache) get(ctx context.Context, word, lang string) ([]byte, time.Time, error) {
+	if c == nil {
+		return nil, time.Time{}, errCacheMiss
+	}
+	if e, ok := c.mem.get(memKey(word, lang)); ok {
+		recorderFrom(ctx).use(c, word, lang)
+		return e.data, e.expires, nil
+	}
+	var data []byte
+	var expires int64
+	err := c.db.QueryRow(`SELECT payload, expires_at FROM entries WHERE word = ? AND lang = ?`, word, lang).Scan(&data, &expires)
+	if err == sql.ErrNoRows {
+		return nil, time.Time{}, errCacheMiss
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	recorderFrom(ctx).use(c, word, lang)
+	c.mem.add(memKey(word, lang), data, time.Unix(expires, 0))
+	return data, time.Unix(expires, 0), nil
+}
+
+// use records a use of the entry of word in language lang. Uses are written to the
+// database every cacheUsageInterval, see writeUsage, rather than with every lookup.
+func (c *entryCache) use(word, lang string) {
+	c.usageMu.Lock()
+	defer c.usageMu.Unlock()
+	k := cacheKey{Word: word, Lang: lang}
+	u := c.usage[k]
+	u.hits++
+	u.usedAt = time.Now().Unix()
+	c.usage[k] = u
+}
+
+// writeUsage writes the recorded uses of entries to the database, in one transaction.
+func (c *entryCache) writeUsage() error {
+	c.usageMu.Lock()
+	usage := c.usage
+	c.usage = make(map[cacheKey]entryUses)
+	c.usageMu.Unlock()
+	if len(usage) == 0 {
+		return nil
+	}
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for k, u := range usage {
+		_, err := tx.Exec(`UPDATE entries SET hits = hits + ?, used_at = max(used_at, ?) WHERE word = ? AND lang = ?`, u.hits, u.usedAt, k.Word, k.Lang)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// writeUsagePeriodically calls writeUsage every cacheUsageInterval until the cache is
+// closed.
+func (c *entryCache) writeUsagePeriodically() {
+	ticker := time.NewTicker(cacheUsageInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.writeUsage(); err != nil {
+				log.Print("failed to record cache use: ", err)
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// payload returns the cached entry of word in language lang, without recording its use.
+// It returns errCacheMiss if there is none.
+func (c *entryCache) payload(word, lang string) ([]byte, error) {
+	if c == nil {
+		return nil, errCacheMiss
+	}
+	var data []byte
+	err := c.db.QueryRow(`SELECT payload FROM entries WHERE word = ? AND lang = ?`, word, lang).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, errCacheMiss
+	}
+	return data, err
+}
+
+// put stores data as the entry of word in language lang, expiring at expires.
+func (c *entryCache) put(word, lang string, data []byte, expires time.Time) error {
+	if c == nil {
+		return nil
+	}
+	if c.snapshots {
+		if err := c.addSnapshot(word, lang, data); err != nil {
+			log.Printf("failed to record snapshot of %s/%s: %s", lang, word, err)
+		}
+	}
+	_, err := c.db.Exec(`
+		INSERT INTO entries (word, lang, payload, fetched_at, expires_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (word, lang) DO UPDATE SET payload = excluded.payload, fetched_at = excluded.fetched_at, expires_at = excluded.expires_at`,
+		word, lang, data, time.Now().Unix(), expires.Unix())
+	if err == nil {
+		c.mem.add(memKey(word, lang), data, expires)
+		c.headwords.add(word, lang)
+	}
+	return err
+}
+
+// warm loads up to n entries into memory, half of them the most recently used and the
+// other half the most frequently used, so that the first lookups after a restart are
+// answered from memory. It returns the number of entries loaded.
+func (c *entryCache) warm(n int) (int, error) {
+	if c == nil || n <= 0 {
+		return 0, nil
+	}
+	// The least recently used entries are added first, so that the most recently used
+	// ones are kept if the memory cache is smaller than n.
+	rows, err := c.db.Query(`
+		SELECT word, lang, payload, expires_at FROM (
+			SELECT * FROM (SELECT * FROM entries WHERE hits > 0 ORDER BY hits DESC LIMIT ?)
+			UNION
+			SELECT * FROM (SELECT * FROM entries WHERE used_at > 0 ORDER BY used_at DESC LIMIT ?)
+		) ORDER BY used_at`, n-n/2, n/2)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	loaded := 0
+	for rows.Next() {
+		var word, lang string
+		var data []byte
+		var expires int64
+		if err := rows.Scan(&word, &lang, &data, &expires); err != nil {
+			return loaded, err
+		}
+		c.mem.add(memKey(word, lang), data, time.Unix(expires, 0))
+		loaded++
+	}
+	return loaded, rows.Err()
+}
+
+// words returns the cached words in language lang starting with prefix, ignoring case.
+func (c *entryCache) words(lang, prefix string) ([]string, error) {
+	if c == nil {
+		return nil, nil
+	}
+	prefix = strings.ToLower(prefix)
+	// No UTF-8 string contains the byte 0xff, so it bounds all strings with the prefix.
+	rows, err := c.db.Query(`SELECT word FROM entries WHERE lang = ? AND lower(word) >= ? AND lower(word) < ?`,
+		lang, prefix, prefix+"\xff")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var words []string
+	for rows.Next() {
+		var w string
+		if err := rows.Scan(&w); err != nil {
+			return nil, err
+		}
+		words = append(words, w)
+	}
+	return words, rows.Err()
+}
+
+// cacheKey identifies a cache entry.
+type cacheKey struct {
+	Word string
+	Lang string
+}
+
+// keys returns the keys of the entries selected by the SQL condition where, which may
+// refer to the columns of the entries table, with the arguments args.
+func (c *entryCache) keys(where string, args ...any) ([]cacheKey, error) {
+	if c == nil {
+		return nil, nil
+	}
+	rows, err := c.db.Query(`SELECT word, lang FROM entries WHERE `+where+` ORDER BY lang, word`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []cacheKey
+	for rows.Next() {
+		var k cacheKey
+		if err := rows.Scan(&k.Word, &k.Lang); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// remove removes the entry of word in language lang.
+func (c *entryCache) remove(word, lang string) error {
+	if c == nil {
+		return nil
+	}
+	c.mem.remove(memKey(word, lang))
+	_, err := c.db.Exec(`DELETE FROM entries WHERE word = ? AND lang = ?`, word, lang)
+	if err == nil {
+		c.headwords.remove(word, lang)
+	}
+	return err
+}
+
+// reindex rebuilds the indices of the cache database and its statistics for the query
+// planner, and frees unused space.
+func (c *entryCache) reindex() error {
+	if c == nil {
+		return nil
+	}
+	_, err := c.db.Exec(`REINDEX; ANALYZE; VACUUM;`)
+	return err
+}
+
+// cacheStats are statistics about the cache.
+type cacheStats struct {
+	Entries   int            `json:"entries"`
+	Expired   int            `json:"expired"`
+	Languages map[string]int `json:"languages"`
+	Hits      int            `json:"hits"`
+	// Top are the most frequently used entries.
+	Top    []cacheUsage `json:"top"`
+	Memory int          `json:"memory"`
+}
+
+type cacheUsage struct {
+	Word     string    `json:"word"`
+	Lang     string    `json:"lang"`
+	Hits     int       `json:"hits"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// stats returns statistics about the cache, with the top most frequently used entries.
+func (c *entryCache) stats(top int) (*cacheStats, error) {
+	s := &cacheStats{Languages: make(map[string]int), Top: []cacheUsage{}}
+	if c == nil {
+		return s, nil
+	}
+	err := c.db.QueryRow(`SELECT count(*), coalesce(sum(expires_at < ?), 0), coalesce(sum(hits), 0) FROM entries`, time.Now().Unix()).
+		Scan(&s.Entries, &s.Expired, &s.Hits)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.db.Query(`SELECT lang, count(*) FROM entries GROUP BY lang`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var lang string
+		var n int
+		if err := rows.Scan(&lang, &n); err != nil {
+			return nil, err
+		}
+		s.Languages[lang] = n
+	}
+	rows, err = c.db.Query(`SELECT word, lang, hits, used_at FROM entries WHERE hits > 0 ORDER BY hits DESC LIMIT ?`, top)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u cacheUsage
+		var used int64
+		if err := rows.Scan(&u.Word, &u.Lang, &u.Hits, &used); err != nil {
+			return nil, err
+		}
+		u.LastUsed = time.Unix(used, 0)
+		s.Top = append(s.Top, u)
+	}
+	s.Memory = c.mem.len()
+	return s, rows.Err()
+}
+
+// migrateFiles moves the entries of the earlier cache format from cacheDir into the
+// database and returns their number. English entries were stored directly in cacheDir,
+// entries in other languages in ".lang/{lang}", with their expiry time as the
+// modification time of the file.
+func (c *entryCache) migrateFiles(cacheDir string) (int, error) {
+	dirs := map[string]string{defaultLanguage: cacheDir}
+	for _, l := range languages {
+		if l.Code != defaultLanguage {
+			dirs[l.Code] = path.Join(cacheDir, ".lang", l.Code)
+		}
+	}
+	n := 0
+	for lang, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if !e.Type().IsRegular() || strings.HasPrefix(name, ".") || strings.HasPrefix(name, cacheDBFile) {
+				continue
+			}
+			file := path.Join(dir, name)
+			data, expires, err := readCacheFile(file)
+			if err != nil {
+				return n, err
+			}
+			if err := c.put(name, lang, data, expires); err != nil {
+				return n, err
+			}
+			if err := os.Remove(file); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if lang != defaultLanguage {
+			os.Remove(dir)
+		}
+	}
+	os.Remove(path.Join(cacheDir, ".lang"))
+	return n, nil
+}
+
+// warmCache loads up to n entries of cache into memory and logs the result.
+func warmCache(cache *entryCache, n int) {
+	loaded, err := cache.warm(n)
+	if err != nil {
+		log.Print("failed to warm cache: ", err)
+	} else if loaded > 0 {
+		log.Printf("loaded %d cache entries into memory", loaded)
+	}
+}
+
+// readCacheFile returns the data in the cache file name and its expiry time, which is
+// stored as the modification time of the file. Caches other than the entry cache, like
+// the ngram cache, use one such file per item.
+func readCacheFile(name string) ([]byte, time.Time, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(name)
+	return data, info.ModTime(), err
+}
+
+// writeCacheFile stores data in the cache file name, expiring at expires.
+// See readCacheFile.
+func writeCacheFile(name string, data []byte, expires time.Time) error {
+	if err := os.MkdirAll(path.Dir(name), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		return err
+	}
+	return os.Chtimes(name, time.Now(), expires)
+}
+
+// cacheTTL returns how long a response with header h may be cached, as indicated by the
+// Cache-Control or Expires headers, bounded by minTTL and maxTTL. Responses without
+// caching headers are cached for maxTTL.
+func cacheTTL(h http.Header, minTTL, maxTTL time.Duration) time.Duration {
+	ttl, ok := headerTTL(h)
+	if !ok || ttl > maxTTL {
+		return maxTTL
+	}
+	if ttl < minTTL {
+		return minTTL
+	}
+	return ttl
+}
+
+// headerTTL returns the freshness lifetime of a response with header h, as defined by
+// RFC 9111, section 4.2.1. The second return value is false if h does not define it.
+func headerTTL(h http.Header) (time.Duration, bool) {
+	var age time.Duration
+	if n, err := strconv.Atoi(h.Get("Age")); err == nil && n > 0 {
+		age = time.Duration(n) * time.Second
+	}
+	maxAge, sMaxAge := -1, -1
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return 0, true
+		case "max-age":
+			maxAge, _ = strconv.Atoi(strings.Trim(value, `"`))
+		case "s-maxage":
+			sMaxAge, _ = strconv.Atoi(strings.Trim(value, `"`))
+		}
+	}
+	// As a shared cache, s-maxage takes precedence.
+	if sMaxAge >= 0 {
+		return time.Duration(sMaxAge)*time.Second - age, true
+	}
+	if maxAge >= 0 {
+		return time.Duration(maxAge)*time.Second - age, true
+	}
+	expires := h.Get("Expires")
+	if expires == "" {
+		return 0, false
+	}
+	t, err := http.ParseTime(expires)
+	if err != nil {
+		// Invalid dates, like "0", mean already expired.
+		return 0, true
+	}
+	date, err := http.ParseTime(h.Get("Date"))
+	if err != nil {
+		date = time.Now()
+	}
+	return t.Sub(date), true
+}
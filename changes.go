@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// changesFile is the name of the log of entry changes in the data directory.
+const changesFile = "changes.jsonl"
+
+// entryChange is a change of the definitions of a word, detected when its cache entry
+// was refreshed.
+type entryChange struct {
+	Word string    `json:"word"`
+	Lang string    `json:"lang"`
+	Time time.Time `json:"time"`
+	// Differences describe the differences, see diffWords.
+	Differences []string `json:"differences"`
+	// Added and Removed are the definitions added and removed, as "part of speech:
+	// definition".
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// changeLog records changes of the definitions of words to a JSON lines file, and notifies
+// the watchers of starred words about them by a POST request with the change as JSON to a
+// webhook, $GODICT_CHANGE_WEBHOOK, if set. The watchers on the watchlists are notified
+// about changes and about pronunciations becoming available. A nil *changeLog records
+// nothing.
+type changeLog struct {
+	mu         sync.Mutex
+	path       string
+	favorites  *favorites
+	watchlists *watchlists
+	webhook    string
+	client     *http.Client
+}
+
+// newChangeLog returns a change log stored in dataDir, notifying about changes of the
+// words in favorites and in watchlists. If dataDir is empty, nil is returned and nothing
+// is recorded.
+func newChangeLog(dataDir string, favorites *favorites, watchlists *watchlists) *changeLog {
+	if dataDir == "" {
+		return nil
+	}
+	return &changeLog{
+		path:       path.Join(dataDir, changesFile),
+		favorites:  favorites,
+		watchlists: watchlists,
+		webhook:    os.Getenv("GODICT_CHANGE_WEBHOOK"),
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// definitionDiff returns the definitions in b but not in a, as "part of speech:
+// definition", sorted.
+func definitionDiff(a, b []Word) []string {
+	have := definitionSet(a)
+	var diff []string
+	for pos, defs := range definitionSet(b) {
+		for d := range defs {
+			if !have[pos][d] {
+				diff = append(diff, pos+": "+d)
+			}
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// record records the change of the entry of word in language lang from the cached payload
+// before to after, if the definitions differ.
+func (l *changeLog) record(word, lang string, before, after []byte) {
+	if l == nil || bytes.Equal(before, after) {
+		return
+	}
+	var a, b []Word
+	if json.Unmarshal(before, &a) != nil || json.Unmarshal(after, &b) != nil {
+		return
+	}
+	if !hasAudio(a) && hasAudio(b) {
+		l.watchlists.audioAvailable(word, lang)
+	}
+	c := entryChange{Word: word, Lang: lang, Time: time.Now().UTC(), Differences: diffWords(a, b),
+		Added: definitionDiff(a, b), Removed: definitionDiff(b, a)}
+	if len(c.Differences) == 0 && len(c.Added) == 0 && len(c.Removed) == 0 {
+		return
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		log.Print("failed to encode entry change: ", err)
+		return
+	}
+	log.Printf("definitions of %s/%s changed: %d differences", lang, word, len(c.Differences))
+	l.mu.Lock()
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err == nil {
+		_, err = f.Write(append(data, '\n'))
+		f.Close()
+	}
+	l.mu.Unlock()
+	if err != nil {
+		log.Print("failed to write change log: ", err)
+	}
+	if l.webhook != "" && l.favorites.has(word, lang) {
+		go l.notify(data)
+	}
+	l.watchlists.definitionsChanged(c)
+}
+
+// hasAudio reports whether any of the entries words has a pronunciation recording.
+func hasAudio(words []Word) bool {
+	for _, w := range words {
+		for _, p := range w.Phonetics {
+			if p.Audio != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// notify posts the change data to the webhook.
+func (l *changeLog) notify(data []byte) {
+	resp, err := l.client.Post(l.webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Print("failed to notify about entry change: ", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("failed to notify about entry change: webhook answered %s", resp.Status)
+	}
+}
+
+// recent returns up to n of the most recent changes, most recent first.
+func (l *changeLog) recent(n int) ([]entryChange, error) {
+	changes := []entryChange{}
+	if l == nil {
+		return changes, nil
+	}
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return changes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var c entryChange
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			continue
+		}
+		changes = append(changes, c)
+		if len(changes) > n {
+			changes = changes[1:]
+		}
+	}
+	for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+		changes[i], changes[j] = changes[j], changes[i]
+	}
+	return changes, scanner.Err()
+}
+
+// handleAdminChanges handles requests to "/admin/changes", which lists the most recent
+// changes of definitions as JSON, up to the "n" query argument, 100 by default.
+func handleAdminChanges(l *changeLog) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		p := requestParams(req)
+		n := p.integer("n", 100, 1, math.MaxInt)
+		if !p.check(w) {
+			return
+		}
+		changes, err := l.recent(n)
+		if err != nil {
+			log.Print("failed to read change log: ", err)
+			writeError(w, req, http.StatusInternalServerError, "Failed to read the change log.", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, changes)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errChaos is the error injected in place of upstream connection errors.
+var errChaos = errors.New("injected failure")
+
+// chaos injects faults into upstream requests, so that failure handling like serving
+// stale cache entries can be exercised in staging. It is meant for debugging only; a nil
+// *chaos injects nothing.
+type chaos struct {
+	// Each fault is injected into the given fraction of requests, between 0 and 1.
+	latencyRate   float64
+	latency       time.Duration
+	errorRate     float64
+	statusRate    float64
+	malformedRate float64
+}
+
+// parseChaos parses a chaos specification, a comma-separated list of faults with the
+// fraction of requests to inject them into:
+//
+//	latency=0.1:2s     delays 10% of requests by 2s
+//	error=0.05         fails 5% of requests as if the upstream could not be reached
+//	status=0.05        answers 5% of requests with 503 Service Unavailable
+//	malformed=0.05     truncates 5% of successful response bodies
+func parseChaos(spec string) (*chaos, error) {
+	c := &chaos{}
+	for _, fault := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(fault), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid fault: %q", fault)
+		}
+		var err error
+		rate := &c.errorRate
+		switch name {
+		case "latency":
+			var d string
+			value, d, ok = strings.Cut(value, ":")
+			if !ok {
+				return nil, fmt.Errorf("missing latency duration: %q", fault)
+			}
+			if c.latency, err = time.ParseDuration(d); err != nil {
+				return nil, err
+			}
+			rate = &c.latencyRate
+		case "error":
+		case "status":
+			rate = &c.statusRate
+		case "malformed":
+			rate = &c.malformedRate
+		default:
+			return nil, fmt.Errorf("unknown fault: %q", name)
+		}
+		if *rate, err = strconv.ParseFloat(value, 64); err != nil || *rate < 0 || *rate > 1 {
+			return nil, fmt.Errorf("invalid rate: %q", fault)
+		}
+	}
+	return c, nil
+}
+
+// before is called before a request is sent. It delays the request, or returns a status
+// code and body, or an error, to answer it with instead of sending it. The delay ends
+// early when ctx is canceled, and its error is returned.
+func (c *chaos) before(ctx context.Context) (int, []byte, error) {
+	if c == nil {
+		return 0, nil, nil
+	}
+	if rand.Float64() < c.latencyRate {
+		log.Print("chaos: delaying request by ", c.latency)
+		select {
+		case <-time.After(c.latency):
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		}
+	}
+	if rand.Float64() < c.errorRate {
+		log.Print("chaos: failing request")
+		return 0, nil, errChaos
+	}
+	if rand.Float64() < c.statusRate {
+		log.Print("chaos: answering request with 503")
+		return http.StatusServiceUnavailable, []byte(`{"title":"Service Unavailable","message":"Injected failure."}`), nil
+	}
+	return 0, nil, nil
+}
+
+// after is called with the body of a successful response and returns the body to use.
+func (c *chaos) after(body []byte) []byte {
+	if c == nil || rand.Float64() >= c.malformedRate {
+		return body
+	}
+	log.Print("chaos: truncating response body")
+	return body[:len(body)/2]
+}
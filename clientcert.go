@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader provides a TLS client certificate loaded from a certificate and a key file.
+// The files are loaded again whenever the certificate file changes, so that rotated
+// certificates are picked up by new connections without restarting the server.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	modTime time.Time
+	cert    *tls.Certificate
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+// If reloading a changed certificate fails, e.g. because the key file has not been
+// replaced yet, the previous certificate is used and the reload is retried on the next
+// handshake.
+func (c *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	info, err := os.Stat(c.certFile)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil && c.cert != nil && info.ModTime().Equal(c.modTime) {
+		return c.cert, nil
+	}
+	if err == nil {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err == nil {
+			log.Print("loaded client certificate: ", c.certFile)
+			c.cert = &cert
+			c.modTime = info.ModTime()
+			return c.cert, nil
+		}
+	}
+	if c.cert == nil {
+		return nil, err
+	}
+	log.Print("failed to reload client certificate: ", err)
+	return c.cert, nil
+}
+
+// newHTTPClient returns the HTTP client used to talk to the upstream.
+// If certFile and keyFile are set, the client authenticates with that certificate (mTLS).
+// If caFile is set, the upstream certificate is verified against the CA certificates in
+// that file instead of the system pool.
+func newHTTPClient(certFile, keyFile, caFile string) (*http.Client, error) {
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return &http.Client{}, nil
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("both client certificate and key must be set")
+	}
+	config := &tls.Config{}
+	if certFile != "" {
+		reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+		// Fail early on a broken certificate rather than on the first lookup.
+		if _, err := reloader.GetClientCertificate(nil); err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = reloader.GetClientCertificate
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no CA certificates found in " + caFile)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// clipboardCommand returns the command printing the contents of the system clipboard:
+// pbpaste on macOS, wl-paste on Wayland and xclip on X11.
+func clipboardCommand() ([]string, error) {
+	switch {
+	case runtime.GOOS == "darwin":
+		return []string{"pbpaste"}, nil
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		return []string{"wl-paste", "--no-newline"}, nil
+	case os.Getenv("DISPLAY") != "":
+		return []string{"xclip", "-out", "-selection", "clipboard"}, nil
+	}
+	return nil, errors.New("no supported clipboard found; needs macOS, Wayland or X11")
+}
+
+// isSingleWord reports whether s looks like a single word worth looking up, as opposed to
+// a sentence, a URL or a password.
+func isSingleWord(s string) bool {
+	if s == "" || len(s) > 45 {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && r != '-' && r != '\'' {
+			return false
+		}
+	}
+	return true
+}
+
+// watchClipboard implements the "watch-clipboard" subcommand.
+// It polls the system clipboard and prints the definition of every single word copied.
+// Words are looked up like by the server, using the same cache.
+func watchClipboard(config AppConfig, args []string) {
+	fs := flag.NewFlagSet("watch-clipboard", flag.ExitOnError)
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often to check the clipboard")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s watch-clipboard [flags]\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	if len(parseFlags(fs, args)) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	command, err := clipboardCommand()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if _, err := exec.LookPath(command[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s not found; install it to watch the clipboard\n", command[0])
+		os.Exit(1)
+	}
+	provider := config.lookupProvider(openCache(config.initCacheDir()))
+
+	fmt.Fprintf(os.Stderr, "watching the clipboard using %s; copy a word to look it up\n", command[0])
+	var last string
+	for first := true; ; first = false {
+		if !first {
+			time.Sleep(*interval)
+		}
+		out, err := exec.Command(command[0], command[1:]...).Output()
+		if err != nil {
+			// An empty clipboard is an error for some of the tools.
+			continue
+		}
+		text := strings.TrimSpace(string(out))
+		// Do not look up whatever was in the clipboard before watching started.
+		if text == last || first {
+			last = text
+			continue
+		}
+		last = text
+		if !isSingleWord(text) {
+			continue
+		}
+		words, errResp, err := searchWord(context.Background(), strings.ToLower(text), provider)
+		fmt.Println(strings.Repeat("─", 40))
+		switch {
+		case errResp != nil:
+			fmt.Println(errResp.Title)
+			continue
+		case err != nil:
+			log.Print(err)
+			fmt.Printf("Failed to look up %s, see the log\n", text)
+			continue
+		}
+		writeWordsText(os.Stdout, words)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Comparison is the result of looking up a word in the primary and the shadow upstream,
+// for rendering side by side.
+type Comparison struct {
+	Sources     [2]ComparedSource
+	Differences []string
+}
+
+// ComparedSource is the result of one upstream in a Comparison.
+// The meanings of all entries are merged into one list.
+type ComparedSource struct {
+	Name     string
+	Error    string
+	Meanings []ComparedMeaning
+}
+
+// ComparedMeaning is a meaning in a ComparedSource.
+// Differs is set if the other source has no meaning with the same part of speech.
+type ComparedMeaning struct {
+	PartOfSpeech string
+	Definitions  []ComparedDefinition
+	Differs      bool
+}
+
+// ComparedDefinition is a definition in a ComparedMeaning.
+// Differs is set if the other source has no such definition for the same part of speech.
+type ComparedDefinition struct {
+	Definition string
+	Differs    bool
+}
+
+// definitionSet returns the definitions in words, keyed by part of speech.
+func definitionSet(words []Word) map[string]map[string]bool {
+	set := make(map[string]map[string]bool)
+	for _, w := range words {
+		for _, m := range w.Meanings {
+			if set[m.PartOfSpeech] == nil {
+				set[m.PartOfSpeech] = make(map[string]bool)
+			}
+			for _, d := range m.Definitions {
+				set[m.PartOfSpeech][d.Definition] = true
+			}
+		}
+	}
+	return set
+}
+
+// compareSource returns the ComparedSource for words, highlighting what is not in other.
+func compareSource(name string, words []Word, other map[string]map[string]bool) ComparedSource {
+	source := ComparedSource{Name: name}
+	for _, w := range words {
+		for _, m := range w.Meanings {
+			cm := ComparedMeaning{PartOfSpeech: m.PartOfSpeech, Differs: other[m.PartOfSpeech] == nil}
+			for _, d := range m.Definitions {
+				cm.Definitions = append(cm.Definitions, ComparedDefinition{
+					Definition: d.Definition,
+					Differs:    !other[m.PartOfSpeech][d.Definition],
+				})
+			}
+			source.Meanings = append(source.Meanings, cm)
+		}
+	}
+	return source
+}
+
+// compareSources looks up word in the shadow upstream, in the language given by
+// languageFrom(ctx), and compares the result with words, the result of the primary
+// provider named primary.
+func compareSources(ctx context.Context, word string, words []Word, primary string, s *shadow) *Comparison {
+	var shadowWords []Word
+	var shadowErr string
+	status, data, _, err := s.upstream.fetch(ctx, word, languageFrom(ctx))
+	switch {
+	case err != nil:
+		shadowErr = err.Error()
+	case status/100 != 2:
+		shadowErr = fmt.Sprintf("status %d", status)
+	default:
+		if err := json.Unmarshal(data, &shadowWords); err != nil {
+			shadowErr = "invalid response: " + err.Error()
+		}
+	}
+	c := &Comparison{Differences: diffWords(words, shadowWords)}
+	c.Sources[0] = compareSource(primary, words, definitionSet(shadowWords))
+	c.Sources[1] = compareSource(s.upstream.BaseURL, shadowWords, definitionSet(words))
+	c.Sources[1].Error = shadowErr
+	return c
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// AppConfig is the configuration of the web server.
+// It is read from an optional TOML file, see configFile, which is overridden by the
+// environment variables and then by the command-line flags. Settings of the subcommands
+// and of less common features are only read from environment variables.
+type AppConfig struct {
+	// Listen is the address the server listens on.
+	Listen string `toml:"listen"`
+	// AdminListen, $GODICT_ADMIN_LISTEN, is the address of a separate listener for the
+	// routes that change data, like favorites and imports, and the admin pages. If set,
+	// those are not served on Listen at all, which is then read-only; it should only be
+	// reachable from the local machine or a VPN.
+	AdminListen string `toml:"admin_listen"`
+	// CacheDir is the cache directory, see initCacheDir for the default.
+	CacheDir string `toml:"cache_dir"`
+	// CacheWarm is the number of cache entries loaded into memory at startup,
+	// $GODICT_CACHE_WARM; see entryCache.warm.
+	CacheWarm int `toml:"cache_warm"`
+	// MemoryLimit limits the memory used by cache entries and the suggestion index,
+	// $GODICT_MEMORY_LIMIT. Beyond it, they are read from disk; see cacheMemory.
+	MemoryLimit byteSize `toml:"memory_limit"`
+	// Snapshots enables keeping the versions of cache entries, $GODICT_SNAPSHOTS; see
+	// entryCache.addSnapshot.
+	Snapshots bool `toml:"snapshots"`
+	// TemplateDir is the directory of the HTML templates.
+	TemplateDir string `toml:"template_dir"`
+	// UpstreamURL is the URL of the dictionary API, $GODICT_API_URL.
+	UpstreamURL string `toml:"upstream_url"`
+	// Provider selects the dictionary, $GODICT_PROVIDER: "dictionaryapi" for the
+	// dictionary API at UpstreamURL, "dict" for the DICT server at DictServer,
+	// "wiktionary" for the Wiktionary at WiktionaryURL, or several of them separated by
+	// commas, to fall back to the next if one fails; see fallbackProvider.
+	Provider string `toml:"provider"`
+	// DictServer is the address of the DICT server, $GODICT_DICT_SERVER, and
+	// DictDatabase the database to look words up in, $GODICT_DICT_DATABASE.
+	DictServer   string `toml:"dict_server"`
+	DictDatabase string `toml:"dict_database"`
+	// WiktionaryURL is the URL of the Wiktionary, $GODICT_WIKTIONARY_URL.
+	WiktionaryURL string `toml:"wiktionary_url"`
+	// Homepage configures the blocks of the homepage.
+	Homepage homepageConfig `toml:"homepage"`
+	// RateLimit limits the requests per client, $GODICT_RATE_LIMIT and $GODICT_RATE_BURST.
+	RateLimit rateLimit `toml:"rate_limit"`
+	// ReadTimeout and WriteTimeout limit how long reading a request and writing the
+	// response may take, and IdleTimeout how long idle keep-alive connections are kept.
+	// UpstreamTimeout limits requests to the upstream.
+	ReadTimeout     time.Duration `toml:"read_timeout"`
+	WriteTimeout    time.Duration `toml:"write_timeout"`
+	IdleTimeout     time.Duration `toml:"idle_timeout"`
+	UpstreamTimeout time.Duration `toml:"upstream_timeout"`
+	// JSONLogs enables the startup banner on stdout, see startupBanner.
+	JSONLogs bool `toml:"json_logs"`
+	// Offline disables upstream requests; words are looked up in the cache and the offline
+	// dictionary only. See Upstream.Offline.
+	Offline bool `toml:"offline"`
+	// AnonymizeIPs anonymizes the addresses of clients before they reach the logs, the
+	// rate limiter and the analytics, $GODICT_ANONYMIZE_IPS: "truncate" or "hash"; see
+	// withAnonymizedAddr.
+	AnonymizeIPs string `toml:"anonymize_ips"`
+
+	// file is the configuration file, if any, and sources the source of each setting,
+	// keyed by configSetting.Key.
+	file    string
+	sources map[string]string
+}
+
+// Sources of configuration settings.
+const (
+	configDefault  = "default"
+	configFromFile = "file"
+	configFromEnv  = "env"
+	configFromFlag = "flag"
+)
+
+// configSetting describes a setting of AppConfig.
+type configSetting struct {
+	// Key is the key in the configuration file, with tables separated by dots.
+	Key string `json:"key"`
+	// Env and Flag are the environment variable and the command-line flag setting it.
+	Env  string `json:"env,omitempty"`
+	Flag string `json:"flag"`
+}
+
+// configSettings are all settings of AppConfig.
+var configSettings = []configSetting{
+	{Key: "listen", Flag: "listen"},
+	{Key: "admin_listen", Env: "GODICT_ADMIN_LISTEN", Flag: "admin-listen"},
+	{Key: "cache_dir", Flag: "cache-dir"},
+	{Key: "cache_warm", Env: "GODICT_CACHE_WARM", Flag: "cache-warm"},
+	{Key: "memory_limit", Env: "GODICT_MEMORY_LIMIT", Flag: "memory-limit"},
+	{Key: "snapshots", Env: "GODICT_SNAPSHOTS", Flag: "snapshots"},
+	{Key: "template_dir", Flag: "template-dir"},
+	{Key: "upstream_url", Env: "GODICT_API_URL", Flag: "upstream"},
+	{Key: "provider", Env: "GODICT_PROVIDER", Flag: "provider"},
+	{Key: "dict_server", Env: "GODICT_DICT_SERVER", Flag: "dict-server"},
+	{Key: "dict_database", Env: "GODICT_DICT_DATABASE", Flag: "dict-database"},
+	{Key: "wiktionary_url", Env: "GODICT_WIKTIONARY_URL", Flag: "wiktionary-url"},
+	{Key: "homepage.blocks", Env: "GODICT_HOMEPAGE", Flag: "homepage"},
+	{Key: "homepage.notice", Env: "GODICT_HOMEPAGE_NOTICE", Flag: "homepage-notice"},
+	{Key: "rate_limit.rate", Env: "GODICT_RATE_LIMIT", Flag: "rate-limit"},
+	{Key: "rate_limit.burst", Env: "GODICT_RATE_BURST", Flag: "rate-burst"},
+	{Key: "read_timeout", Flag: "read-timeout"},
+	{Key: "write_timeout", Flag: "write-timeout"},
+	{Key: "idle_timeout", Flag: "idle-timeout"},
+	{Key: "upstream_timeout", Flag: "upstream-timeout"},
+	{Key: "json_logs", Flag: "json-logs"},
+	{Key: "offline", Flag: "offline"},
+	{Key: "anonymize_ips", Env: "GODICT_ANONYMIZE_IPS", Flag: "anonymize-ips"},
+}
+
+// defaultConfig returns the configuration used if nothing is configured.
+func defaultConfig() AppConfig {
+	return AppConfig{
+		Listen:          ":8080",
+		CacheWarm:       100,
+		MemoryLimit:     defaultMemoryLimit,
+		TemplateDir:     "templates",
+		UpstreamURL:     "https://api.dictionaryapi.dev/api/",
+		Provider:        "dictionaryapi",
+		DictServer:      "dict.org",
+		DictDatabase:    "wn",
+		WiktionaryURL:   "https://en.wiktionary.org",
+		Homepage:        homepageConfig{Blocks: blockList{"wotd"}},
+		RateLimit:       rateLimit{Rate: 1, Burst: 5},
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		IdleTimeout:     2 * time.Minute,
+		UpstreamTimeout: 10 * time.Second,
+	}
+}
+
+// configFile returns the name of the configuration file: $GODICT_CONFIG, or
+// $XDG_CONFIG_HOME/godict/config.toml or $HOME/.config/godict/config.toml if it exists.
+// If there is none, an empty string is returned.
+func configFile() string {
+	if name := os.Getenv("GODICT_CONFIG"); name != "" {
+		return name
+	}
+	name := defaultConfigFile()
+	if name == "" {
+		return ""
+	}
+	if _, err := os.Stat(name); err != nil {
+		return ""
+	}
+	return name
+}
+
+// defaultConfigFile returns the name of the configuration file in the configuration dir,
+// $XDG_CONFIG_HOME/godict/config.toml or $HOME/.config/godict/config.toml, whether it
+// exists or not. If there is no configuration dir, an empty string is returned.
+func defaultConfigFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return ""
+		}
+		dir = path.Join(home, ".config")
+	}
+	return path.Join(dir, "godict", "config.toml")
+}
+
+// instanceConfigFile returns the name of the configuration file of c, or of the one to
+// create if it has none: $GODICT_CONFIG or defaultConfigFile.
+func (c AppConfig) instanceConfigFile() string {
+	if c.file != "" {
+		return c.file
+	}
+	if name := os.Getenv("GODICT_CONFIG"); name != "" {
+		return name
+	}
+	return defaultConfigFile()
+}
+
+// configFlags returns the command-line flags of the server, which set the fields of c.
+// The name of the configuration file is stored in file.
+func configFlags(c *AppConfig, file *string) *flag.FlagSet {
+	fs := flag.NewFlagSet(path.Base(os.Args[0]), flag.ExitOnError)
+	fs.StringVar(file, "config", *file, "configuration file")
+	fs.StringVar(&c.Listen, "listen", c.Listen, "address to listen on")
+	fs.StringVar(&c.AdminListen, "admin-listen", c.AdminListen, "address to serve the routes changing data and the admin pages on, instead of the listen address")
+	fs.StringVar(&c.CacheDir, "cache-dir", c.CacheDir, "cache directory (default $XDG_CACHE_HOME/godict)")
+	fs.IntVar(&c.CacheWarm, "cache-warm", c.CacheWarm, "number of cache entries to load into memory at startup")
+	fs.Var(&c.MemoryLimit, "memory-limit", "memory for cache entries and the suggestion index, like 64MiB")
+	fs.BoolVar(&c.Snapshots, "snapshots", c.Snapshots, "keep the versions of cache entries, for lookups with ?asof=YYYY-MM-DD")
+	fs.StringVar(&c.TemplateDir, "template-dir", c.TemplateDir, "directory of the HTML templates")
+	fs.StringVar(&c.UpstreamURL, "upstream", c.UpstreamURL, "URL of the dictionary API")
+	fs.StringVar(&c.Provider, "provider", c.Provider, "dictionary to use: dictionaryapi, dict, wiktionary, or several separated by commas for a fallback")
+	fs.StringVar(&c.DictServer, "dict-server", c.DictServer, "address of the DICT (RFC 2229) server")
+	fs.StringVar(&c.DictDatabase, "dict-database", c.DictDatabase, "database of the DICT server, or * for all")
+	fs.StringVar(&c.WiktionaryURL, "wiktionary-url", c.WiktionaryURL, "URL of the Wiktionary")
+	fs.Var(&c.Homepage.Blocks, "homepage", "blocks of the homepage, in order: "+strings.Join(homepageBlockKinds, ", "))
+	fs.StringVar(&c.Homepage.Notice, "homepage-notice", c.Homepage.Notice, "HTML of the notice block of the homepage")
+	fs.Float64Var(&c.RateLimit.Rate, "rate-limit", c.RateLimit.Rate, "requests per second per client")
+	fs.IntVar(&c.RateLimit.Burst, "rate-burst", c.RateLimit.Burst, "requests per client at once")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "timeout for reading a request")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "timeout for writing a response")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "timeout for idle keep-alive connections")
+	fs.DurationVar(&c.UpstreamTimeout, "upstream-timeout", c.UpstreamTimeout, "timeout for upstream requests")
+	fs.BoolVar(&c.JSONLogs, "json-logs", c.JSONLogs, "write a JSON line to stdout once the server is ready")
+	fs.BoolVar(&c.Offline, "offline", c.Offline, "look words up in the cache and the offline dictionary only")
+	fs.StringVar(&c.AnonymizeIPs, "anonymize-ips", c.AnonymizeIPs, "anonymize client addresses: truncate or hash")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s [flags]\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// loadConfig returns the server configuration, as described for AppConfig, given the
+// command-line arguments args.
+func loadConfig(args []string) (AppConfig, error) {
+	// The flags are parsed twice: first for the name of the configuration file, then to
+	// override the settings from the file and the environment.
+	c := defaultConfig()
+	file := configFile()
+	configFlags(&c, &file).Parse(args)
+
+	c = defaultConfig()
+	c.file = file
+	c.sources = make(map[string]string)
+	for _, s := range configSettings {
+		c.sources[s.Key] = configDefault
+	}
+	if file != "" {
+		meta, err := toml.DecodeFile(file, &c)
+		if err != nil {
+			return c, err
+		}
+		for _, s := range configSettings {
+			if meta.IsDefined(strings.Split(s.Key, ".")...) {
+				c.sources[s.Key] = configFromFile
+			}
+		}
+	}
+	for _, s := range configSettings {
+		if s.Env != "" && os.Getenv(s.Env) != "" {
+			c.sources[s.Key] = configFromEnv
+		}
+	}
+	if s := os.Getenv("GODICT_API_URL"); s != "" {
+		c.UpstreamURL = s
+	}
+	if s := os.Getenv("GODICT_ADMIN_LISTEN"); s != "" {
+		c.AdminListen = s
+	}
+	if s := os.Getenv("GODICT_PROVIDER"); s != "" {
+		c.Provider = s
+	}
+	if s := os.Getenv("GODICT_DICT_SERVER"); s != "" {
+		c.DictServer = s
+	}
+	if s := os.Getenv("GODICT_DICT_DATABASE"); s != "" {
+		c.DictDatabase = s
+	}
+	if s := os.Getenv("GODICT_WIKTIONARY_URL"); s != "" {
+		c.WiktionaryURL = s
+	}
+	if s := os.Getenv("GODICT_ANONYMIZE_IPS"); s != "" {
+		c.AnonymizeIPs = s
+	}
+	if s := os.Getenv("GODICT_HOMEPAGE"); s != "" {
+		c.Homepage.Blocks.Set(s)
+	}
+	if s := os.Getenv("GODICT_HOMEPAGE_NOTICE"); s != "" {
+		c.Homepage.Notice = s
+	}
+	if s := os.Getenv("GODICT_RATE_LIMIT"); s != "" {
+		rate, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return c, fmt.Errorf("invalid number in $GODICT_RATE_LIMIT: %s", s)
+		}
+		c.RateLimit.Rate = rate
+	}
+	if s := os.Getenv("GODICT_RATE_BURST"); s != "" {
+		burst, err := strconv.Atoi(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid integer in $GODICT_RATE_BURST: %s", s)
+		}
+		c.RateLimit.Burst = burst
+	}
+	if s := os.Getenv("GODICT_CACHE_WARM"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid integer in $GODICT_CACHE_WARM: %s", s)
+		}
+		c.CacheWarm = n
+	}
+	if os.Getenv("GODICT_SNAPSHOTS") != "" {
+		c.Snapshots = os.Getenv("GODICT_SNAPSHOTS") == "1"
+	}
+	if s := os.Getenv("GODICT_MEMORY_LIMIT"); s != "" {
+		limit, err := parseByteSize(s)
+		if err != nil {
+			return c, fmt.Errorf("invalid size in $GODICT_MEMORY_LIMIT: %s", s)
+		}
+		c.MemoryLimit = limit
+	}
+	fs := configFlags(&c, &file)
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return c, fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range configSettings {
+			if s.Flag == f.Name {
+				c.sources[s.Key] = configFromFlag
+			}
+		}
+	})
+
+	if c.RateLimit.Rate <= 0 || c.RateLimit.Burst < 1 {
+		return c, fmt.Errorf("rate limit and burst must be positive")
+	}
+	if c.Listen == "" || c.UpstreamURL == "" {
+		return c, fmt.Errorf("listen address and upstream URL must be set")
+	}
+	if c.AdminListen == c.Listen {
+		return c, fmt.Errorf("admin listen address must differ from the listen address")
+	}
+	for _, name := range strings.Split(c.Provider, ",") {
+		if name != "dictionaryapi" && name != "dict" && name != "wiktionary" {
+			return c, fmt.Errorf("unknown provider: %s", name)
+		}
+	}
+	if c.AnonymizeIPs != "" && c.AnonymizeIPs != anonymizeTruncate && c.AnonymizeIPs != anonymizeHash {
+		return c, fmt.Errorf("unknown IP anonymization: %s", c.AnonymizeIPs)
+	}
+	for _, kind := range c.Homepage.Blocks {
+		if !validHomepageBlock(kind) {
+			return c, fmt.Errorf("unknown homepage block: %s", kind)
+		}
+	}
+	return c, nil
+}
+
+// commandConfig returns the configuration of the subcommands: that of the server, from its
+// configuration file and the environment, so that they use the same cache and dictionary.
+func commandConfig() AppConfig {
+	c, err := loadConfig(nil)
+	if err != nil {
+		log.Fatal("failed to load configuration: ", err)
+	}
+	return c
+}
+
+// initCacheDir initializes the configured cache directory and returns its path, or the
+// default one of initCacheDir if none is configured.
+func (c *AppConfig) initCacheDir() string {
+	if c.CacheDir == "" {
+		return initCacheDir()
+	}
+	if err := os.MkdirAll(c.CacheDir, 0755); err != nil {
+		log.Printf("failed to create cache dir: %s; ignoring", c.CacheDir)
+		return ""
+	}
+	log.Print("cache dir: ", c.CacheDir)
+	return c.CacheDir
+}
+
+// lookupProvider returns the configured Provider for the subcommands, caching entries of
+// the dictionary API in cache.
+func (c *AppConfig) lookupProvider(cache *entryCache) Provider {
+	return c.newProvider(newDictionaryAPI(c.newUpstream(), cache))
+}
+
+// newProvider returns the configured Provider; api is the Provider for the dictionary API.
+func (c *AppConfig) newProvider(api Provider) Provider {
+	var providers fallbackProvider
+	for _, name := range strings.Split(c.Provider, ",") {
+		switch name {
+		case "dictionaryapi":
+			providers = append(providers, api)
+		case "dict":
+			providers = append(providers, newDictProtocol(c.DictServer, c.DictDatabase, c.UpstreamTimeout))
+		case "wiktionary":
+			providers = append(providers, newWiktionary(c.WiktionaryURL, c.UpstreamTimeout))
+		}
+	}
+	if len(providers) == 1 {
+		return providers[0]
+	}
+	return providers
+}
+
+// value returns the value of the setting with key, formatted as in the configuration file.
+func (c *AppConfig) value(key string) string {
+	v := reflect.ValueOf(c).Elem()
+	for _, name := range strings.Split(key, ".") {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).Tag.Get("toml") == name {
+				v = v.Field(i)
+				break
+			}
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// redactConfig returns value, the value of the setting or environment variable name, with
+// secrets redacted: values of names mentioning tokens, keys, secrets or passwords, and
+// passwords in URLs.
+func redactConfig(name, value string) string {
+	upper := strings.ToUpper(name)
+	for _, s := range []string{"TOKEN", "KEY", "SECRET", "PASSWORD"} {
+		if strings.Contains(upper, s) && value != "" {
+			return "REDACTED"
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return value
+}
+
+// handleAdminConfig handles requests to "/admin/config".
+// It shows the effective configuration, with the source of each setting: the default, the
+// configuration file, an environment variable or a command-line flag. Besides, it shows
+// all GODICT_* environment variables, which configure the other features. Secrets are
+// redacted, see redactConfig.
+func handleAdminConfig(config AppConfig) func(_ http.ResponseWriter, _ *http.Request) {
+	type setting struct {
+		configSetting
+		Value  string `json:"value"`
+		Source string `json:"source"`
+	}
+	return func(w http.ResponseWriter, req *http.Request) {
+		settings := make([]setting, 0, len(configSettings))
+		for _, s := range configSettings {
+			settings = append(settings, setting{
+				configSetting: s,
+				Value:         redactConfig(s.Key, config.value(s.Key)),
+				Source:        config.sources[s.Key],
+			})
+		}
+		env := make(map[string]string)
+		for _, kv := range os.Environ() {
+			name, value, _ := strings.Cut(kv, "=")
+			if strings.HasPrefix(name, "GODICT_") {
+				env[name] = redactConfig(name, value)
+			}
+		}
+		writeJSON(w, http.StatusOK, struct {
+			File        string            `json:"file,omitempty"`
+			Settings    []setting         `json:"settings"`
+			Environment map[string]string `json:"environment"`
+		}{config.file, settings, env})
+	}
+}
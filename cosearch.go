@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// coSearchFile is the name of the co-search counts in the data directory.
+const coSearchFile = "cosearches.json"
+
+const (
+	// coSearchWindow is how long after a search other searches of the same session count
+	// as searched along with it.
+	coSearchWindow = time.Hour
+	// coSearchMaxRelated is the number of words counted for each word at most; when
+	// exceeded, the least searched along with it is forgotten.
+	coSearchMaxRelated = 50
+	// coSearchShown is the number of words shown as searched along with a word.
+	coSearchShown = 5
+)
+
+// coSearches counts how many browser sessions searched two words within coSearchWindow of
+// each other, for the "people also looked up" suggestions on word pages. The sessions are
+// those of the search history, see recordHistory, and only the counts are kept, not who
+// searched what. A pair of words is only suggested once it was searched by at least
+// minSessions sessions, so that the suggestions do not reveal the searches of anybody.
+// Requests in privacy mode are not counted, see recorder.coSearch. A nil *coSearches
+// counts nothing.
+type coSearches struct {
+	path        string
+	minSessions int
+
+	mu sync.Mutex
+	// counts are the counts of the words searched along with a word, both keyed by the
+	// language and the word, like "en/hello".
+	counts map[string]map[string]int
+	dirty  bool
+}
+
+// loadCoSearches returns the co-search counts stored in dataDir. Pairs of words are
+// suggested once searched by $GODICT_COSEARCH_MIN_SESSIONS sessions, 3 by default. If
+// dataDir is empty, nil is returned and nothing is counted.
+func loadCoSearches(dataDir string) *coSearches {
+	if dataDir == "" {
+		return nil
+	}
+	c := &coSearches{
+		path:        path.Join(dataDir, coSearchFile),
+		minSessions: intEnv("GODICT_COSEARCH_MIN_SESSIONS", 3),
+		counts:      make(map[string]map[string]int),
+	}
+	data, err := os.ReadFile(c.path)
+	if err == nil {
+		err = json.Unmarshal(data, &c.counts)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Print("failed to read co-searches: ", err)
+	}
+	// The counts change with most searches, so they are saved periodically rather than
+	// on every change.
+	go func() {
+		for range time.Tick(time.Minute) {
+			c.flush()
+		}
+	}()
+	return c
+}
+
+// record counts the search for word in language lang, which was found, along with the
+// earlier searches of the session in history, its search history. Words already in the
+// history were counted when first searched, so that each session counts once.
+func (c *coSearches) record(history []historyEntry, word, lang string) {
+	if c == nil {
+		return
+	}
+	word = normalizeWord(word)
+	var related []string
+	for _, e := range history {
+		if e.Lang != lang {
+			continue
+		}
+		if normalizeWord(e.Word) == word {
+			return
+		}
+		if time.Since(e.Time) < coSearchWindow {
+			related = append(related, normalizeWord(e.Word))
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range related {
+		c.add(lang+"/"+word, lang+"/"+r)
+		c.add(lang+"/"+r, lang+"/"+word)
+	}
+	if len(related) > 0 {
+		c.dirty = true
+	}
+}
+
+// add counts a session searching the words with keys a and b.
+func (c *coSearches) add(a, b string) {
+	counts := c.counts[a]
+	if counts == nil {
+		counts = make(map[string]int)
+		c.counts[a] = counts
+	}
+	if _, ok := counts[b]; !ok && len(counts) >= coSearchMaxRelated {
+		least := ""
+		for k, n := range counts {
+			if least == "" || n < counts[least] {
+				least = k
+			}
+		}
+		delete(counts, least)
+	}
+	counts[b]++
+}
+
+// related returns the words in language lang searched along with word by at least
+// minSessions sessions, the most searched first.
+func (c *coSearches) related(word, lang string) []string {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := c.counts[lang+"/"+normalizeWord(word)]
+	var keys []string
+	for k, n := range counts {
+		if n >= c.minSessions {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > coSearchShown {
+		keys = keys[:coSearchShown]
+	}
+	words := make([]string, len(keys))
+	for i, k := range keys {
+		words[i] = k[len(lang)+1:]
+	}
+	return words
+}
+
+// flush saves the counts if they changed.
+func (c *coSearches) flush() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return
+	}
+	data, err := json.Marshal(c.counts)
+	if err == nil {
+		tmp := c.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, c.path)
+		}
+	}
+	if err != nil {
+		log.Print("failed to save co-searches: ", err)
+		return
+	}
+	c.dirty = false
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// relatedPath is the path of the related words API. Requests to relatedPath with the
+// "word" query argument return the RelatedWords of the word as JSON.
+const relatedPath = "/api/related"
+
+const (
+	// relatedTTL is how long related words are cached.
+	relatedTTL = 7 * 24 * time.Hour
+	// relatedMax is the number of words of each relation returned at most.
+	relatedMax = 10
+)
+
+// RelatedWords are words related to a word, from the Datamuse API: words that rhyme with it,
+// sound like it or mean something like it, and words that frequently follow it in text.
+// The most related words are first.
+type RelatedWords struct {
+	Word       string   `json:"word"`
+	Rhymes     []string `json:"rhymes"`
+	SoundsLike []string `json:"soundsLike"`
+	MeansLike  []string `json:"meansLike"`
+	Follows    []string `json:"follows"`
+}
+
+// datamuseRelations are the query arguments of the Datamuse API for each relation.
+var datamuseRelations = []string{"rel_rhy", "sl", "ml", "rel_bga"}
+
+// datamuse fetches related words from the Datamuse API, or an API compatible with it,
+// caching them in cacheDir if it is set. Datamuse only knows English words.
+type datamuse struct {
+	URL      string
+	cacheDir string
+	client   *http.Client
+}
+
+// initDatamuse returns the Datamuse API at $GODICT_DATAMUSE_URL, or at api.datamuse.com if
+// it is not set, caching related words in cacheDir.
+func initDatamuse(cacheDir string) *datamuse {
+	u := os.Getenv("GODICT_DATAMUSE_URL")
+	if u == "" {
+		u = "https://api.datamuse.com"
+	}
+	return &datamuse{URL: strings.TrimSuffix(u, "/"), cacheDir: cacheDir, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// fetch returns the words related to word with relation rel, one of datamuseRelations.
+func (d *datamuse) fetch(rel, word string) ([]string, error) {
+	q := url.Values{}
+	q.Set(rel, word)
+	q.Set("max", fmt.Sprint(relatedMax+1))
+	resp, err := d.client.Get(d.URL + "/words?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Datamuse answered %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var results []struct {
+		Word string `json:"word"`
+	}
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, fmt.Errorf("invalid Datamuse response: %w", err)
+	}
+	// Words sound like themselves; the word is left out.
+	words := []string{}
+	for _, r := range results {
+		if !strings.EqualFold(r.Word, word) && len(words) < relatedMax {
+			words = append(words, r.Word)
+		}
+	}
+	return words, nil
+}
+
+// related returns the words related to word, from the cache if possible. The relations
+// are fetched at the same time. Related words are cached in the ".datamuse" subdirectory
+// of the cache directory, in the same format as the API returns them, in a file named by
+// cacheFileName.
+func (d *datamuse) related(word string) (*RelatedWords, error) {
+	word = normalizeWord(word)
+	var cacheFile string
+	if d.cacheDir != "" {
+		dir := path.Join(d.cacheDir, ".datamuse")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Print("failed to create Datamuse cache dir: ", err)
+		} else {
+			cacheFile = path.Join(dir, cacheFileName(word))
+		}
+	}
+	if cacheFile != "" {
+		data, expires, err := readCacheFile(cacheFile)
+		if err == nil && time.Now().Before(expires) {
+			var r RelatedWords
+			if err := json.Unmarshal(data, &r); err == nil {
+				return &r, nil
+			}
+		}
+	}
+	r := &RelatedWords{Word: word}
+	lists := []*[]string{&r.Rhymes, &r.SoundsLike, &r.MeansLike, &r.Follows}
+	errs := make([]error, len(datamuseRelations))
+	var wg sync.WaitGroup
+	for i, rel := range datamuseRelations {
+		wg.Add(1)
+		go func(i int, rel string) {
+			defer wg.Done()
+			*lists[i], errs[i] = d.fetch(rel, word)
+		}(i, rel)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cacheFile != "" {
+		data, _ := json.Marshal(r)
+		if err := writeCacheFile(cacheFile, data, time.Now().Add(relatedTTL)); err != nil {
+			log.Print("failed to write Datamuse cache file: ", err)
+		}
+	}
+	return r, nil
+}
+
+// handleRelated handles requests to the related words API.
+func handleRelated(d *datamuse) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		p := requestParams(req)
+		word := p.required("word", maxParamLength)
+		lang := p.language("lang", defaultLanguage)
+		if !p.check(w) {
+			return
+		}
+		logSearch(req.Context(), "handle related: %s", word)
+		if lang != defaultLanguage {
+			writeError(w, req, http.StatusNotFound, "Related words are only available in English.", nil)
+			return
+		}
+		r, err := d.related(word)
+		if err != nil {
+			logSearch(req.Context(), "failed to fetch related words: %s", err)
+			writeError(w, req, http.StatusBadGateway, "The related words could not be fetched.", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, r)
+	}
+}
@@ -1,110 +1,154 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"html/template"
 	"io"
 	"log"
+	"math"
+	"mime"
+	"net"
 	"net/http"
 	"os"
 	"path"
-	"strings"
-	"time"
 	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
 )
 
 type Word struct {
-	Word      string
-	Phonetics []Phonetic
-	Meanings  []Meaning
+	Word       string     `json:"word"`
+	Phonetics  []Phonetic `json:"phonetics"`
+	Meanings   []Meaning  `json:"meanings"`
+	License    *License   `json:"license,omitempty"`
+	SourceURLs []string   `json:"sourceUrls,omitempty"`
+	// Etymology is the origin of the word, and Language the name of the language of the
+	// entry, if the dictionary has them; OtherLanguages are the codes of the other
+	// languages the dictionary has entries of the word in. See wiktionary.
+	Etymology      string   `json:"etymology,omitempty"`
+	Language       string   `json:"language,omitempty"`
+	OtherLanguages []string `json:"otherLanguages,omitempty"`
+	// Variants are the spelling variants of the word, in the definitions API only; see
+	// handleDefine.
+	Variants *SpellingVariants `json:"variants,omitempty"`
 }
 
 type Phonetic struct {
-	Text  string
-	Audio string
+	Text      string   `json:"text"`
+	Audio     string   `json:"audio"`
+	SourceURL string   `json:"sourceUrl,omitempty"`
+	License   *License `json:"license,omitempty"`
+}
+
+// License is the license of an entry or an audio recording.
+type License struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
 }
 
 type Meaning struct {
-	PartOfSpeech string
-	Definitions  []Definition
-	Synonyms     []string
-	Antonyms     []string
+	// ID identifies the meaning within a result, see assignIDs.
+	ID           string `json:"id,omitempty"`
+	PartOfSpeech string `json:"partOfSpeech"`
+	// PartOfSpeechLabel and PartOfSpeechAbbr are the localized label of the part of
+	// speech and its abbreviation, if asked for; see labelParts.
+	PartOfSpeechLabel string       `json:"partOfSpeechLabel,omitempty"`
+	PartOfSpeechAbbr  string       `json:"partOfSpeechAbbr,omitempty"`
+	Definitions       []Definition `json:"definitions"`
+	Synonyms          []string     `json:"synonyms"`
+	Antonyms          []string     `json:"antonyms"`
+	// UsageNotes are notes on the use of the word with the part of speech, if the
+	// dictionary has them.
+	UsageNotes string `json:"usageNotes,omitempty"`
 }
 
 type Definition struct {
-	Definition string
-	Synonyms   []string
-	Antonyms   []string
-	Example    string
+	// ID identifies the definition within a result, see assignIDs.
+	ID         string   `json:"id,omitempty"`
+	Definition string   `json:"definition"`
+	Synonyms   []string `json:"synonyms"`
+	Antonyms   []string `json:"antonyms"`
+	Example    string   `json:"example,omitempty"`
 }
 
 type ErrorResponse struct {
-	Title   string
-	Message string
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	// Variants are the spelling variants of the word that was not found, in the
+	// definitions API only; see handleDefine.
+	Variants *SpellingVariants `json:"variants,omitempty"`
 }
 
 type AppContext struct {
-	CacheDir string
-	Words    []Word
+	// Query is the searched word.
+	Query string
+	// Lang is the language searched in, and Languages are all languages available.
+	Lang      string
+	Languages []Language
+	Words     []Word
+	// Variants are the spelling variants of the searched word and of the words found.
+	Variants map[string]*SpellingVariants
+	// Links are the links to external sites for each of the words found.
+	Links    map[string][]OutboundLink
 	Template *template.Template
 	Error    *ErrorResponse
+	// Suggestions are the words the searched word was probably meant to be, if it was not
+	// found; see spellingSuggestions.
+	Suggestions []string
+	// Thesaurus is set in the thesaurus view, see handleThesaurus, which shows it instead
+	// of Words.
+	Thesaurus *Thesaurus
+	// Comparison is set when the results of the upstreams are compared.
+	Comparison *Comparison
+	// Private is set for requests in privacy mode, see isPrivate.
+	Private bool
+	// CanStar is set if favorites are enabled, and Starred is set for the words found
+	// that are starred.
+	CanStar bool
+	Starred map[string]bool
+	// CanWatch is set if watchlists are enabled, and Watched is set for the words found
+	// that are on the watchlist of the browser.
+	CanWatch bool
+	Watched  map[string]bool
+	// AlsoSearched are the words often searched along with the searched word, see
+	// coSearches.
+	AlsoSearched []string
+	// Homepage are the blocks of the homepage, see homepage.
+	Homepage []HomepageBlock
+	// Related are the words related to the searched word, if any; see datamuse.
+	Related *RelatedWords
+	// WordOfTheDay is the word of the day, if shown; see wordOfTheDay.
+	WordOfTheDay string
+	// AsOf is the date of the snapshot shown, if any; see withAsOf.
+	AsOf string
 }
 
-func searchWord(word string, app *AppContext) {
-	log.Print("asking: ", word)
-	cacheFile := path.Join(app.CacheDir, word)
-	if cacheFile != word {
-		data, err := os.ReadFile(cacheFile)
-		if err == nil {
-			log.Print("cache hit: ", cacheFile)
-			if e := json.Unmarshal(data, &app.Words); e != nil {
-				log.Fatal(e)
-			}
-			return
-		}
-		if os.IsNotExist(err) {
-			log.Print("cache miss: ", cacheFile)
-		} else {
-			log.Print("failed to read cache file: ", cacheFile)
-		}
-	}
-
-	const baseUrl = "https://api.dictionaryapi.dev/api/v2/entries/en/"
-	resp, err := http.Get(baseUrl + word)
-	if err != nil {
-		log.Printf("failed to GET %s: %s", baseUrl, err)
-		return
-	}
-	defer resp.Body.Close()
-
-	jsonData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Print("failed to read response body: ", err)
-		return
-	}
-	log.Print("response status code: ", resp.Status)
-	if !strings.HasPrefix(resp.Status, "20") {
-		var eResp ErrorResponse
-		if e := json.Unmarshal(jsonData, &eResp); e != nil {
-			log.Fatal(e)
+// searchWord looks up word with provider. It returns the entries found, or the error
+// response of the dictionary, e.g. if the word is not found, which is then recorded in
+// the no-results log by the recorder of ctx, unless ctx asks for a snapshot. Any other
+// error, like a dictionary that cannot be reached or returns an invalid response, is
+// returned as is. The result is compared with the shadow upstream, see recorder.compare.
+func searchWord(ctx context.Context, word string, provider Provider) ([]Word, *ErrorResponse, error) {
+	logSearch(ctx, "asking: %s", word)
+	words, err := provider.Lookup(ctx, word)
+	rec := recorderFrom(ctx)
+	rec.compare(word, languageFrom(ctx), words, err)
+	var providerErr *ProviderError
+	switch {
+	case errors.As(err, &providerErr):
+		// Words missing from the snapshots are not missing from the dictionary.
+		if _, asOf := asOfFrom(ctx); providerErr.Status == http.StatusNotFound && !asOf {
+			rec.noResult(word, provider.Name())
 		}
-		app.Error = &eResp
-		app.Error.Title += " — " + word
-		return
-	}
-
-	// Cache the result.
-	if cacheFile != word {
-		log.Print("caching: ", word)
-		err = os.WriteFile(cacheFile, jsonData, 0644)
-		if err != nil {
-			log.Print("failed to write cache: %s", err)
-		}
-	}
-	if e := json.Unmarshal(jsonData, &app.Words); e != nil {
-		log.Fatal(e)
+		resp := providerErr.Response
+		resp.Title += " — " + word
+		return nil, &resp, nil
+	case err != nil:
+		return nil, nil, err
 	}
+	return words, nil, nil
 }
 
 // initCacheDir initializes the cache directory and returns its path.
@@ -130,6 +174,47 @@ func initCacheDir() string {
 	return cacheDir
 }
 
+// initDataDir initializes the data directory and returns its path.
+// The data directory holds state that, unlike the cache, cannot be recreated. It is
+// created if it does not exist. The path is either the value of $XDG_DATA_HOME/godict or
+// $HOME/.local/share/godict.
+// If the initialization fails, an empty string is returned, indicating that features
+// storing data are disabled.
+func initDataDir() string {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		dataDir = os.Getenv("HOME")
+		if dataDir == "" {
+			log.Fatal("$HOME not set")
+		}
+		dataDir = path.Join(dataDir, ".local", "share")
+	}
+	dataDir = path.Join(dataDir, "godict")
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		log.Printf("failed to create data dir: %s; ignoring", dataDir)
+		return ""
+	}
+	log.Print("data dir: ", dataDir)
+	return dataDir
+}
+
+// plainTemplate is the name of the template of the text-only view, which is parsed along
+// with the main template.
+const plainTemplate = "plain.tmpl"
+
+// viewTemplate returns the template rendering the pages of tmpl for req: the text-only
+// view if the "plain" query argument is "1", and tmpl otherwise. The text-only view has
+// semantic markup only, without styles and scripts, with the content in reading order,
+// for screen readers and text browsers.
+func viewTemplate(tmpl *template.Template, req *http.Request) *template.Template {
+	if req.FormValue("plain") == "1" {
+		if plain := tmpl.Lookup(plainTemplate); plain != nil {
+			return plain
+		}
+	}
+	return tmpl
+}
+
 // renderTemplate renders the main template.
 func renderTemplate(w http.ResponseWriter, app *AppContext) {
 	err := app.Template.Execute(w, app)
@@ -140,54 +225,140 @@ func renderTemplate(w http.ResponseWriter, app *AppContext) {
 }
 
 // handleWithRateLimit wraps handler with a rate limiter.
-// The rate is limited to one request per second.
-func handleWithRateLimit(handler func(_ http.ResponseWriter, _ *http.Request)) func(_ http.ResponseWriter, _ *http.Request) {
-	limiter := time.Tick(time.Second)
+// The rate is limited per client IP address, as configured by limit. Requests over the
+// limit are answered with 429 Too Many Requests and a Retry-After header, and on API
+// routes with an APIError giving the same wait in its details.
+func handleWithRateLimit(limit rateLimit, handler func(_ http.ResponseWriter, _ *http.Request)) func(_ http.ResponseWriter, _ *http.Request) {
+	limiter := newRateLimiter(limit)
 	return func(w http.ResponseWriter, r *http.Request) {
-		select {
-		case <-limiter:
-			handler(w, r)
-		default:
+		client := clientAddr(r)
+		if ok, wait := limiter.allow(client); !ok {
 			// Ain't nothing like a bit of runtime reflection of function pointers!
 			h := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
-			log.Printf("%s: rate limit exceeded", h)
+			log.Printf("%s: rate limit exceeded: %s", h, client)
+			// Handlers are closures, named like "main.handleSearch.func1".
+			name, _, _ := strings.Cut(strings.TrimPrefix(h, "main."), ".")
+			rateLimitedTotal.inc(name)
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			if isAPIPath(r.URL.Path) {
+				writeError(w, r, http.StatusTooManyRequests, "Too many requests.", map[string]int{"retry_after": retryAfter})
+				return
+			}
+			http.Error(w, "Oops", http.StatusTooManyRequests)
+			return
 		}
+		handler(w, r)
 	}
 }
 
-// handleRoot handles requests to "/".
-func handleRoot(tmpl *template.Template) func(_ http.ResponseWriter, _ *http.Request) {
-	return func(w http.ResponseWriter, req *http.Request) {
-		renderTemplate(w, &AppContext{Template: tmpl})
-	}
-}
-
-// handleSearch handles requests to "/search".
-// It takes the word to search for from the "word" query argument.
-func handleSearch(tmpl *template.Template, cacheDir string) func(_ http.ResponseWriter, _ *http.Request) {
+// handleSearch handles requests to "/search" and to the permanent links under wordPrefix.
+// It takes the word to search for from the path of permanent links, or from the "word"
+// query argument, and the language from the "lang" query argument. If the
+// "compare_sources" query argument is "1" and a shadow upstream is configured, the
+// results of both upstreams are shown side by side. The result is HTML, JSON or plain
+// text, as the Accept header of the request prefers; see render.
+func handleSearch(tmpl *template.Template, provider Provider, shadow *shadow, links []linkTemplate, sessionKey []byte, favorites *favorites, watchlists *watchlists, coSearches *coSearches, datamuse *datamuse) func(_ http.ResponseWriter, _ *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 		word := req.FormValue("word")
-		app := AppContext{CacheDir: cacheDir, Template: tmpl}
-		log.Print("handle search: ", word)
+		if strings.HasPrefix(req.URL.Path, wordPrefix) {
+			word = strings.TrimPrefix(req.URL.Path, wordPrefix)
+		}
+		app := AppContext{
+			Template:  viewTemplate(tmpl, req),
+			Lang:      requestLanguage(req),
+			Languages: languages,
+			Private:   isPrivate(req.Context()),
+		}
+		logSearch(req.Context(), "handle search: %s (%s)", word, app.Lang)
 		if word == "" {
 			http.Redirect(w, req, "/", http.StatusSeeOther)
 			return
 		}
-		searchWord(word, &app)
-		renderTemplate(w, &app)
+		ctx := withLanguage(req.Context(), app.Lang)
+		p := requestParams(req)
+		asOf, ok := p.asOf("asof")
+		labels := p.labelLanguage("labels", true)
+		if !p.check(w) {
+			return
+		}
+		if ok {
+			ctx = withAsOf(ctx, asOf)
+			app.AsOf = asOf.Format(asOfLayout)
+		}
+		words, errResp, err := searchWord(ctx, word, provider)
+		if err != nil {
+			log.Print(err)
+			app.Query = word
+			app.Error = &ErrorResponse{Title: "Bad Gateway — " + word, Message: "The dictionary could not be reached or returned an invalid response."}
+			render(w, req, http.StatusBadGateway, &app)
+			return
+		}
+		app.Words, app.Error = words, errResp
+		rec := recorderFrom(req.Context())
+		if app.AsOf == "" {
+			rec.search(req, word, app.Lang, errResp == nil)
+		}
+		if errResp == nil {
+			rec.coSearch(readHistory(req, sessionKey), word, app.Lang)
+			rec.history(w, req, sessionKey, word, app.Lang)
+			app.AlsoSearched = coSearches.related(word, app.Lang)
+		}
+		// Datamuse only knows English words.
+		if errResp == nil && app.Lang == defaultLanguage {
+			if related, err := datamuse.related(word); err != nil {
+				logSearch(req.Context(), "failed to fetch related words: %s", err)
+			} else {
+				app.Related = related
+			}
+		}
+		proxyAudio(word, app.Lang, app.Words)
+		// The bundled word list is English.
+		if errResp != nil && app.Lang == defaultLanguage {
+			app.Suggestions = spellingSuggestions(word)
+		}
+		assignIDs(app.Words)
+		labelParts(app.Words, labels)
+		app.Query = word
+		app.Variants = make(map[string]*SpellingVariants)
+		app.Links = make(map[string][]OutboundLink)
+		app.CanStar = favorites != nil
+		app.Starred = make(map[string]bool)
+		app.CanWatch = watchlists != nil
+		app.Watched = make(map[string]bool)
+		watcher, _ := watchlists.watcherID(req)
+		for _, w := range app.Words {
+			app.Starred[w.Word] = favorites.has(w.Word, app.Lang)
+			app.Watched[w.Word] = watchlists.watching(watcher, w.Word, app.Lang)
+			// The spelling variant datasets are English.
+			if v, ok := spellingVariants(w.Word); ok && app.Lang == defaultLanguage {
+				app.Variants[w.Word] = &v
+			}
+			app.Links[w.Word] = outboundLinks(links, w.Word)
+		}
+		if v, ok := spellingVariants(word); ok && app.Lang == defaultLanguage {
+			app.Variants[word] = &v
+		}
+		if req.FormValue("compare_sources") == "1" && shadow != nil {
+			app.Comparison = compareSources(ctx, word, app.Words, provider.Name(), shadow)
+		}
+		render(w, req, http.StatusOK, &app)
 	}
 }
 
+// staticFiles are the static files served by handleStatic, relative to the working dir.
+var staticFiles = []string{"/static/dict.css", "/static/suggest.js", "/static/kiosk.js"}
+
 func handleStatic(w http.ResponseWriter, r *http.Request) {
 	log.Print("serving static file: ", r.URL.Path)
 
 	// Do a simple whitelist check first.
-	whitelist := map[string]bool{"/static/dict.css": true}
-	if !whitelist[r.URL.Path] {
+	if !contains(staticFiles, r.URL.Path) {
 		log.Print("static file not whitelisted: ", r.URL.Path)
 		http.Error(w, "Oops", http.StatusNotFound)
 		return
 	}
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(r.URL.Path)))
 
 	wd, err := os.Getwd()
 	if err != nil {
@@ -207,10 +378,235 @@ func handleStatic(w http.ResponseWriter, r *http.Request) {
 
 func main() {
 	log.Default().SetFlags(log.Ldate | log.Lmicroseconds | log.Lshortfile)
-	templates := template.Must(template.ParseFiles("templates/main.tmpl"))
-	cacheDir := initCacheDir()
-	http.HandleFunc("/", handleWithRateLimit(handleRoot(templates)))
-	http.HandleFunc("/search", handleWithRateLimit(handleSearch(templates, cacheDir)))
-	http.HandleFunc("/static/", handleWithRateLimit(handleStatic))
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	if len(os.Args) > 1 && (os.Args[1] == "-" || !strings.HasPrefix(os.Args[1], "-")) {
+		config := commandConfig()
+		switch os.Args[1] {
+		case "prefetch":
+			prefetch(config, os.Args[2:])
+			return
+		case "doctor":
+			doctor(config, os.Args[2:])
+			return
+		case "noresults":
+			noResultsReport(os.Args[2:])
+			return
+		case "export-instance":
+			exportInstance(config, os.Args[2:])
+			return
+		case "import-instance":
+			importInstance(config, os.Args[2:])
+			return
+		case "wordlist":
+			wordList(os.Args[2:])
+			return
+		case "watch-clipboard":
+			watchClipboard(config, os.Args[2:])
+			return
+		case "tui":
+			tui(config, os.Args[2:])
+			return
+		case "repl":
+			replMain(config, os.Args[2:])
+			return
+		case "lookup":
+			lookup(config, os.Args[2:])
+			return
+		case "rpc":
+			rpc(config, os.Args[2:])
+			return
+		case "spell":
+			spell(config, os.Args[2:])
+			return
+		case "launcher":
+			launcher(config, os.Args[2:])
+			return
+		case "schema":
+			schemaCommand(os.Args[2:])
+			return
+		case "offline-dict":
+			offlineDict(os.Args[2:])
+			return
+		case "-":
+			lookup(config, os.Args[1:])
+			return
+		}
+	}
+	logs := newLogBroadcaster(500)
+	log.SetOutput(io.MultiWriter(os.Stderr, logs))
+	config, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatal("failed to load configuration: ", err)
+	}
+	if config.file != "" {
+		log.Print("config file: ", config.file)
+	}
+	templates := template.Must(template.ParseFiles(path.Join(config.TemplateDir, "main.tmpl"), path.Join(config.TemplateDir, plainTemplate)))
+	maintenanceTemplate := template.Must(template.ParseFiles(path.Join(config.TemplateDir, "maintenance.tmpl")))
+	browseTemplate := template.Must(template.ParseFiles(path.Join(config.TemplateDir, "browse.tmpl")))
+	historyTemplate := template.Must(template.ParseFiles(path.Join(config.TemplateDir, "history.tmpl")))
+	favoritesTemplate := template.Must(template.ParseFiles(path.Join(config.TemplateDir, "favorites.tmpl")))
+	watchlistTemplate := template.Must(template.ParseFiles(path.Join(config.TemplateDir, "watchlist.tmpl")))
+	kioskTemplate := template.Must(template.ParseFiles(path.Join(config.TemplateDir, "kiosk.tmpl")))
+	myDataTemplate := template.Must(template.ParseFiles(path.Join(config.TemplateDir, "mydata.tmpl")))
+	maintenance := &maintenanceMode{}
+	cacheDir := config.initCacheDir()
+	upstream := config.newUpstream()
+	cache := openCache(cacheDir)
+	cache.setMemoryLimit(cacheMemory(config.MemoryLimit))
+	cache.setSnapshots(config.Snapshots)
+	warmCache(cache, config.CacheWarm)
+	headwords := newHeadwords(cache)
+	provider := config.newProvider(newDictionaryAPI(upstream, cache))
+	log.Print("provider: ", provider.Name())
+	shadow := initShadow()
+	links, err := initLinkTemplates()
+	if err != nil {
+		log.Fatal("failed to load link templates: ", err)
+	}
+	ngram := initNgram()
+	datamuse := initDatamuse(cacheDir)
+	dataDir := initDataDir()
+	noResults := newNoResultsLog(dataDir)
+	sessionKey := initSessionKey(dataDir)
+	favorites := loadFavorites(dataDir)
+	watchlists := loadWatchlists(dataDir, sessionKey)
+	analytics := loadAnalytics(dataDir)
+	coSearches := loadCoSearches(dataDir)
+	rec := &recorder{analytics: analytics, coSearches: coSearches, noResults: noResults, shadow: shadow}
+	changes := newChangeLog(dataDir, favorites, watchlists)
+	upstream.OnChange = changes.record
+	wotd := newWOTD(provider, watchlists)
+	go wotd.prefetch()
+	home := newHomepage(config.Homepage, wotd, analytics, sessionKey, dataDir)
+	go logChecks(config, cacheDir, dataDir, upstream)
+	// The routes changing data and the admin pages are registered by handleWrite. With an
+	// admin listener, they are only served on it, and the public listener is read-only; the
+	// admin listener serves the read routes too.
+	writes := http.DefaultServeMux
+	readOnly := config.AdminListen != ""
+	if readOnly {
+		writes = http.NewServeMux()
+		writes.Handle("/", http.DefaultServeMux)
+	}
+	handleWrite := func(pattern string, handler func(_ http.ResponseWriter, _ *http.Request)) {
+		writes.HandleFunc(pattern, handler)
+		if readOnly {
+			if isAPIPath(pattern) {
+				http.HandleFunc(pattern, handleAPINotFound)
+			} else {
+				http.HandleFunc(pattern, http.NotFound)
+			}
+		}
+	}
+	search := func(readOnly bool) func(_ http.ResponseWriter, _ *http.Request) {
+		if readOnly {
+			// The read-only listener shows no buttons to star and watch words.
+			return handleWithRateLimit(config.RateLimit, handleSearch(templates, provider, shadow, links, sessionKey, nil, nil, coSearches, datamuse))
+		}
+		return handleWithRateLimit(config.RateLimit, handleSearch(templates, provider, shadow, links, sessionKey, favorites, watchlists, coSearches, datamuse))
+	}
+	http.HandleFunc("/search", search(readOnly))
+	http.HandleFunc(wordPrefix, search(readOnly))
+	if readOnly {
+		writes.HandleFunc("/search", search(false))
+		writes.HandleFunc(wordPrefix, search(false))
+	}
+	http.HandleFunc("/", handleWithRateLimit(config.RateLimit, handleRoot(templates, home, handleTerminal(provider))))
+	http.HandleFunc("/static/", handleWithRateLimit(config.RateLimit, handleStatic))
+	http.HandleFunc(browsePrefix, handleWithRateLimit(config.RateLimit, handleBrowse(browseTemplate, headwords)))
+	http.HandleFunc(historyPath, handleWithRateLimit(config.RateLimit, handleHistory(historyTemplate, sessionKey)))
+	http.HandleFunc(thesaurusPath, handleWithRateLimit(config.RateLimit, handleThesaurus(templates, provider)))
+	http.HandleFunc(wotdPath, handleWithRateLimit(config.RateLimit, handleWOTD(templates, wotd)))
+	kiosk := newKiosk(home, provider)
+	http.HandleFunc(kioskPath, handleWithRateLimit(config.RateLimit, handleKiosk(kioskTemplate, kiosk)))
+	http.HandleFunc(kioskEventsPath, handleWithRateLimit(config.RateLimit, handleKioskEvents(kiosk)))
+	handleWrite(favoritesPath, handleWithRateLimit(config.RateLimit, handleFavorites(favoritesTemplate, favorites)))
+	handleWrite(watchlistPath, handleWithRateLimit(config.RateLimit, handleWatchlist(watchlistTemplate, watchlists)))
+	handleWrite(myDataPath, handleWithRateLimit(config.RateLimit, handleMyData(myDataTemplate, sessionKey, watchlists)))
+	http.HandleFunc(exportPath, handleWithRateLimit(config.RateLimit, handleExport(provider, cache, favorites)))
+	handleAPI(definePrefix, handleWithRateLimit(config.RateLimit, handleDefine(provider)))
+	http.HandleFunc(audioPrefix, handleWithRateLimit(config.RateLimit, handleAudio(provider, cacheDir)))
+	handleAPI("/api/index", handleWithRateLimit(config.RateLimit, handleIndex(headwords)))
+	// Suggestions are requested as the user types, so they are allowed at a higher rate.
+	typing := rateLimit{Rate: 10 * config.RateLimit.Rate, Burst: 4 * config.RateLimit.Burst}
+	handleAPI(suggestPath, handleWithRateLimit(typing, handleSuggest(newSuggester(cache, dataDir, indexMemory(config.MemoryLimit)))))
+	handleAPI(ngramPrefix, handleWithRateLimit(config.RateLimit, handleNgram(cacheDir, ngram)))
+	handleAPI(relatedPath, handleWithRateLimit(config.RateLimit, handleRelated(datamuse)))
+	http.HandleFunc(proxyPrefix, handleWithRateLimit(config.RateLimit, handleProxy(cache, upstream)))
+	http.HandleFunc(metricsPath, handleMetrics)
+	jobs := newJobTracker()
+	handleAPI("/api/schema", handleWithRateLimit(config.RateLimit, handleSchema))
+	handleAPI(schemaPrefix, handleWithRateLimit(config.RateLimit, handleSchema))
+	handleAPI(jobsPrefix, handleWithRateLimit(config.RateLimit, handleJob(jobsPrefix, jobs)))
+	http.HandleFunc("/api/", handleAPINotFound)
+	http.HandleFunc("/admin/", handleAPINotFound)
+	// Admin pages are only available if an admin token is configured.
+	if token := os.Getenv("GODICT_ADMIN_TOKEN"); token != "" {
+		handleWrite("/admin/logs", handleAdmin(token, handleAdminLogs(logs)))
+		handleWrite("/admin/maintenance", handleAdmin(token, handleAdminMaintenance(maintenance)))
+		handleWrite("/admin/config", handleAdmin(token, handleAdminConfig(config)))
+		handleWrite(adminJobsPrefix, handleAdmin(token, handleAdminJobs(jobs)))
+		handleWrite("/admin/changes", handleAdmin(token, handleAdminChanges(changes)))
+		handleWrite("/admin/analytics", handleAdmin(token, handleAdminAnalytics(analytics)))
+		handleWrite("/admin/bulk/", handleAdmin(token, handleAdminBulk(jobs, cache, upstream, provider, dataDir)))
+	}
+	log.Printf("rate limit: %g/s (burst %d)", config.RateLimit.Rate, config.RateLimit.Burst)
+	log.Printf("memory limit: %s (%s for cache entries)", config.MemoryLimit, byteSize(cacheMemory(config.MemoryLimit)))
+	if config.AnonymizeIPs != "" {
+		log.Print("client addresses anonymized: ", config.AnonymizeIPs)
+	}
+	log.Print("listening on ", config.Listen)
+	newServer := func(mux http.Handler) *http.Server {
+		return &http.Server{
+			Handler:           withMetrics(withRequestID(withAnonymizedAddr(config.AnonymizeIPs, anonymizationKey(sessionKey), withPrivacy(rec, withMaintenance(maintenance, maintenanceTemplate, withRouteLimits(mux)))))),
+			ReadTimeout:       config.ReadTimeout,
+			ReadHeaderTimeout: config.ReadTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+		}
+	}
+	server := newServer(http.DefaultServeMux)
+	ln, err := listen(config.Listen, listenFDEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	servers := []*http.Server{server}
+	listeners := map[string]net.Listener{listenFDEnv: ln}
+	if config.AdminListen != "" {
+		adminServer := newServer(writes)
+		adminLn, err := listen(config.AdminListen, adminListenFDEnv)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Print("serving the routes changing data and the admin pages on ", config.AdminListen)
+		if host, _, err := net.SplitHostPort(config.AdminListen); err == nil && (host == "" || net.ParseIP(host).IsUnspecified()) {
+			log.Print("warning: the admin listener is reachable on all interfaces")
+		}
+		servers = append(servers, adminServer)
+		listeners[adminListenFDEnv] = adminLn
+		go func() {
+			if err := adminServer.Serve(adminLn); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+	if config.JSONLogs {
+		if err := writeStartupBanner(os.Stdout, ln.Addr().String(), cacheDir, cache, provider, shadow); err != nil {
+			log.Print("failed to write startup banner: ", err)
+		}
+	}
+	upgraded := upgradeOnSignal(servers, listeners, config.WriteTimeout)
+	stopped := shutdownOnSignal(servers, config.WriteTimeout)
+	notifyReady()
+	if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	select {
+	case <-upgraded:
+	case <-stopped:
+	}
+	flushCache(upstream, cache, config.UpstreamTimeout)
+	analytics.close()
+	coSearches.flush()
+	log.Print("bye")
 }
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultDictPort is the port of the DICT protocol.
+const defaultDictPort = "2628"
+
+// dictProtocol is the Provider for dictionary servers speaking the DICT protocol of
+// RFC 2229, like dict.org. It is an alternative to dictionaryapi.dev, or a fallback for
+// when it is down, see fallbackProvider. DICT servers return plain text, which is turned
+// into entries by dictProtocol.words; they only have English definitions, and no snapshots.
+type dictProtocol struct {
+	// server is the address of the server, and database the database to look words up in,
+	// e.g. "wn" for WordNet, or "*" for all of them.
+	server   string
+	database string
+	timeout  time.Duration
+}
+
+// newDictProtocol returns the Provider for the DICT server at address server, with the
+// default port if it has none, looking words up in database.
+func newDictProtocol(server, database string, timeout time.Duration) *dictProtocol {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, defaultDictPort)
+	}
+	return &dictProtocol{server: server, database: database, timeout: timeout}
+}
+
+func (d *dictProtocol) Name() string {
+	return "dict://" + d.server + "/" + d.database
+}
+
+func (d *dictProtocol) Lookup(ctx context.Context, word string) ([]Word, error) {
+	start := time.Now()
+	words, err := d.lookup(ctx, word)
+	lookupDuration.since(start)
+	lookupsTotal.inc(lookupResult(err))
+	return words, err
+}
+
+func (d *dictProtocol) lookup(ctx context.Context, word string) ([]Word, error) {
+	if _, ok := asOfFrom(ctx); ok {
+		return nil, &ProviderError{Status: http.StatusNotFound, Response: ErrorResponse{
+			Title:   "No Snapshot Found",
+			Message: "There are no snapshots of the dictionary server.",
+		}}
+	}
+	if languageFrom(ctx) != defaultLanguage {
+		return nil, &ProviderError{Status: http.StatusNotFound, Response: ErrorResponse{
+			Title:   "No Definitions Found",
+			Message: "The dictionary server only has English definitions.",
+		}}
+	}
+	word = normalizeWord(word)
+	defs, err := d.define(ctx, word)
+	if err != nil {
+		return nil, err
+	}
+	if len(defs) == 0 {
+		return nil, &ProviderError{Status: http.StatusNotFound, Response: ErrorResponse{
+			Title:   "No Definitions Found",
+			Message: "The dictionary server has no definitions for the word.",
+		}}
+	}
+	return d.words(defs), nil
+}
+
+// dictDefinition is a definition returned by a DICT server.
+type dictDefinition struct {
+	Word     string
+	Database string
+	Text     string
+}
+
+// define sends a DEFINE command for word to the server and returns the definitions. If
+// the word is not found, none are returned.
+func (d *dictProtocol) define(ctx context.Context, word string) ([]dictDefinition, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", d.server)
+	if err != nil {
+		return nil, err
+	}
+	// The connection is closed when ctx is done, which makes reads and writes fail.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	c := textproto.NewConn(conn)
+	defer c.Close()
+	if _, _, err := c.ReadCodeLine(220); err != nil {
+		return nil, dictError(ctx, err)
+	}
+	if err := c.PrintfLine("CLIENT godict"); err != nil {
+		return nil, dictError(ctx, err)
+	}
+	if _, _, err := c.ReadCodeLine(250); err != nil {
+		return nil, dictError(ctx, err)
+	}
+	if err := c.PrintfLine("DEFINE %s %s", d.database, dictQuote(word)); err != nil {
+		return nil, dictError(ctx, err)
+	}
+	code, msg, err := c.ReadCodeLine(150)
+	if code == 552 {
+		// No match.
+		c.PrintfLine("QUIT")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, dictError(ctx, err)
+	}
+	var defs []dictDefinition
+	for {
+		code, msg, err = c.ReadCodeLine(0)
+		if err != nil {
+			return nil, dictError(ctx, err)
+		}
+		if code == 250 {
+			break
+		}
+		if code != 151 {
+			return nil, fmt.Errorf("unexpected DICT response: %d %s", code, msg)
+		}
+		def := parseDictHeader(msg)
+		lines, err := c.ReadDotLines()
+		if err != nil {
+			return nil, dictError(ctx, err)
+		}
+		def.Text = strings.Join(lines, "\n")
+		defs = append(defs, def)
+	}
+	c.PrintfLine("QUIT")
+	return defs, nil
+}
+
+// dictError returns the error of a DICT request, err, or the error of ctx if the request
+// was given up on.
+func dictError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return fmt.Errorf("DICT error: %d %s", protoErr.Code, protoErr.Msg)
+	}
+	return err
+}
+
+// dictQuote quotes s as a string argument of a DICT command.
+func dictQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// parseDictHeader parses the text of a 151 response, which starts a definition:
+// `"word" database "description"`.
+func parseDictHeader(msg string) dictDefinition {
+	var def dictDefinition
+	if strings.HasPrefix(msg, `"`) {
+		if i := strings.Index(msg[1:], `"`); i >= 0 {
+			def.Word, msg = msg[1:i+1], msg[i+2:]
+		}
+	}
+	if fields := strings.Fields(msg); len(fields) > 0 {
+		def.Database = fields[0]
+	}
+	return def
+}
+
+// words returns the entries of the definitions defs, one for each.
+func (d *dictProtocol) words(defs []dictDefinition) []Word {
+	var words []Word
+	for _, def := range defs {
+		w := Word{
+			Word:       def.Word,
+			Phonetics:  []Phonetic{},
+			SourceURLs: []string{"dict://" + d.server + "/d:" + def.Word + ":" + def.Database},
+		}
+		if def.Database == "wn" {
+			w.Meanings = wordNetMeanings(def.Text)
+		}
+		if len(w.Meanings) == 0 {
+			w.Meanings = []Meaning{plainMeaning(def.Text)}
+		}
+		words = append(words, w)
+	}
+	return words
+}
+
+// plainMeaning returns the free-form text of a definition as a meaning with one definition
+// per paragraph.
+func plainMeaning(text string) Meaning {
+	m := Meaning{Synonyms: []string{}, Antonyms: []string{}}
+	for _, p := range strings.Split(text, "\n\n") {
+		if p = strings.Join(strings.Fields(p), " "); p != "" {
+			m.Definitions = append(m.Definitions, Definition{Definition: p, Synonyms: []string{}, Antonyms: []string{}})
+		}
+	}
+	return m
+}
+
+var (
+	// wordNetSense matches the start of a sense in a WordNet definition, with the part of
+	// speech if it is the first one of that part of speech, e.g. "n 1:", "2:", or "adj :".
+	wordNetSense = regexp.MustCompile(`(?:^|\s)(?:(n|v|adj|adv)\s+(\d+)?|(\d+)):\s`)
+	// wordNetRelation matches the synonyms or antonyms of a sense, e.g. "[syn: {hi}, {hullo}]".
+	wordNetRelation = regexp.MustCompile(`\[(syn|ant):([^\]]*)\]`)
+	wordNetRef      = regexp.MustCompile(`\{([^}]*)\}`)
+	wordNetExample  = regexp.MustCompile(`"([^"]*)"`)
+)
+
+// wordNetParts are the parts of speech of WordNet, by their abbreviations.
+var wordNetParts = map[string]string{"n": "noun", "v": "verb", "adj": "adjective", "adv": "adverb"}
+
+// wordNetMeanings parses the text of a definition from the WordNet database, e.g.
+//
+//	hello
+//	    n 1: an expression of greeting; "every morning they exchanged
+//	         polite hellos" [syn: {hello}, {hullo}, {hi}]
+//
+// into meanings, one for each part of speech.
+func wordNetMeanings(text string) []Meaning {
+	// The first line is the word itself. Lines are joined; words broken at a hyphen
+	// are not separated.
+	_, body, _ := strings.Cut(text, "\n")
+	var b strings.Builder
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "-") {
+			b.WriteByte(' ')
+		}
+		b.WriteString(line)
+	}
+	body = b.String()
+	var meanings []Meaning
+	matches := wordNetSense.FindAllStringSubmatchIndex(body, -1)
+	for i, m := range matches {
+		end := len(body)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		if m[2] >= 0 {
+			meanings = append(meanings, Meaning{PartOfSpeech: wordNetParts[body[m[2]:m[3]]], Synonyms: []string{}, Antonyms: []string{}})
+		}
+		if len(meanings) == 0 {
+			continue
+		}
+		meaning := &meanings[len(meanings)-1]
+		meaning.Definitions = append(meaning.Definitions, wordNetDefinition(body[m[1]:end]))
+	}
+	return meanings
+}
+
+// wordNetDefinition parses the text of a WordNet sense.
+func wordNetDefinition(text string) Definition {
+	d := Definition{Synonyms: []string{}, Antonyms: []string{}}
+	for _, r := range wordNetRelation.FindAllStringSubmatch(text, -1) {
+		var refs []string
+		for _, ref := range wordNetRef.FindAllStringSubmatch(r[2], -1) {
+			refs = append(refs, ref[1])
+		}
+		if r[1] == "syn" {
+			d.Synonyms = append(d.Synonyms, refs...)
+		} else {
+			d.Antonyms = append(d.Antonyms, refs...)
+		}
+	}
+	text = wordNetRelation.ReplaceAllString(text, "")
+	if m := wordNetExample.FindStringSubmatch(text); m != nil {
+		d.Example = m[1]
+	}
+	// The examples follow the definition, separated by semicolons.
+	definition, _, _ := strings.Cut(text, `; "`)
+	d.Definition = strings.TrimSpace(wordNetRef.ReplaceAllString(definition, "$1"))
+	return d
+}
+
+// fallbackProvider looks words up with the first of its providers, and with the next ones
+// if it cannot: if the dictionary cannot be reached, fails, or limits the rate of requests.
+// Answers of the dictionary, like a word not being found, are returned as they are.
+type fallbackProvider []Provider
+
+func (p fallbackProvider) Name() string {
+	names := make([]string, len(p))
+	for i, provider := range p {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+func (p fallbackProvider) Lookup(ctx context.Context, word string) ([]Word, error) {
+	var words []Word
+	var err error
+	for i, provider := range p {
+		words, err = provider.Lookup(ctx, word)
+		var providerErr *ProviderError
+		if err == nil || ctx.Err() != nil || errors.As(err, &providerErr) && providerErr.Status != http.StatusTooManyRequests && providerErr.Status/100 != 5 {
+			return words, err
+		}
+		if i+1 < len(p) {
+			logSearch(ctx, "failed to look up %s with %s, trying %s: %s", word, provider.Name(), p[i+1].Name(), err)
+		}
+	}
+	return words, err
+}
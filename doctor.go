@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Statuses of a self-test check.
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "FAIL"
+)
+
+// checkResult is the outcome of a single self-test check.
+type checkResult struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// checkTemplates checks that all templates in the template dir dir parse.
+func checkTemplates(dir string) checkResult {
+	r := checkResult{Name: "templates"}
+	tmpl, err := template.ParseGlob(path.Join(dir, "*.tmpl"))
+	if err != nil {
+		r.Status, r.Detail = checkFail, err.Error()
+		return r
+	}
+	r.Status, r.Detail = checkOK, fmt.Sprintf("%d templates in %s parsed", len(tmpl.Templates()), dir)
+	return r
+}
+
+// checkStatic checks that the static files served by handleStatic are readable.
+func checkStatic() checkResult {
+	r := checkResult{Name: "static files"}
+	wd, err := os.Getwd()
+	if err != nil {
+		r.Status, r.Detail = checkFail, err.Error()
+		return r
+	}
+	for _, f := range staticFiles {
+		if _, err := os.ReadFile(path.Join(wd, f)); err != nil {
+			r.Status, r.Detail = checkFail, err.Error()
+			return r
+		}
+	}
+	r.Status, r.Detail = checkOK, fmt.Sprintf("%d files in %s readable", len(staticFiles), path.Join(wd, "static"))
+	return r
+}
+
+// checkWritable checks that dir, the directory used for what, is writable.
+// An empty dir means that the directory could not be initialized.
+func checkWritable(what, dir string) checkResult {
+	r := checkResult{Name: what}
+	if dir == "" {
+		r.Status, r.Detail = checkFail, "not available; features using it are disabled"
+		return r
+	}
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		r.Status, r.Detail = checkFail, err.Error()
+		return r
+	}
+	f.Close()
+	os.Remove(f.Name())
+	r.Status, r.Detail = checkOK, dir+" is writable"
+	return r
+}
+
+// checkUpstream checks that the upstream is reachable and, using the Date header of its
+// response, that the local clock is not off.
+func checkUpstream(upstream *Upstream) []checkResult {
+	reach := checkResult{Name: "upstream"}
+	clock := checkResult{Name: "clock"}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream.entryURL("hello", "en"), nil)
+	if err != nil {
+		reach.Status, reach.Detail = checkFail, err.Error()
+		return []checkResult{reach}
+	}
+	start := time.Now()
+	resp, err := upstream.client.Do(req)
+	if err != nil {
+		reach.Status, reach.Detail = checkFail, err.Error()
+		return []checkResult{reach}
+	}
+	resp.Body.Close()
+	latency := time.Since(start)
+	reach.Status = checkOK
+	if resp.StatusCode/100 != 2 {
+		reach.Status = checkWarn
+	}
+	reach.Detail = fmt.Sprintf("%s answered %s in %s", upstream.BaseURL, resp.Status, latency.Round(time.Millisecond))
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		clock.Status, clock.Detail = checkWarn, "cannot compare, upstream sent no valid Date header"
+		return []checkResult{reach, clock}
+	}
+	skew := start.Sub(date).Round(time.Second)
+	if skew < 0 {
+		skew = -skew
+	}
+	clock.Status, clock.Detail = checkOK, fmt.Sprintf("off by %s from upstream", skew)
+	if skew > time.Minute+latency {
+		clock.Status = checkWarn
+	}
+	return []checkResult{reach, clock}
+}
+
+// checkProvider checks that the dictionary provider p answers, by looking up a word.
+// Errors of the dictionary, like words not being found, count as answers.
+func checkProvider(p Provider) checkResult {
+	r := checkResult{Name: "provider"}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := p.Lookup(withLanguage(ctx, defaultLanguage), "hello")
+	var providerErr *ProviderError
+	if err != nil && !errors.As(err, &providerErr) {
+		r.Status, r.Detail = checkFail, fmt.Sprintf("%s: %s", p.Name(), err)
+		return r
+	}
+	r.Status, r.Detail = checkOK, fmt.Sprintf("%s answered in %s", p.Name(), time.Since(start).Round(time.Millisecond))
+	return r
+}
+
+// checkProviders checks the providers selected by config.Provider, see
+// AppConfig.newProvider: the dictionary API with checkUpstream, and the others with
+// checkProvider.
+func checkProviders(config AppConfig, upstream *Upstream) []checkResult {
+	if config.Offline {
+		return []checkResult{{Name: "provider", Status: checkWarn, Detail: "offline; the providers are not checked"}}
+	}
+	var results []checkResult
+	for _, name := range strings.Split(config.Provider, ",") {
+		switch name {
+		case "dictionaryapi":
+			results = append(results, checkUpstream(upstream)...)
+		case "dict":
+			results = append(results, checkProvider(newDictProtocol(config.DictServer, config.DictDatabase, config.UpstreamTimeout)))
+		case "wiktionary":
+			results = append(results, checkProvider(newWiktionary(config.WiktionaryURL, config.UpstreamTimeout)))
+		default:
+			results = append(results, checkResult{Name: "provider", Status: checkFail, Detail: fmt.Sprintf("unknown provider %q", name)})
+		}
+	}
+	return results
+}
+
+// runChecks runs all self-test checks of the instance configured by config.
+func runChecks(config AppConfig, cacheDir, dataDir string, upstream *Upstream) []checkResult {
+	results := []checkResult{
+		checkTemplates(config.TemplateDir),
+		checkStatic(),
+		checkWritable("cache dir", cacheDir),
+		checkWritable("data dir", dataDir),
+	}
+	return append(results, checkProviders(config, upstream)...)
+}
+
+// logChecks runs all self-test checks and logs the results.
+// It is run on server startup, as most problems are caused by the environment.
+func logChecks(config AppConfig, cacheDir, dataDir string, upstream *Upstream) {
+	for _, r := range runChecks(config, cacheDir, dataDir, upstream) {
+		log.Printf("self-test: %s %s: %s", r.Status, r.Name, r.Detail)
+	}
+}
+
+// doctor implements the "doctor" subcommand.
+// It runs all self-test checks, prints a report and exits with a non-zero status if any
+// of the checks failed.
+func doctor(config AppConfig, args []string) {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s doctor\n", path.Base(os.Args[0]))
+		os.Exit(2)
+	}
+	cacheDir := config.initCacheDir()
+	dataDir := initDataDir()
+	upstream := config.newUpstream()
+	failed := false
+	for _, r := range runChecks(config, cacheDir, dataDir, upstream) {
+		fmt.Printf("%-4s  %-12s  %s\n", r.Status, r.Name, r.Detail)
+		failed = failed || r.Status == checkFail
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
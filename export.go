@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// exportPath is the path of the flashcard export.
+const exportPath = "/export"
+
+// Formats of the flashcard export.
+const (
+	// exportAnki is a tab-separated text file with HTML fields and the header lines
+	// understood by the text import of Anki.
+	exportAnki = "anki"
+	// exportCSV is a CSV file with plain text fields.
+	exportCSV = "csv"
+)
+
+// Sources of the words exported.
+const (
+	exportFavorites = "favorites"
+	exportCache     = "cache"
+)
+
+// flashcard is a word with its definitions and examples.
+type flashcard struct {
+	Word  string
+	Lang  string
+	Words []Word
+}
+
+// front returns the front side of the card.
+func (c flashcard) front() string {
+	return c.Word
+}
+
+// backHTML returns the back side of the card in HTML: the meanings with their definitions
+// and examples.
+func (c flashcard) backHTML() string {
+	var b strings.Builder
+	for _, w := range c.Words {
+		for _, m := range w.Meanings {
+			fmt.Fprintf(&b, "<i>%s</i><ol>", html.EscapeString(m.PartOfSpeech))
+			for _, d := range m.Definitions {
+				fmt.Fprintf(&b, "<li>%s", html.EscapeString(d.Definition))
+				if d.Example != "" {
+					fmt.Fprintf(&b, "<br><small>%s</small>", html.EscapeString(d.Example))
+				}
+				b.WriteString("</li>")
+			}
+			b.WriteString("</ol>")
+		}
+	}
+	return b.String()
+}
+
+// backText returns the back side of the card in plain text, one definition per line.
+func (c flashcard) backText() string {
+	var lines []string
+	for _, w := range c.Words {
+		for _, m := range w.Meanings {
+			for _, d := range m.Definitions {
+				line := m.PartOfSpeech + ": " + d.Definition
+				if d.Example != "" {
+					line += " (" + d.Example + ")"
+				}
+				lines = append(lines, line)
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ankiField returns s as a field of a tab-separated line.
+func ankiField(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
+
+// writeAnki writes cards in the exportAnki format.
+func writeAnki(w io.Writer, cards []flashcard) error {
+	if _, err := io.WriteString(w, "#separator:tab\n#html:true\n#notetype:Basic\n#deck:Godict\n#tags column:3\n"); err != nil {
+		return err
+	}
+	for _, c := range cards {
+		if _, err := fmt.Fprintf(w, "%s\t%s\tgodict godict::%s\n", ankiField(html.EscapeString(c.front())), ankiField(c.backHTML()), c.Lang); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSV writes cards in the exportCSV format.
+func writeCSV(w io.Writer, cards []flashcard) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"word", "language", "definitions"})
+	for _, c := range cards {
+		cw.Write([]string{c.front(), c.Lang, c.backText()})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// exportCards returns the flashcards of keys, looking the words up with provider. Words
+// that are not found or have no definitions are left out.
+func exportCards(ctx context.Context, provider Provider, keys []cacheKey) []flashcard {
+	var cards []flashcard
+	for _, k := range keys {
+		words, err := provider.Lookup(withLanguage(ctx, k.Lang), k.Word)
+		if err != nil {
+			log.Printf("failed to export %s (%s): %s", k.Word, k.Lang, err)
+			continue
+		}
+		card := flashcard{Word: k.Word, Lang: k.Lang, Words: words}
+		if card.backText() != "" {
+			cards = append(cards, card)
+		}
+	}
+	return cards
+}
+
+// handleExport handles requests to the flashcard export, which turns the starred or the
+// cached words into a deck of flashcards, the word on the front and its definitions and
+// examples on the back. The "format" query argument selects exportAnki or exportCSV, the
+// default, and the "source" query argument exportFavorites, the default if favorites are
+// enabled, or exportCache. The "lang" query argument limits the words to a language.
+func handleExport(provider Provider, cache *entryCache, favorites *favorites) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		defaultSource := exportCache
+		if favorites != nil {
+			defaultSource = exportFavorites
+		}
+		p := requestParams(req)
+		format := p.oneOf("format", exportCSV, exportAnki, exportCSV)
+		source := p.oneOf("source", defaultSource, exportFavorites, exportCache)
+		lang := p.language("lang", "")
+		if !p.check(w) {
+			return
+		}
+		var keys []cacheKey
+		switch source {
+		case exportFavorites:
+			if favorites == nil {
+				writeError(w, req, http.StatusNotFound, "Favorites are not available.", nil)
+				return
+			}
+			for _, f := range favorites.list() {
+				if lang == "" || f.Lang == lang {
+					keys = append(keys, cacheKey{Word: f.Word, Lang: f.Lang})
+				}
+			}
+		case exportCache:
+			var err error
+			keys, err = cache.keys(`? = '' OR lang = ?`, lang, lang)
+			if err != nil {
+				log.Print("failed to read cached words: ", err)
+				writeError(w, req, http.StatusInternalServerError, "Failed to read the cache.", nil)
+				return
+			}
+		}
+		log.Printf("exporting %d %s words as %s", len(keys), source, format)
+		cards := exportCards(req.Context(), provider, keys)
+		var err error
+		if format == exportAnki {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="godict-`+source+`.txt"`)
+			err = writeAnki(w, cards)
+		} else {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="godict-`+source+`.csv"`)
+			err = writeCSV(w, cards)
+		}
+		if err != nil {
+			log.Print("failed to write export: ", err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// favoritesPath is the path of the favorites page. Starring and unstarring a word is done
+// by a POST request to it.
+const favoritesPath = "/favorites"
+
+// favoritesFile is the name of the file holding the favorites in the data directory.
+const favoritesFile = "favorites.json"
+
+// unstarUndoWindow is how long unstarring a word can be undone.
+const unstarUndoWindow = 24 * time.Hour
+
+// favorite is a starred word.
+type favorite struct {
+	Word  string    `json:"word"`
+	Lang  string    `json:"lang"`
+	Added time.Time `json:"added"`
+	// Removed is when the word was unstarred, if it was. Unstarred words are kept for
+	// unstarUndoWindow, so that starring them again restores them, and then removed for
+	// good.
+	Removed *time.Time `json:"removed,omitempty"`
+}
+
+// favoritesDay are the favorites added on one day, for the favorites page.
+type favoritesDay struct {
+	Date  time.Time
+	Words []favorite
+}
+
+// FavoritesContext is the data of the favorites page.
+type FavoritesContext struct {
+	// Days are the days favorites were added on, most recent first.
+	Days []favoritesDay
+	// Removed are the words unstarred less than unstarUndoWindow ago, most recently
+	// unstarred first.
+	Removed []favorite
+}
+
+// favorites are the starred words of this instance. They are stored as a JSON file, which
+// is rewritten on every change. A nil *favorites stores nothing.
+type favorites struct {
+	mu    sync.Mutex
+	path  string
+	words []favorite
+}
+
+// loadFavorites returns the favorites stored in dataDir.
+// If dataDir is empty, nil is returned and favorites are disabled.
+func loadFavorites(dataDir string) *favorites {
+	if dataDir == "" {
+		return nil
+	}
+	f := &favorites{path: path.Join(dataDir, favoritesFile)}
+	data, err := os.ReadFile(f.path)
+	if err == nil {
+		err = json.Unmarshal(data, &f.words)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Print("failed to read favorites: ", err)
+	}
+	// Unstarred words are removed for good once unstarring them can no longer be undone.
+	go func() {
+		for ; ; time.Sleep(time.Hour) {
+			if err := f.purgeRemoved(time.Now()); err != nil {
+				log.Print("failed to save favorites: ", err)
+			}
+		}
+	}()
+	return f
+}
+
+// has reports whether word in language lang is starred.
+func (f *favorites) has(word, lang string) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.index(word, lang)
+	return i >= 0 && f.words[i].Removed == nil
+}
+
+// index returns the index of word in language lang in f.words, or -1.
+func (f *favorites) index(word, lang string) int {
+	for i, w := range f.words {
+		if w.Word == word && w.Lang == lang {
+			return i
+		}
+	}
+	return -1
+}
+
+// set stars or, if starred is false, unstars word in language lang. Starring a word
+// unstarred less than unstarUndoWindow ago restores it, with the time it was first added.
+func (f *favorites) set(word, lang string, starred bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.index(word, lang)
+	switch {
+	case starred && i < 0:
+		f.words = append(f.words, favorite{Word: word, Lang: lang, Added: time.Now().UTC()})
+	case starred && f.words[i].Removed != nil:
+		f.words[i].Removed = nil
+	case !starred && i >= 0 && f.words[i].Removed == nil:
+		now := time.Now().UTC()
+		f.words[i].Removed = &now
+	default:
+		return nil
+	}
+	return f.save()
+}
+
+// purgeRemoved removes the words unstarred unstarUndoWindow or longer before now.
+func (f *favorites) purgeRemoved(now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	words := f.words[:0]
+	for _, w := range f.words {
+		if w.Removed == nil || now.Sub(*w.Removed) < unstarUndoWindow {
+			words = append(words, w)
+		}
+	}
+	if len(words) == len(f.words) {
+		return nil
+	}
+	f.words = words
+	return f.save()
+}
+
+// save writes the favorites to their file. The caller must hold f.mu.
+func (f *favorites) save() error {
+	data, err := json.MarshalIndent(f.words, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+// list returns the favorites in the order they were added in.
+func (f *favorites) list() []favorite {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var words []favorite
+	for _, w := range f.words {
+		if w.Removed == nil {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// removed returns the words unstarred less than unstarUndoWindow ago, most recently
+// unstarred first.
+func (f *favorites) removed() []favorite {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var words []favorite
+	for _, w := range f.words {
+		if w.Removed != nil && time.Since(*w.Removed) < unstarUndoWindow {
+			words = append(words, w)
+		}
+	}
+	sort.SliceStable(words, func(i, j int) bool { return words[i].Removed.After(*words[j].Removed) })
+	return words
+}
+
+// byDay returns the favorites grouped by the day they were added on in loc, most recent
+// first.
+func (f *favorites) byDay(loc *time.Location) []favoritesDay {
+	words := f.list()
+	sort.SliceStable(words, func(i, j int) bool { return words[i].Added.After(words[j].Added) })
+	var days []favoritesDay
+	for _, w := range words {
+		y, m, d := w.Added.In(loc).Date()
+		date := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		if len(days) == 0 || !days[len(days)-1].Date.Equal(date) {
+			days = append(days, favoritesDay{Date: date})
+		}
+		days[len(days)-1].Words = append(days[len(days)-1].Words, w)
+	}
+	return days
+}
+
+// wordURL returns the URL of the result page of word in language lang.
+func wordURL(word, lang string) string {
+	u := wordPrefix + url.PathEscape(word)
+	if lang != defaultLanguage {
+		u += "?lang=" + url.QueryEscape(lang)
+	}
+	return u
+}
+
+// handleFavorites handles requests to the favorites page, which lists the starred words
+// grouped by the day they were added on, and the words recently unstarred. A POST request
+// with the "word" and "lang" form values stars the word, or unstars it if "starred" is
+// "0", and redirects back to the result page of the word, or to the favorites page if
+// "undo" is "1".
+func handleFavorites(tmpl *template.Template, favorites *favorites) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if favorites == nil {
+			http.Error(w, "Oops", http.StatusNotFound)
+			return
+		}
+		if req.Method == http.MethodPost {
+			word := strings.TrimSpace(req.FormValue("word"))
+			if word == "" {
+				http.Error(w, "Oops", http.StatusBadRequest)
+				return
+			}
+			lang := requestLanguage(req)
+			if err := favorites.set(word, lang, req.FormValue("starred") != "0"); err != nil {
+				log.Print("failed to save favorites: ", err)
+				http.Error(w, "Oops", http.StatusInternalServerError)
+				return
+			}
+			if req.FormValue("undo") == "1" {
+				http.Redirect(w, req, favoritesPath, http.StatusSeeOther)
+				return
+			}
+			http.Redirect(w, req, wordURL(word, lang), http.StatusSeeOther)
+			return
+		}
+		if err := tmpl.Execute(w, FavoritesContext{Days: favorites.byDay(time.Local), Removed: favorites.removed()}); err != nil {
+			log.Print("failed to execute template: ", err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// historyPath is the path of the search history page.
+const historyPath = "/history"
+
+// historyCookie is the cookie holding the search history of a browser session, and
+// historySize the number of words it holds at most, which keeps it well below the size
+// limit of cookies.
+const (
+	historyCookie = "godict_history"
+	historySize   = 20
+)
+
+// sessionKeyFile is the file in the data dir holding the key signing session cookies.
+const sessionKeyFile = "session.key"
+
+// historyEntry is a word looked up in a browser session.
+type historyEntry struct {
+	Word string    `json:"w"`
+	Lang string    `json:"l"`
+	Time time.Time `json:"t"`
+}
+
+// HistoryContext is the data of the search history page.
+type HistoryContext struct {
+	// Entries are the words looked up, most recent first.
+	Entries []historyEntry
+}
+
+// initSessionKey returns the key signing session cookies: $GODICT_SESSION_KEY, or a random
+// key stored in dataDir, so that sessions survive restarts. Without a data dir, the key is
+// only valid until the server exits.
+func initSessionKey(dataDir string) []byte {
+	if key := os.Getenv("GODICT_SESSION_KEY"); key != "" {
+		return []byte(key)
+	}
+	name := path.Join(dataDir, sessionKeyFile)
+	if dataDir != "" {
+		if key, err := os.ReadFile(name); err == nil && len(key) > 0 {
+			return key
+		}
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal("failed to create session key: ", err)
+	}
+	if dataDir == "" {
+		log.Print("no data dir; session cookies are only valid until the server exits")
+	} else if err := os.WriteFile(name, key, 0600); err != nil {
+		log.Print("failed to store session key: ", err)
+	}
+	return key
+}
+
+// signValue returns value with its signature by key appended, for storing in a cookie.
+func signValue(key, value []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(value)
+	return base64.RawURLEncoding.EncodeToString(value) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyValue returns the value signed by signValue. The second return value is false if s
+// is malformed or was not signed by key.
+func verifyValue(key []byte, s string) ([]byte, bool) {
+	data, sig, ok := strings.Cut(s, ".")
+	if !ok {
+		return nil, false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return nil, false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(value)
+	return value, hmac.Equal(got, mac.Sum(nil))
+}
+
+// readHistory returns the search history in the cookie of req, most recent first.
+// Missing, invalid and tampered cookies yield an empty history.
+func readHistory(req *http.Request, key []byte) []historyEntry {
+	cookie, err := req.Cookie(historyCookie)
+	if err != nil {
+		return nil
+	}
+	value, ok := verifyValue(key, cookie.Value)
+	if !ok {
+		return nil
+	}
+	var entries []historyEntry
+	if err := json.Unmarshal(value, &entries); err != nil {
+		return nil
+	}
+	return entries
+}
+
+// writeHistory sets the cookie holding entries as the search history.
+func writeHistory(w http.ResponseWriter, key []byte, entries []historyEntry) {
+	setHistoryCookie(w, key, historyCookie, entries, 0)
+}
+
+// setHistoryCookie sets the cookie name to the search history entries, signed by key.
+// The cookie expires after maxAge, or with the browser session if it is zero.
+func setHistoryCookie(w http.ResponseWriter, key []byte, name string, entries []historyEntry, maxAge time.Duration) {
+	value, err := json.Marshal(entries)
+	if err != nil {
+		log.Print("failed to encode search history: ", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    signValue(key, value),
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// recordHistory adds word in language lang to the search history of the session of req.
+// A word already in the history is moved to the top. Searches are recorded through
+// recorder.history, which leaves out requests in privacy mode.
+func recordHistory(w http.ResponseWriter, req *http.Request, key []byte, word, lang string) {
+	entries := []historyEntry{{Word: word, Lang: lang, Time: time.Now().Truncate(time.Second)}}
+	for _, e := range readHistory(req, key) {
+		if len(entries) == historySize {
+			break
+		}
+		if e.Word != word || e.Lang != lang {
+			entries = append(entries, e)
+		}
+	}
+	writeHistory(w, key, entries)
+}
+
+// handleHistory handles requests to the search history page, which lists the words looked
+// up in the browser session. A POST request clears the history.
+func handleHistory(tmpl *template.Template, key []byte) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPost {
+			http.SetCookie(w, &http.Cookie{Name: historyCookie, Path: "/", MaxAge: -1})
+			http.Redirect(w, req, historyPath, http.StatusSeeOther)
+			return
+		}
+		w.Header().Set("Cache-Control", "private, no-store")
+		if err := tmpl.Execute(w, HistoryContext{Entries: readHistory(req, key)}); err != nil {
+			log.Print("failed to execute template: ", err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+// homepageBlockKinds are the kinds of blocks the homepage can be composed of:
+//
+//   - "notice", the custom HTML of homepageConfig.Notice
+//   - "wotd", the word of the day with its first definition
+//   - "trending", the words most searched in the last days, if analytics are enabled
+//   - "recent", the recent searches of the browser, see recordHistory
+//   - "random", a random word from the "random" word list, or from the words of the day
+var homepageBlockKinds = []string{"notice", "wotd", "trending", "recent", "random"}
+
+const (
+	// homepageWords is the number of words shown by the blocks listing words.
+	homepageWords = 10
+	// homepageTrendingDays is the number of days the trending words are counted over.
+	homepageTrendingDays = 7
+)
+
+// homepageConfig is the configuration of the homepage, the "homepage" table of the
+// configuration file.
+type homepageConfig struct {
+	// Blocks are the blocks shown, in order, $GODICT_HOMEPAGE; see homepageBlockKinds.
+	Blocks blockList `toml:"blocks"`
+	// Notice is the HTML of the "notice" block, $GODICT_HOMEPAGE_NOTICE. It is shown as it
+	// is, so it should only be set by whoever runs the instance.
+	Notice string `toml:"notice"`
+}
+
+// blockList is a list of homepage blocks, separated by commas in flags and environment
+// variables.
+type blockList []string
+
+func (l blockList) String() string {
+	return strings.Join(l, ",")
+}
+
+func (l *blockList) Set(s string) error {
+	*l = nil
+	for _, kind := range strings.Split(s, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			*l = append(*l, kind)
+		}
+	}
+	return nil
+}
+
+// validHomepageBlock reports whether kind is one of homepageBlockKinds.
+func validHomepageBlock(kind string) bool {
+	for _, k := range homepageBlockKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// HomepageBlock is a block of the homepage, for rendering.
+type HomepageBlock struct {
+	// Kind is one of homepageBlockKinds.
+	Kind string
+	// Words are the words shown, and Definition the first definition of the word of the
+	// day, if it could be looked up.
+	Words      []string
+	Definition string
+	// Notice is the HTML of a notice.
+	Notice template.HTML
+}
+
+// homepage composes the homepage from the configured blocks, so that e.g. an instance for
+// a classroom can show a notice and the word of the day, and a personal one the recent
+// searches. Blocks without anything to show are left out.
+type homepage struct {
+	config     homepageConfig
+	wotd       *wotd
+	analytics  *analytics
+	sessionKey []byte
+	// randomWords are the words of the "random" block.
+	randomWords []string
+}
+
+// newHomepage returns the homepage configured by config. The words of the "random" block
+// are read from the word list selected for "random" in dataDir, if any.
+func newHomepage(config homepageConfig, wotd *wotd, analytics *analytics, sessionKey []byte, dataDir string) *homepage {
+	h := &homepage{config: config, wotd: wotd, analytics: analytics, sessionKey: sessionKey, randomWords: wotdWords}
+	if dataDir == "" {
+		return h
+	}
+	words, ok, err := activeWordList(dataDir, "random")
+	if err != nil {
+		log.Print("failed to read the random word list: ", err)
+	} else if ok && len(words) > 0 {
+		h.randomWords = words
+	}
+	return h
+}
+
+// blocks returns the blocks of the homepage for req, which asks for language lang.
+func (h *homepage) blocks(req *http.Request, lang string) []HomepageBlock {
+	var blocks []HomepageBlock
+	for _, kind := range h.config.Blocks {
+		b := HomepageBlock{Kind: kind}
+		switch kind {
+		case "notice":
+			b.Notice = template.HTML(h.config.Notice)
+		case "wotd":
+			word, words, errResp, err := h.wotd.get()
+			if err != nil {
+				log.Print(err)
+			} else if errResp == nil && len(words) > 0 && len(words[0].Meanings) > 0 && len(words[0].Meanings[0].Definitions) > 0 {
+				b.Definition = words[0].Meanings[0].Definitions[0].Definition
+			}
+			b.Words = []string{word}
+		case "trending":
+			b.Words = h.analytics.trending(lang, homepageTrendingDays, homepageWords)
+		case "recent":
+			if isPrivate(req.Context()) {
+				continue
+			}
+			for _, e := range readHistory(req, h.sessionKey) {
+				if e.Lang == lang && len(b.Words) < homepageWords {
+					b.Words = append(b.Words, e.Word)
+				}
+			}
+		case "random":
+			b.Words = []string{h.randomWords[rand.Intn(len(h.randomWords))]}
+		}
+		if b.Notice != "" || len(b.Words) > 0 {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks
+}
+
+// handleRoot handles requests to "/", which shows the blocks of home. Requests wanting
+// plain text, see wantsText, are handled by terminal instead.
+func handleRoot(tmpl *template.Template, home *homepage, terminal func(_ http.ResponseWriter, _ *http.Request)) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if wantsText(req) {
+			terminal(w, req)
+			return
+		}
+		app := AppContext{
+			Template:  viewTemplate(tmpl, req),
+			Lang:      requestLanguage(req),
+			Languages: languages,
+			Private:   isPrivate(req.Context()),
+		}
+		app.Homepage = home.blocks(req, app.Lang)
+		renderTemplate(w, &app)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// headwords is the index of the English headwords of the cache and of the offline
+// dictionary, in alphabetical order ignoring case and diacritics, see foldWord. It is
+// built from the cache on first use and updated as entries are cached and removed, so
+// that listing words does not scan the cache. A nil *headwords indexes nothing.
+type headwords struct {
+	mu    sync.RWMutex
+	cache *entryCache
+	// root is nil until the index is built.
+	root *trieNode
+}
+
+// newHeadwords returns the index of the headwords of cache, which keeps it up to date.
+func newHeadwords(cache *entryCache) *headwords {
+	h := &headwords{cache: cache}
+	if cache != nil {
+		cache.headwords = h
+	}
+	return h
+}
+
+// build builds the index unless it is built already. Errors reading the cache are
+// logged.
+func (h *headwords) build() {
+	h.mu.RLock()
+	built := h.root != nil
+	h.mu.RUnlock()
+	if built {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.root != nil {
+		return
+	}
+	h.root = &trieNode{}
+	for word := range bundledDictionary().entries {
+		h.root.insert(foldWord(word), word)
+	}
+	words, err := h.cache.words(defaultLanguage, "")
+	if err != nil {
+		log.Print("failed to read cached words: ", err)
+	}
+	for _, word := range words {
+		h.root.insert(foldWord(word), word)
+	}
+}
+
+// add adds word in language lang, which was cached, if the index is built.
+func (h *headwords) add(word, lang string) {
+	if h == nil || lang != defaultLanguage {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.root != nil {
+		h.root.insert(foldWord(word), word)
+	}
+}
+
+// remove removes word in language lang, which was removed from the cache, if the index is
+// built. Words of the offline dictionary are kept.
+func (h *headwords) remove(word, lang string) {
+	if h == nil || lang != defaultLanguage {
+		return
+	}
+	if _, ok := bundledDictionary().entries[word]; ok {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.root != nil {
+		h.root.remove(foldWord(word), word)
+	}
+}
+
+// list returns up to limit words starting with prefix, ignoring case and diacritics, that
+// come after the word after, or from the first one if after is "". A negative limit
+// returns all of them.
+func (h *headwords) list(prefix, after string, limit int) []string {
+	words := []string{}
+	if h == nil {
+		return words
+	}
+	h.build()
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	c := trieCursor{prefix: foldWord(prefix), limit: limit}
+	if after != "" {
+		c.afterKey, c.after, c.seek = foldWord(after), after, true
+	}
+	c.walk(h.root, "", func(word string) { words = append(words, word) })
+	return words
+}
+
+// letters returns the distinct initial letters of the words, see initialLetter, in byte
+// order.
+func (h *headwords) letters() []string {
+	var letters []string
+	if h == nil {
+		return letters
+	}
+	h.build()
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, c := range h.root.children {
+		r, _ := utf8.DecodeRuneInString(c.label)
+		letters = append(letters, string(r))
+	}
+	return letters
+}
+
+// foldWord returns the key of word in the index: word in lower case and without
+// diacritics, so that for example "Äpfel" is listed among the words starting with "a".
+func foldWord(word string) string {
+	folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn))), word)
+	if err != nil {
+		folded = word
+	}
+	return strings.ToLower(folded)
+}
+
+// trieNode is a node of a radix trie of words, keyed by their folded form. The keys of the
+// words of a node are the labels of the nodes from the root to it.
+type trieNode struct {
+	label string
+	// children are sorted by label; their labels start with different runes.
+	children []*trieNode
+	// words are the words with the key of the node, sorted.
+	words []string
+}
+
+// insert adds word with key to the trie rooted at n.
+func (n *trieNode) insert(key, word string) {
+	for key != "" {
+		i := sort.Search(len(n.children), func(i int) bool { return n.children[i].label >= key })
+		// The child sharing the first rune of key is either at i or, if key sorts after
+		// its label, right before it.
+		if i > 0 && sharedPrefix(n.children[i-1].label, key) > 0 {
+			i--
+		}
+		if i == len(n.children) || sharedPrefix(n.children[i].label, key) == 0 {
+			n.children = append(n.children, nil)
+			copy(n.children[i+1:], n.children[i:])
+			n.children[i] = &trieNode{label: key}
+			n = n.children[i]
+			break
+		}
+		c := n.children[i]
+		shared := sharedPrefix(c.label, key)
+		if shared < len(c.label) {
+			split := &trieNode{label: c.label[:shared], children: []*trieNode{c}}
+			c.label = c.label[shared:]
+			n.children[i] = split
+			c = split
+		}
+		n, key = c, key[shared:]
+	}
+	i := sort.SearchStrings(n.words, word)
+	if i < len(n.words) && n.words[i] == word {
+		return
+	}
+	n.words = append(n.words, "")
+	copy(n.words[i+1:], n.words[i:])
+	n.words[i] = word
+}
+
+// remove removes word with key from the trie rooted at n, along with the nodes left
+// without words. It reports whether n is left without words.
+func (n *trieNode) remove(key, word string) bool {
+	if key == "" {
+		if i := sort.SearchStrings(n.words, word); i < len(n.words) && n.words[i] == word {
+			n.words = append(n.words[:i], n.words[i+1:]...)
+		}
+	} else {
+		i := sort.Search(len(n.children), func(i int) bool { return n.children[i].label >= key })
+		if i > 0 && strings.HasPrefix(key, n.children[i-1].label) {
+			i--
+		}
+		if i < len(n.children) && strings.HasPrefix(key, n.children[i].label) && n.children[i].remove(key[len(n.children[i].label):], word) {
+			n.children = append(n.children[:i], n.children[i+1:]...)
+		}
+	}
+	return len(n.words) == 0 && len(n.children) == 0
+}
+
+// sharedPrefix returns the length in bytes of the longest common prefix of a and b that
+// ends at a rune boundary.
+func sharedPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) {
+		r, size := utf8.DecodeRuneInString(a[n:])
+		if s, _ := utf8.DecodeRuneInString(b[n:]); s != r {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// trieCursor walks the words of a trie with keys starting with prefix, in order, up to
+// limit of them. If seek is set, the walk starts after the word after with key afterKey.
+type trieCursor struct {
+	prefix          string
+	afterKey, after string
+	seek            bool
+	limit           int
+}
+
+// walk calls visit with the words of the subtrie n, whose words have key, that the cursor
+// selects. It reports whether the limit was reached.
+func (c *trieCursor) walk(n *trieNode, key string, visit func(word string)) bool {
+	if strings.HasPrefix(key, c.prefix) {
+		for _, w := range n.words {
+			if c.seek && (key < c.afterKey || key == c.afterKey && w <= c.after) {
+				continue
+			}
+			if c.limit == 0 {
+				return true
+			}
+			visit(w)
+			c.limit--
+		}
+	}
+	for _, child := range n.children {
+		k := key + child.label
+		// Skip the subtries without keys starting with the prefix, and those with keys
+		// before afterKey only.
+		if !strings.HasPrefix(k, c.prefix) && !strings.HasPrefix(c.prefix, k) {
+			continue
+		}
+		if c.seek && k < c.afterKey && !strings.HasPrefix(c.afterKey, k) {
+			continue
+		}
+		if c.walk(child, k, visit) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// instanceDirs returns the directories making up the state of this instance, keyed by
+// the name of the directory holding their files inside an instance archive.
+// Directories that are not available are left out.
+func instanceDirs(config AppConfig) map[string]string {
+	dirs := make(map[string]string)
+	if cacheDir := config.initCacheDir(); cacheDir != "" {
+		dirs["cache"] = cacheDir
+	}
+	if dataDir := initDataDir(); dataDir != "" {
+		dirs["data"] = dataDir
+	}
+	return dirs
+}
+
+// instanceConfigEntry is the name of the configuration file inside an instance archive.
+// It is restored to the configuration file in use, or to the default one.
+const instanceConfigEntry = "config/config.toml"
+
+// exportInstance implements the "export-instance" subcommand.
+// It writes the state of this instance, i.e. the cache and the data directory and the
+// configuration file, into a gzipped tar archive that can be restored on another machine
+// with "import-instance".
+func exportInstance(config AppConfig, args []string) {
+	fs := flag.NewFlagSet("export-instance", flag.ExitOnError)
+	out := fs.String("o", "godict-"+time.Now().Format("20060102")+".tar.gz", "archive to write, - for stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s export-instance [flags]\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	if len(parseFlags(fs, args)) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dirs := instanceDirs(config)
+	if len(dirs) == 0 {
+		fmt.Fprintln(os.Stderr, "neither cache nor data dir available; nothing to export")
+		os.Exit(1)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to create archive:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := writeInstanceArchive(w, dirs, config.file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to export instance:", err)
+		os.Exit(1)
+	}
+	if *out != "-" {
+		fmt.Printf("exported %d files to %s\n", n, *out)
+	}
+}
+
+// writeInstanceArchive writes the files in dirs, including those in subdirectories, and
+// the configuration file configFile, if any, as a gzipped tar archive to w, and returns the
+// number of files written. See instanceDirs for the format of dirs. The cache database is
+// written as a snapshot, see backupCache, as the server may be writing to it.
+func writeInstanceArchive(w io.Writer, dirs map[string]string, configFile string) (int, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	n := 0
+	if configFile != "" {
+		if err := writeArchiveFile(tw, instanceConfigEntry, configFile); err != nil {
+			return n, err
+		}
+		n++
+	}
+	for name, dir := range dirs {
+		err := filepath.WalkDir(dir, func(file string, e fs.DirEntry, err error) error {
+			if err != nil || !e.Type().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return err
+			}
+			if name == "cache" && (rel == cacheDBFile || strings.HasPrefix(rel, cacheDBFile+"-")) {
+				// The database and its journals are replaced by a snapshot.
+				return nil
+			}
+			if err := writeArchiveFile(tw, path.Join(name, filepath.ToSlash(rel)), file); err != nil {
+				return err
+			}
+			n++
+			return nil
+		})
+		if err != nil {
+			return n, err
+		}
+		if name == "cache" {
+			ok, err := writeCacheSnapshot(tw, dir)
+			if err != nil {
+				return n, fmt.Errorf("failed to snapshot the cache: %w", err)
+			}
+			if ok {
+				n++
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return n, err
+	}
+	return n, gz.Close()
+}
+
+// writeCacheSnapshot writes a snapshot of the cache database in cacheDir to tw, and
+// reports whether there was a database.
+func writeCacheSnapshot(tw *tar.Writer, cacheDir string) (bool, error) {
+	if _, err := os.Stat(path.Join(cacheDir, cacheDBFile)); os.IsNotExist(err) {
+		return false, nil
+	}
+	f, err := os.CreateTemp("", "godict-cache-*.db")
+	if err != nil {
+		return false, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	if err := backupCache(cacheDir, f.Name()); err != nil {
+		return false, err
+	}
+	return true, writeArchiveFile(tw, path.Join("cache", cacheDBFile), f.Name())
+}
+
+// writeArchiveFile writes the file named file to tw as name, with its permissions, so
+// that secrets like the session key stay private when the archive is imported.
+func writeArchiveFile(tw *tar.Writer, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    int64(info.Mode().Perm()),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// importInstance implements the "import-instance" subcommand.
+// It restores the state written by "export-instance". Existing files are kept unless
+// -overwrite is given.
+func importInstance(config AppConfig, args []string) {
+	fs := flag.NewFlagSet("import-instance", flag.ExitOnError)
+	overwrite := fs.Bool("overwrite", false, "replace existing files")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s import-instance [flags] archive.tar.gz\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dirs := instanceDirs(config)
+	if len(dirs) == 0 {
+		fmt.Fprintln(os.Stderr, "neither cache nor data dir available; nothing to import into")
+		os.Exit(1)
+	}
+
+	var r io.Reader = os.Stdin
+	if positional[0] != "-" {
+		f, err := os.Open(positional[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to open archive:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		r = f
+	}
+	imported, skipped, err := readInstanceArchive(r, dirs, config.instanceConfigFile(), *overwrite)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to import instance:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("imported %d files, skipped %d existing\n", imported, skipped)
+}
+
+// readInstanceArchive extracts the files from the archive in r into dirs, and the
+// configuration file into configFile. It returns the number of imported files and the
+// number of files skipped because they already existed. Files for directories not in dirs
+// are ignored. Files get the permissions they had when exported. When the cache database
+// is replaced, its journals are removed.
+func readInstanceArchive(r io.Reader, dirs map[string]string, configFile string, overwrite bool) (int, int, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	tr := tar.NewReader(gz)
+	imported, skipped := 0, 0
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return imported, skipped, nil
+		}
+		if err != nil {
+			return imported, skipped, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		var target string
+		if hdr.Name == instanceConfigEntry {
+			target = configFile
+		} else {
+			dir, name, _ := strings.Cut(hdr.Name, "/")
+			targetDir, ok := dirs[dir]
+			if !ok {
+				continue
+			}
+			if name == "" || path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") || strings.ContainsRune(name, '\\') {
+				return imported, skipped, fmt.Errorf("invalid entry name: %q", hdr.Name)
+			}
+			target = filepath.Join(targetDir, filepath.FromSlash(name))
+		}
+		if target == "" {
+			continue
+		}
+		if _, err := os.Stat(target); err == nil && !overwrite {
+			skipped++
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return imported, skipped, err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return imported, skipped, err
+		}
+		mode := hdr.FileInfo().Mode().Perm()
+		if err := os.WriteFile(target, data, mode); err != nil {
+			return imported, skipped, err
+		}
+		// WriteFile only sets the permissions of new files.
+		if err := os.Chmod(target, mode); err != nil {
+			return imported, skipped, err
+		}
+		if hdr.Name == path.Join("cache", cacheDBFile) {
+			os.Remove(target + "-wal")
+			os.Remove(target + "-shm")
+		}
+		os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		imported++
+	}
+}
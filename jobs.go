@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jobsPrefix is the path prefix of the jobs API. Requests to jobsPrefix + "{id}" return
+// the state of a job, so that clients that started it can poll for its progress. Job IDs
+// are random, so only those who know the ID can see a job.
+const jobsPrefix = "/api/jobs/"
+
+const (
+	// maxJobs is the number of finished jobs kept for reporting.
+	maxJobs = 100
+	// maxJobLogs is the number of log lines kept per job.
+	maxJobLogs = 200
+)
+
+// Job states.
+const (
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// job is a long-running task run in the background, like a bulk admin operation or a
+// prefetch. It reports its progress and logs while running, and its result or error when
+// finished.
+type job struct {
+	mu       sync.Mutex
+	id       string
+	name     string
+	state    string
+	done     int
+	total    int
+	started  time.Time
+	finished time.Time
+	err      error
+	result   any
+	logs     []string
+}
+
+// jobStatus is the state of a job as reported by the API.
+type jobStatus struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	State    string     `json:"state"`
+	Done     int        `json:"done"`
+	Total    int        `json:"total"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Result   any        `json:"result,omitempty"`
+	Logs     []string   `json:"logs"`
+}
+
+// progress records that done of total items have been processed.
+func (j *job) progress(done, total int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.done, j.total = done, total
+}
+
+// logf adds a line to the log of j and to the server log.
+func (j *job) logf(format string, args ...any) {
+	line := fmt.Sprintf(format, args...)
+	log.Printf("job %s: %s", j.id, line)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.logs = append(j.logs, time.Now().Format(time.RFC3339)+" "+line)
+	if len(j.logs) > maxJobLogs {
+		j.logs = j.logs[len(j.logs)-maxJobLogs:]
+	}
+}
+
+// status returns the current state of j.
+func (j *job) status() jobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	s := jobStatus{ID: j.id, Name: j.name, State: j.state, Done: j.done, Total: j.total, Started: j.started, Result: j.result}
+	s.Logs = append([]string{}, j.logs...)
+	if !j.finished.IsZero() {
+		s.Finished = &j.finished
+	}
+	if j.err != nil {
+		s.Error = j.err.Error()
+	}
+	return s
+}
+
+// jobTracker runs jobs and keeps track of them. Only the most recent maxJobs jobs are kept.
+type jobTracker struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+	// order holds the IDs of the jobs, oldest first.
+	order []string
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{jobs: make(map[string]*job)}
+}
+
+// start runs run in the background as a job named name and returns the job. The value
+// returned by run is reported as the result of the job.
+func (t *jobTracker) start(name string, run func(j *job) (any, error)) *job {
+	j := &job{id: newJobID(), name: name, state: jobRunning, started: time.Now()}
+	t.mu.Lock()
+	t.jobs[j.id] = j
+	t.order = append(t.order, j.id)
+	if len(t.order) > maxJobs {
+		delete(t.jobs, t.order[0])
+		t.order = t.order[1:]
+	}
+	t.mu.Unlock()
+
+	log.Printf("job %s started: %s", j.id, name)
+	go func() {
+		result, err := run(j)
+		j.mu.Lock()
+		j.finished = time.Now()
+		j.result, j.err = result, err
+		j.state = jobDone
+		if err != nil {
+			j.state = jobFailed
+		}
+		j.mu.Unlock()
+		log.Printf("job %s %s: %s (error: %v)", j.id, j.state, name, err)
+	}()
+	return j
+}
+
+// newJobID returns a random job ID.
+func newJobID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// get returns the job with id.
+func (t *jobTracker) get(id string) (*job, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	j, ok := t.jobs[id]
+	return j, ok
+}
+
+// list returns the state of all jobs, most recent first.
+func (t *jobTracker) list() []jobStatus {
+	t.mu.Lock()
+	jobs := make([]*job, 0, len(t.order))
+	for i := len(t.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, t.jobs[t.order[i]])
+	}
+	t.mu.Unlock()
+	statuses := make([]jobStatus, 0, len(jobs))
+	for _, j := range jobs {
+		statuses = append(statuses, j.status())
+	}
+	return statuses
+}
+
+// writeJobStarted answers a request that started j with 202 Accepted, the state of the
+// job, and its URL under prefix in the Location header.
+func writeJobStarted(w http.ResponseWriter, prefix string, j *job) {
+	w.Header().Set("Location", prefix+j.id)
+	writeJSON(w, http.StatusAccepted, j.status())
+}
+
+// handleAdminJobs handles requests to adminJobsPrefix, which lists all jobs, and to
+// adminJobsPrefix + "{id}", which shows a single job, like handleJob.
+func handleAdminJobs(jobs *jobTracker) func(_ http.ResponseWriter, _ *http.Request) {
+	show := handleJob(adminJobsPrefix, jobs)
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == adminJobsPrefix {
+			writeJSON(w, http.StatusOK, jobs.list())
+			return
+		}
+		show(w, req)
+	}
+}
+
+// handleJob handles requests to prefix + "{id}", which shows a single job with its
+// progress, logs and result.
+func handleJob(prefix string, jobs *jobTracker) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		j, ok := jobs.get(strings.TrimPrefix(req.URL.Path, prefix))
+		if !ok {
+			writeError(w, req, http.StatusNotFound, "No such job.", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, j.status())
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// kioskPath is the path of the kiosk mode, a full-screen page for wall displays that
+// cycles through words, and kioskEventsPath the path of the server-sent events updating it.
+const (
+	kioskPath       = "/kiosk"
+	kioskEventsPath = "/kiosk/events"
+)
+
+// kioskKinds are the kinds of words the kiosk cycles through, in order; see
+// homepageBlockKinds. Kinds without a word, like "trending" without analytics, are
+// skipped.
+var kioskKinds = []string{"wotd", "random", "trending"}
+
+// KioskWord is a word shown by the kiosk, with its first definition. It is sent to the
+// page as the data of "word" events, as JSON.
+type KioskWord struct {
+	Kind         string `json:"kind"`
+	Word         string `json:"word"`
+	Phonetic     string `json:"phonetic,omitempty"`
+	PartOfSpeech string `json:"partOfSpeech,omitempty"`
+	Definition   string `json:"definition,omitempty"`
+	Example      string `json:"example,omitempty"`
+}
+
+// KioskContext is the data of the kiosk page.
+type KioskContext struct {
+	Word KioskWord
+	// Interval is the number of seconds each word is shown for.
+	Interval int
+}
+
+// kiosk picks the words of the kiosk. Time is divided into slots of interval, and the
+// word of a slot only depends on it, so that all displays show the same word, and a
+// display reconnecting shows the word it showed before.
+type kiosk struct {
+	home     *homepage
+	provider Provider
+	interval time.Duration
+
+	mu   sync.Mutex
+	slot int64
+	word KioskWord
+}
+
+// newKiosk returns the kiosk showing the words of home, looked up with provider. Each
+// word is shown for $GODICT_KIOSK_INTERVAL, 30 seconds by default.
+func newKiosk(home *homepage, provider Provider) *kiosk {
+	interval := durationEnv("GODICT_KIOSK_INTERVAL", 30*time.Second)
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return &kiosk{home: home, provider: provider, interval: interval, slot: -1}
+}
+
+// current returns the word of the slot of t, the slot, and the time the next slot starts.
+// The word is looked up once per slot, in the background, see sharedLookupTimeout; the
+// displays asking while it is looked up do not wait for each other.
+func (k *kiosk) current(t time.Time) (KioskWord, int64, time.Time) {
+	slot := t.UnixNano() / int64(k.interval)
+	next := time.Unix(0, (slot+1)*int64(k.interval))
+	k.mu.Lock()
+	if slot == k.slot {
+		word := k.word
+		k.mu.Unlock()
+		return word, slot, next
+	}
+	k.mu.Unlock()
+	word := KioskWord{Kind: "wotd", Word: wordOfTheDay(t)}
+	for i := range kioskKinds {
+		kind := kioskKinds[(slot+int64(i))%int64(len(kioskKinds))]
+		if w := k.pick(kind, slot, t); w != "" {
+			word = KioskWord{Kind: kind, Word: w}
+			break
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sharedLookupTimeout)
+	defer cancel()
+	words, errResp, err := searchWord(ctx, word.Word, k.provider)
+	if err != nil {
+		// The word is shown without a definition, which is looked up again by the next
+		// display asking.
+		log.Printf("failed to look up the kiosk word %s: %s", word.Word, err)
+		return word, slot, next
+	}
+	if errResp == nil && len(words) > 0 {
+		w := words[0]
+		if len(w.Phonetics) > 0 {
+			word.Phonetic = w.Phonetics[0].Text
+		}
+		if len(w.Meanings) > 0 && len(w.Meanings[0].Definitions) > 0 {
+			word.PartOfSpeech = w.Meanings[0].PartOfSpeech
+			word.Definition = w.Meanings[0].Definitions[0].Definition
+			word.Example = w.Meanings[0].Definitions[0].Example
+		}
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	// A slow lookup must not replace the word of a later slot.
+	if slot > k.slot {
+		k.slot, k.word = slot, word
+	}
+	return word, slot, next
+}
+
+// pick returns the word of kind for slot, which starts at t, or "" if there is none.
+func (k *kiosk) pick(kind string, slot int64, t time.Time) string {
+	switch kind {
+	case "wotd":
+		return wordOfTheDay(t)
+	case "random":
+		h := fnv.New32a()
+		binary.Write(h, binary.BigEndian, slot)
+		return k.home.randomWords[h.Sum32()%uint32(len(k.home.randomWords))]
+	case "trending":
+		words := k.home.analytics.trending(defaultLanguage, homepageTrendingDays, homepageWords)
+		if len(words) > 0 {
+			// The trending words take turns, in the slots of their kind.
+			return words[int(slot/int64(len(kioskKinds)))%len(words)]
+		}
+	}
+	return ""
+}
+
+// handleKiosk handles requests to kioskPath.
+func handleKiosk(tmpl *template.Template, k *kiosk) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		word, _, _ := k.current(time.Now())
+		if err := tmpl.Execute(w, KioskContext{Word: word, Interval: int(k.interval / time.Second)}); err != nil {
+			log.Print("failed to execute template: ", err)
+		}
+	}
+}
+
+// handleKioskEvents handles requests to kioskEventsPath. It streams the word of the
+// current slot, and then the word of each slot when it starts, as server-sent events with
+// the slot as the event ID. Browsers reconnecting, e.g. after a restart, with the
+// Last-Event-ID header of the current slot only get the words of the next slots.
+func handleKioskEvents(k *kiosk) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		flusher, err := openStream(w)
+		if err != nil {
+			log.Print("failed to stream kiosk words: ", err)
+			http.Error(w, "Streaming is not supported.", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, "retry: 2000\n\n")
+		last := req.Header.Get("Last-Event-ID")
+		for {
+			word, slot, next := k.current(time.Now())
+			if id := strconv.FormatInt(slot, 10); id != last {
+				data, _ := json.Marshal(word)
+				fmt.Fprintf(w, "id: %s\nevent: word\ndata: %s\n\n", id, data)
+				last = id
+			}
+			flusher.Flush()
+			select {
+			case <-time.After(time.Until(next)):
+			case <-req.Context().Done():
+				return
+			case <-streams:
+				return
+			}
+		}
+	}
+}
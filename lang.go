@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// Language is a language words can be looked up in.
+type Language struct {
+	Code string
+	Name string
+}
+
+// defaultLanguage is the language of lookups that do not ask for another one.
+const defaultLanguage = "en"
+
+// languages are the languages supported by dictionaryapi.dev.
+var languages = []Language{
+	{"en", "English"},
+	{"ar", "Arabic"},
+	{"de", "German"},
+	{"es", "Spanish"},
+	{"fr", "French"},
+	{"hi", "Hindi"},
+	{"it", "Italian"},
+	{"ja", "Japanese"},
+	{"ko", "Korean"},
+	{"pt-BR", "Portuguese (Brazil)"},
+	{"ru", "Russian"},
+	{"tr", "Turkish"},
+}
+
+// validLanguage reports whether code is one of the supported languages.
+func validLanguage(code string) bool {
+	for _, l := range languages {
+		if l.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+type languageKey struct{}
+
+// withLanguage returns a copy of ctx asking for lookups in the language lang.
+func withLanguage(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, languageKey{}, lang)
+}
+
+// languageFrom returns the language lookups with context ctx are made in.
+func languageFrom(ctx context.Context) string {
+	if lang, ok := ctx.Value(languageKey{}).(string); ok {
+		return lang
+	}
+	return defaultLanguage
+}
+
+// requestLanguage returns the language asked for by the "lang" query argument of req, or
+// defaultLanguage if it is missing or not supported.
+func requestLanguage(req *http.Request) string {
+	if lang := req.FormValue("lang"); validLanguage(lang) {
+		return lang
+	}
+	return defaultLanguage
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Output formats for desktop launchers.
+const (
+	// formatAlfred is the JSON format of Alfred script filters, see
+	// https://www.alfredapp.com/help/workflows/inputs/script-filter/json/.
+	formatAlfred = "alfred"
+	// formatRofi is one line per definition, for rofi, wofi and dmenu.
+	formatRofi = "rofi"
+)
+
+// isLauncherFormat reports whether format is an output format for desktop launchers.
+// Launchers show words that are not found as results, so they do not fail the lookup.
+func isLauncherFormat(format string) bool {
+	return format == formatAlfred || format == formatRofi
+}
+
+type alfredText struct {
+	Copy      string `json:"copy"`
+	LargeType string `json:"largetype"`
+}
+
+type alfredItem struct {
+	UID      string      `json:"uid,omitempty"`
+	Title    string      `json:"title"`
+	Subtitle string      `json:"subtitle"`
+	Arg      string      `json:"arg,omitempty"`
+	Valid    bool        `json:"valid"`
+	Text     *alfredText `json:"text,omitempty"`
+}
+
+// alfredItems returns one Alfred item per definition in words. Selecting an item passes
+// on the definition, e.g. to copy it.
+func alfredItems(words []Word) []alfredItem {
+	items := []alfredItem{}
+	assignIDs(words)
+	for _, w := range words {
+		for _, m := range w.Meanings {
+			for _, d := range m.Definitions {
+				items = append(items, alfredItem{
+					UID:      w.Word + "#" + d.ID,
+					Title:    d.Definition,
+					Subtitle: w.Word + " · " + m.PartOfSpeech,
+					Arg:      d.Definition,
+					Valid:    true,
+					Text:     &alfredText{Copy: d.Definition, LargeType: d.Definition},
+				})
+			}
+		}
+	}
+	return items
+}
+
+// writeAlfred writes items as an Alfred script filter response.
+func writeAlfred(w io.Writer, items []alfredItem) error {
+	return json.NewEncoder(w).Encode(map[string][]alfredItem{"items": items})
+}
+
+// writeWordsRofi writes one line per definition in words, prefixed by the word and the
+// part of speech.
+func writeWordsRofi(w io.Writer, words []Word) {
+	for _, word := range words {
+		for _, m := range word.Meanings {
+			for _, d := range m.Definitions {
+				fmt.Fprintf(w, "%s (%s) %s\n", word.Word, m.PartOfSpeech, strings.ReplaceAll(d.Definition, "\n", " "))
+			}
+		}
+	}
+}
+
+// launcherServer is the local API for launcher extensions, like those of Raycast or
+// Ulauncher, which query it on every keystroke. It answers from memory and the cache where
+// possible, and is neither rate limited nor serves the web interface.
+type launcherServer struct {
+	provider  Provider
+	suggester *suggester
+}
+
+// handleDefine handles requests to "/define". It returns the entries of the word in the
+// "q" query argument like the definitions API, see definePrefix, or as an Alfred script
+// filter response if the "format" query argument is "alfred".
+func (s *launcherServer) handleDefine(w http.ResponseWriter, req *http.Request) {
+	p := requestParams(req)
+	q := p.required("q", maxParamLength)
+	format := p.oneOf("format", "json", "json", formatAlfred)
+	if !p.check(w) {
+		return
+	}
+	words, err := s.provider.Lookup(withLanguage(req.Context(), requestLanguage(req)), q)
+	var providerErr *ProviderError
+	switch {
+	case errors.As(err, &providerErr):
+		writeProviderError(w, req, providerErr)
+	case err != nil:
+		log.Print(err)
+		writeError(w, req, http.StatusBadGateway, "The dictionary could not be reached.", nil)
+	case format == formatAlfred:
+		w.Header().Set("Content-Type", "application/json")
+		writeAlfred(w, alfredItems(words))
+	default:
+		assignIDs(words)
+		writeJSON(w, http.StatusOK, words)
+	}
+}
+
+// isLoopback reports whether host, an IP address or host name, refers to the local
+// machine.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// withLocalhostOnly rejects requests that do not come from the local machine, and those
+// with a Host header other than a loopback address, which protects against DNS rebinding
+// by web pages open in a browser.
+func withLocalhostOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host, _, err := net.SplitHostPort(req.Host)
+		if err != nil {
+			host = req.Host
+		}
+		if !isLoopback(clientAddr(req)) || !isLoopback(strings.Trim(host, "[]")) {
+			log.Printf("rejected request from %s for host %s", clientAddr(req), req.Host)
+			http.Error(w, "Oops", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// launcher implements the "launcher" subcommand, a local HTTP server for launcher
+// extensions. It serves "/suggest", like suggestPath, and "/define", see launcherServer.
+func launcher(config AppConfig, args []string) {
+	fs := flag.NewFlagSet("launcher", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8765", "address to listen on")
+	localhostOnly := fs.Bool("localhost-only", false, "refuse to listen on and answer requests from other than the local machine")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s launcher [flags]\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	if len(parseFlags(fs, args)) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *localhostOnly {
+		host, _, err := net.SplitHostPort(*addr)
+		if err != nil || !isLoopback(host) {
+			log.Fatalf("-localhost-only requires a loopback address, not %q", *addr)
+		}
+	}
+	cache := openCache(config.initCacheDir())
+	warmCache(cache, config.CacheWarm)
+	s := &launcherServer{
+		provider:  config.lookupProvider(cache),
+		suggester: newSuggester(cache, initDataDir(), indexMemory(config.MemoryLimit)),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/suggest", handleSuggest(s.suggester))
+	mux.HandleFunc("/define", s.handleDefine)
+	var h http.Handler = withRequestID(mux)
+	if *localhostOnly {
+		h = withLocalhostOnly(h)
+	}
+	log.Printf("launcher API: http://%s (%d words)", *addr, len(s.suggester.words))
+	log.Fatal(http.ListenAndServe(*addr, h))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxBodySize limits the bodies of requests to most routes, which take forms at most.
+	maxBodySize = 64 << 10
+	// maxImportSize limits the bodies of requests uploading data, like word lists.
+	maxImportSize = 10 << 20
+)
+
+// formMediaType is the media type of the bodies of HTML forms.
+const formMediaType = "application/x-www-form-urlencoded"
+
+// routeLimits limits the requests to a group of routes, see withRouteLimits.
+type routeLimits struct {
+	// Methods are the allowed methods. HEAD is allowed with GET.
+	Methods []string
+	// MaxBody is the maximum size of request bodies in bytes.
+	MaxBody int64
+	// ContentTypes are the media types request bodies may have. Requests with a body of
+	// another type are answered with 415 Unsupported Media Type.
+	ContentTypes []string
+}
+
+var (
+	// readRoutes only read, like the pages and most of the API.
+	readRoutes = routeLimits{
+		Methods: []string{http.MethodGet},
+		MaxBody: maxBodySize,
+	}
+	// formRoutes change data with HTML forms, like favorites.
+	formRoutes = routeLimits{
+		Methods:      []string{http.MethodGet, http.MethodPost},
+		MaxBody:      maxBodySize,
+		ContentTypes: []string{formMediaType},
+	}
+	// importRoutes take uploads, like the word lists of bulk operations. Their arguments
+	// are query arguments, as the body is the upload.
+	importRoutes = routeLimits{
+		Methods:      []string{http.MethodPost},
+		MaxBody:      maxImportSize,
+		ContentTypes: []string{"text/plain", "application/octet-stream"},
+	}
+)
+
+// routeGroups are the limits of the routes, by their patterns like those of http.ServeMux:
+// patterns ending in a slash match all paths under them, and others only the same path.
+// The most specific pattern matching a path applies; routes without one are readRoutes.
+// API routes are matched by their unversioned path.
+var routeGroups = map[string]routeLimits{
+	favoritesPath:        formRoutes,
+	watchlistPath:        formRoutes,
+	historyPath:          formRoutes,
+	myDataPath:           formRoutes,
+	"/admin/maintenance": formRoutes,
+	"/admin/bulk/":       importRoutes,
+}
+
+// limitsFor returns the limits of the route of path.
+func limitsFor(path string) routeLimits {
+	path = unversionedPath(path)
+	limits, best := readRoutes, ""
+	for pattern, l := range routeGroups {
+		if pattern == path || strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) && len(pattern) > len(best) {
+			limits, best = l, pattern
+			if pattern == path {
+				break
+			}
+		}
+	}
+	return limits
+}
+
+// withRouteLimits wraps handler, checking the requests against the limits of their route,
+// see routeGroups. Requests with other methods are answered with 405 Method Not Allowed,
+// those with larger bodies with 413 Content Too Large, and those with bodies of other media
+// types with 415 Unsupported Media Type. The bodies are limited to the maximum size while
+// the handler reads them too, for requests not announcing their size; form bodies are
+// parsed here, so that handlers never see a form cut short.
+func withRouteLimits(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		limits := limitsFor(req.URL.Path)
+		if !limits.allows(req.Method) {
+			allow := strings.Join(limits.Methods, ", ")
+			if limits.allows(http.MethodHead) {
+				allow += ", " + http.MethodHead
+			}
+			w.Header().Set("Allow", allow)
+			limitError(w, req, http.StatusMethodNotAllowed, "The method is not allowed.")
+			return
+		}
+		if req.ContentLength > limits.MaxBody {
+			limitError(w, req, http.StatusRequestEntityTooLarge, "The request body must be at most "+strconv.FormatInt(limits.MaxBody, 10)+" bytes long.")
+			return
+		}
+		if req.ContentLength == 0 {
+			handler.ServeHTTP(w, req)
+			return
+		}
+		mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if err != nil || !contains(limits.ContentTypes, mediaType) {
+			limitError(w, req, http.StatusUnsupportedMediaType, "The request body must be one of: "+strings.Join(limits.ContentTypes, ", ")+".")
+			return
+		}
+		req.Body = http.MaxBytesReader(w, req.Body, limits.MaxBody)
+		if mediaType == formMediaType {
+			var maxErr *http.MaxBytesError
+			if err := req.ParseForm(); errors.As(err, &maxErr) {
+				limitError(w, req, http.StatusRequestEntityTooLarge, "The request body must be at most "+strconv.FormatInt(limits.MaxBody, 10)+" bytes long.")
+				return
+			} else if err != nil {
+				limitError(w, req, http.StatusBadRequest, "The form is invalid.")
+				return
+			}
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// allows reports whether requests with method are allowed.
+func (l routeLimits) allows(method string) bool {
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	return contains(l.Methods, method)
+}
+
+// limitError answers req with the status code status and message, as an APIError for API
+// routes, see isAPIPath.
+func limitError(w http.ResponseWriter, req *http.Request, status int, message string) {
+	if isAPIPath(req.URL.Path) {
+		writeError(w, req, status, message, nil)
+		return
+	}
+	http.Error(w, message, status)
+}
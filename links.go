@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// OutboundLink is a link to a word's page on an external site.
+type OutboundLink struct {
+	Name string
+	URL  string
+}
+
+// linkTemplate is an external site that word pages link to. Its URL contains the
+// placeholder "{word}", which is replaced by the escaped word.
+type linkTemplate struct {
+	Name string
+	URL  string
+}
+
+// defaultLinkTemplates are the external sites linked to when no link file is configured.
+var defaultLinkTemplates = []linkTemplate{
+	{"Wiktionary", "https://en.wiktionary.org/wiki/{word}"},
+	{"Etymonline", "https://www.etymonline.com/word/{word}"},
+	{"Google Ngram", "https://books.google.com/ngrams/graph?content={word}"},
+	{"Forvo", "https://forvo.com/word/{word}/#en"},
+}
+
+// loadLinkTemplates reads link templates from the file name, one per line as the name of
+// the site followed by the URL template, e.g. "Wiktionary https://en.wiktionary.org/wiki/{word}".
+// The URL is the last field on the line, so site names may contain spaces. Empty lines
+// and lines starting with '#' are skipped.
+func loadLinkTemplates(name string) ([]linkTemplate, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	templates := []linkTemplate{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexAny(line, " \t")
+		if i < 0 || !strings.Contains(line[i+1:], "{word}") {
+			return nil, fmt.Errorf("%s:%d: expected a name and a URL containing {word}", name, n)
+		}
+		templates = append(templates, linkTemplate{Name: strings.TrimSpace(line[:i]), URL: line[i+1:]})
+	}
+	return templates, scanner.Err()
+}
+
+// initLinkTemplates returns the link templates from the file in $GODICT_LINKS, or
+// defaultLinkTemplates if it is not set.
+func initLinkTemplates() ([]linkTemplate, error) {
+	name := os.Getenv("GODICT_LINKS")
+	if name == "" {
+		return defaultLinkTemplates, nil
+	}
+	return loadLinkTemplates(name)
+}
+
+// outboundLinks returns the links to word for each of templates.
+func outboundLinks(templates []linkTemplate, word string) []OutboundLink {
+	links := make([]OutboundLink, 0, len(templates))
+	for _, t := range templates {
+		links = append(links, OutboundLink{
+			Name: t.Name,
+			URL:  strings.ReplaceAll(t.URL, "{word}", url.PathEscape(word)),
+		})
+	}
+	return links
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// lookupFormats are the output formats of the "lookup" subcommand.
+var lookupFormats = map[string]bool{"text": true, "tsv": true, "json": true, formatAlfred: true, formatRofi: true}
+
+// Exit codes of the "lookup" subcommand.
+const (
+	lookupExitFound    = 0
+	lookupExitNotFound = 1
+	lookupExitUsage    = 2
+	lookupExitError    = 3
+)
+
+// tsvField returns s with tabs and newlines replaced by spaces, for use in a TSV column.
+func tsvField(s string) string {
+	return strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ").Replace(s)
+}
+
+// writeWordsTSV writes words as tab-separated values, one row per definition, with the
+// columns word, part of speech, number of the definition within the meaning, definition
+// and example. The columns are stable, so that scripts can rely on them.
+func writeWordsTSV(w io.Writer, words []Word) {
+	for _, word := range words {
+		for _, m := range word.Meanings {
+			for i, d := range m.Definitions {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n",
+					tsvField(word.Word), tsvField(m.PartOfSpeech), i+1, tsvField(d.Definition), tsvField(d.Example))
+			}
+		}
+	}
+}
+
+// lookupWords returns the words to look up given the positional arguments: the
+// arguments themselves, or the lines of stdin for "-".
+func lookupWords(args []string) ([]string, error) {
+	if len(args) != 1 || args[0] != "-" {
+		return args, nil
+	}
+	var words []string
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if word := strings.TrimSpace(scanner.Text()); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words, scanner.Err()
+}
+
+// lookup implements the "lookup" subcommand, which prints the definitions of words for
+// use in shell pipelines. The words are given as arguments, or read from stdin, one per
+// line, if the only argument is "-"; "godict -" is a shortcut for "godict lookup -".
+// Like searches on the web, lookups use the cache and record words that are not found in
+// the no-results log.
+//
+// The exit code is lookupExitFound if all words were found, lookupExitNotFound if some
+// were not, and lookupExitError if a lookup failed, e.g. because the upstream could not
+// be reached. The launcher formats show words that are not found as results instead,
+// see isLauncherFormat.
+func lookup(config AppConfig, args []string) {
+	fs := flag.NewFlagSet("lookup", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text, tsv, json, alfred or rofi")
+	quiet := fs.Bool("quiet", false, "print nothing, only set the exit code")
+	lang := fs.String("lang", defaultLanguage, "language to look the words up in")
+	verbose := fs.Bool("v", false, "log upstream requests")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s lookup [flags] word... | -\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	args = parseFlags(fs, args)
+	if len(args) == 0 || !validLanguage(*lang) || !lookupFormats[*format] {
+		fs.Usage()
+		os.Exit(lookupExitUsage)
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	words, err := lookupWords(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to read words:", err)
+		os.Exit(lookupExitError)
+	}
+	provider := config.lookupProvider(openCache(config.initCacheDir()))
+	rec := &recorder{noResults: newNoResultsLog(initDataDir())}
+	ctx := withLanguage(context.Background(), *lang)
+
+	out := bufio.NewWriter(os.Stdout)
+	exit := lookupExitFound
+	var found []Word
+	items := []alfredItem{}
+	for i, word := range words {
+		entries, err := provider.Lookup(ctx, word)
+		var providerErr *ProviderError
+		if errors.As(err, &providerErr) && providerErr.Status == http.StatusNotFound {
+			rec.noResult(word, provider.Name())
+		}
+		switch {
+		case errors.As(err, &providerErr) && isLauncherFormat(*format):
+			title := fmt.Sprintf("%s: %s", word, providerErr.Response.Title)
+			if *format == formatRofi && !*quiet {
+				fmt.Fprintln(out, title)
+			}
+			items = append(items, alfredItem{Title: title, Subtitle: providerErr.Response.Message})
+			continue
+		case errors.As(err, &providerErr):
+			if !*quiet {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", word, providerErr.Response.Title)
+			}
+			if exit == lookupExitFound {
+				exit = lookupExitNotFound
+			}
+			continue
+		case err != nil:
+			if !*quiet {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", word, err)
+			}
+			exit = lookupExitError
+			continue
+		}
+		if *quiet {
+			continue
+		}
+		switch *format {
+		case "text":
+			if i > 0 {
+				fmt.Fprintln(out)
+			}
+			writeWordsText(out, entries)
+		case "tsv":
+			writeWordsTSV(out, entries)
+		case "json":
+			found = append(found, entries...)
+		case formatAlfred:
+			items = append(items, alfredItems(entries)...)
+		case formatRofi:
+			writeWordsRofi(out, entries)
+		}
+	}
+	if *format == "json" && !*quiet {
+		if found == nil {
+			found = []Word{}
+		}
+		json.NewEncoder(out).Encode(found)
+	}
+	if *format == formatAlfred && !*quiet {
+		writeAlfred(out, items)
+	}
+	out.Flush()
+	os.Exit(exit)
+}
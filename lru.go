@@ -0,0 +1,113 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruEntryOverhead approximates the memory used by an lru entry besides its key and data.
+const lruEntryOverhead = 128
+
+// lruEntry is a cache entry held in memory.
+type lruEntry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+// size returns the approximate memory used by e.
+func (e *lruEntry) size() int64 {
+	return int64(len(e.key)+len(e.data)) + lruEntryOverhead
+}
+
+// lru is an in-memory cache of the most recently used cache entries, in front of the cache
+// database. Its entries use at most a given number of bytes. It is safe for concurrent use.
+type lru struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	// order holds the entries, most recently used first.
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// newLRU returns an lru holding entries of up to maxBytes in total.
+func newLRU(maxBytes int64) *lru {
+	return &lru{maxBytes: maxBytes, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns the entry for key and marks it as most recently used.
+func (c *lru) get(key string) (*lruEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry), true
+}
+
+// add adds or replaces the entry for key, evicting the least recently used entries if the
+// cache is full. Entries larger than the cache are not added.
+func (c *lru) add(key string, data []byte, expires time.Time) {
+	entry := &lruEntry{key: key, data: data, expires: expires}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.bytes -= e.Value.(*lruEntry).size()
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+	if entry.size() > c.maxBytes {
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	c.bytes += entry.size()
+	c.evict()
+}
+
+// evict removes the least recently used entries until the cache fits into maxBytes.
+func (c *lru) evict() {
+	for c.bytes > c.maxBytes {
+		oldest := c.order.Back()
+		e := oldest.Value.(*lruEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, e.key)
+		c.bytes -= e.size()
+	}
+}
+
+// resize changes the maximum size of the cache to maxBytes.
+func (c *lru) resize(maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes = maxBytes
+	c.evict()
+}
+
+// remove removes the entry for key, if any.
+func (c *lru) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.bytes -= e.Value.(*lruEntry).size()
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+// len returns the number of entries.
+func (c *lru) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// size returns the memory used by the entries in bytes.
+func (c *lru) size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
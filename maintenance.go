@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maintenanceStatus is the state of the maintenance mode.
+type maintenanceStatus struct {
+	Enabled    bool
+	Message    string
+	RetryAfter time.Duration
+}
+
+// maintenanceMode is an admin-togglable state in which all pages except the admin pages
+// and static files answer with a 503 page, e.g. while background jobs run.
+type maintenanceMode struct {
+	mu     sync.RWMutex
+	status maintenanceStatus
+}
+
+// get returns the current state.
+func (m *maintenanceMode) get() maintenanceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+// set sets the current state.
+func (m *maintenanceMode) set(status maintenanceStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = status
+}
+
+// withMaintenance wraps handler so that it serves the maintenance template with status 503
+// and a Retry-After header while maintenance mode is enabled. API routes are answered with
+// an APIError instead.
+func withMaintenance(m *maintenanceMode, tmpl *template.Template, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := m.get()
+		if !status.Enabled || strings.HasPrefix(r.URL.Path, "/admin/") || strings.HasPrefix(r.URL.Path, "/static/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(status.RetryAfter.Seconds())))
+		if isAPIPath(r.URL.Path) {
+			writeError(w, r, http.StatusServiceUnavailable, "The server is in maintenance mode.", map[string]any{"message": status.Message, "retry_after": int(status.RetryAfter.Seconds())})
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := tmpl.Execute(w, status); err != nil {
+			log.Print("failed to execute template: ", err)
+		}
+	})
+}
+
+// handleAdminMaintenance handles requests to "/admin/maintenance".
+// A POST request enables maintenance mode if the "enabled" form value is "1" and disables
+// it if it is "0" or missing. The optional "message" value is shown on the maintenance page and
+// "retry_after" sets the Retry-After header in seconds (300 by default). Every request
+// returns the current state as JSON.
+func handleAdminMaintenance(m *maintenanceMode) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPost {
+			p := requestParams(req)
+			status := maintenanceStatus{
+				Enabled:    p.boolean("enabled"),
+				Message:    p.str("message", "", 1024),
+				RetryAfter: time.Duration(p.integer("retry_after", 300, 0, 7*24*60*60)) * time.Second,
+			}
+			if !p.check(w) {
+				return
+			}
+			m.set(status)
+			log.Printf("maintenance mode enabled: %t", m.get().Enabled)
+		}
+		status := m.get()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Enabled    bool   `json:"enabled"`
+			Message    string `json:"message"`
+			RetryAfter int    `json:"retryAfter"`
+		}{status.Enabled, status.Message, int(status.RetryAfter.Seconds())})
+	}
+}
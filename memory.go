@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// byteSize is a size in bytes. It is written with an optional unit, like "64MiB" or
+// "500KB", in the configuration file, flags and environment variables.
+type byteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   byteSize
+}{
+	// Longer suffixes first, so that "MiB" is not taken for "B".
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// parseByteSize parses a size in bytes with an optional unit.
+func parseByteSize(s string) (byteSize, error) {
+	s = strings.TrimSpace(s)
+	unit := byteSize(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return byteSize(n * float64(unit)), nil
+}
+
+func (b byteSize) String() string {
+	for _, u := range []struct {
+		suffix string
+		size   byteSize
+	}{{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if b >= u.size && b%u.size == 0 {
+			return fmt.Sprintf("%d%s", b/u.size, u.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", int64(b))
+}
+
+// Set implements flag.Value.
+func (b *byteSize) Set(s string) error {
+	n, err := parseByteSize(s)
+	*b = n
+	return err
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, for the configuration file.
+func (b *byteSize) UnmarshalText(text []byte) error {
+	return b.Set(string(text))
+}
+
+// The memory limit is shared by the in-memory data structures: memoryCacheShare of it is
+// used for cache entries and the rest for the suggestion index.
+const memoryCacheShare = 0.75
+
+// defaultMemoryLimit is the memory limit if none is configured, small enough for
+// instances with 256MB of memory.
+const defaultMemoryLimit = 64 << 20
+
+// memoryLimitEnv returns the memory limit of the subcommands, $GODICT_MEMORY_LIMIT, or
+// defaultMemoryLimit if it is not set or invalid.
+func memoryLimitEnv() byteSize {
+	s := os.Getenv("GODICT_MEMORY_LIMIT")
+	if s == "" {
+		return defaultMemoryLimit
+	}
+	limit, err := parseByteSize(s)
+	if err != nil {
+		log.Printf("invalid $GODICT_MEMORY_LIMIT: %s; using %s", s, byteSize(defaultMemoryLimit))
+		return defaultMemoryLimit
+	}
+	return limit
+}
+
+// cacheMemory and indexMemory return the memory for cache entries and for the suggestion
+// index under limit.
+func cacheMemory(limit byteSize) int64 {
+	return int64(float64(limit) * memoryCacheShare)
+}
+
+func indexMemory(limit byteSize) int64 {
+	return int64(limit) - cacheMemory(limit)
+}
+
+// diskWordList is a sorted word list file searched on disk, for word lists that do not
+// fit into memory. Lines are found by binary search over byte offsets.
+type diskWordList struct {
+	f    *os.File
+	size int64
+}
+
+// openDiskWordList opens the sorted word list file name.
+func openDiskWordList(name string) (*diskWordList, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &diskWordList{f: f, size: info.Size()}, nil
+}
+
+// lineAt returns the first complete line starting at or after offset, and the offset after
+// it. At the end of the file, it returns io.EOF.
+func (l *diskWordList) lineAt(offset int64) (string, int64, error) {
+	r := bufio.NewReader(io.NewSectionReader(l.f, offset, l.size-offset))
+	if offset > 0 {
+		// Skip the rest of the line containing the byte before offset, unless offset
+		// starts a line.
+		var prev [1]byte
+		if _, err := l.f.ReadAt(prev[:], offset-1); err != nil {
+			return "", 0, err
+		}
+		if prev[0] != '\n' {
+			skipped, err := r.ReadString('\n')
+			if err != nil {
+				return "", 0, io.EOF
+			}
+			offset += int64(len(skipped))
+		}
+	}
+	line, err := r.ReadString('\n')
+	if line == "" && err != nil {
+		return "", 0, io.EOF
+	}
+	return strings.TrimSuffix(line, "\n"), offset + int64(len(line)), nil
+}
+
+// withPrefix returns up to limit words starting with prefix.
+func (l *diskWordList) withPrefix(prefix string, limit int) ([]string, error) {
+	// Find the first line not less than prefix.
+	var lineErr error
+	offset := int64(sort.Search(int(l.size), func(i int) bool {
+		line, _, err := l.lineAt(int64(i))
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			lineErr = err
+			return true
+		}
+		return line >= prefix
+	}))
+	if lineErr != nil {
+		return nil, lineErr
+	}
+	var words []string
+	for len(words) < limit {
+		line, next, err := l.lineAt(offset)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, prefix) {
+			break
+		}
+		words = append(words, line)
+		offset = next
+	}
+	return words, nil
+}
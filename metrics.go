@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsPath is the path of the metrics in the Prometheus text format.
+const metricsPath = "/metrics"
+
+// latencyBuckets are the upper bounds of the buckets of latency histograms, in seconds.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// counter is a Prometheus counter with a single label.
+type counter struct {
+	name, help, label string
+
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+// inc increments the counter with label value v.
+func (c *counter) inc(v string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = make(map[string]uint64)
+	}
+	c.values[v]++
+}
+
+func (c *counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%s} %d\n", c.name, c.label, strconv.Quote(k), c.values[k])
+	}
+}
+
+// histogram is a Prometheus histogram of durations, with the buckets latencyBuckets.
+type histogram struct {
+	name, help string
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// observe records the duration d.
+func (h *histogram) observe(d time.Duration) {
+	s := d.Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets))
+	}
+	for i, b := range latencyBuckets {
+		if s <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += s
+}
+
+// since records the duration since start.
+func (h *histogram) since(start time.Time) {
+	h.observe(time.Since(start))
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, b := range latencyBuckets {
+		var n uint64
+		if h.counts != nil {
+			n = h.counts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", h.name, b, n)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %g\n%s_count %d\n", h.name, h.count, h.name, h.sum, h.name, h.count)
+}
+
+// The metrics of the server.
+var (
+	requestsTotal    = &counter{name: "godict_http_requests_total", help: "HTTP requests by status code.", label: "code"}
+	requestDuration  = &histogram{name: "godict_http_request_duration_seconds", help: "Time to answer HTTP requests."}
+	lookupsTotal     = &counter{name: "godict_lookups_total", help: "Word lookups by result.", label: "result"}
+	lookupDuration   = &histogram{name: "godict_lookup_duration_seconds", help: "Time to look up a word."}
+	cacheTotal       = &counter{name: "godict_cache_requests_total", help: "Cache requests by result.", label: "result"}
+	upstreamTotal    = &counter{name: "godict_upstream_requests_total", help: "Upstream requests by status code class, or error.", label: "status"}
+	upstreamDuration = &histogram{name: "godict_upstream_request_duration_seconds", help: "Time to answer upstream requests."}
+	rateLimitedTotal = &counter{name: "godict_rate_limited_total", help: "Requests rejected by the rate limit, by handler.", label: "handler"}
+)
+
+// metricWriters are the metrics written by handleMetrics, in order.
+var metricWriters = []interface{ write(io.Writer) }{
+	requestsTotal, requestDuration, lookupsTotal, lookupDuration, cacheTotal, upstreamTotal, upstreamDuration, rateLimitedTotal,
+}
+
+// statusClass returns the class of the HTTP status code status, like "2xx".
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// statusRecorder is an http.ResponseWriter recording the status code of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush implements http.Flusher, for handlers streaming responses.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped ResponseWriter, see clearWriteDeadline.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// withMetrics wraps handler so that its requests are counted and timed.
+func withMetrics(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(rec, r)
+		requestDuration.since(start)
+		requestsTotal.inc(strconv.Itoa(rec.status))
+	})
+}
+
+// handleMetrics handles requests to metricsPath.
+func handleMetrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	var b strings.Builder
+	for _, m := range metricWriters {
+		m.write(&b)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		log.Print("failed to write metrics: ", err)
+	}
+}
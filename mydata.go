@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+)
+
+// The data stored about a browser is its search history, in a cookie, and its watcher:
+// the watchlist, the notification preferences, like an email address, and the
+// notifications, in the data dir. Both can be exported and erased on the page at
+// myDataPath. Erasure can be undone for erasureUndoWindow; then the data is removed for
+// good. Everything else stored, like the favorites of the instance, the analytics and the
+// co-searches, is not tied to a browser; see analytics.
+
+// myDataPath is the path of the page listing the data stored about the browser.
+const myDataPath = "/mydata"
+
+// erasureUndoWindow is how long the erasure of the data of a browser can be undone.
+const erasureUndoWindow = 24 * time.Hour
+
+// erasedHistoryCookie holds the search history of a browser whose data was erased, until
+// the erasure can no longer be undone.
+const erasedHistoryCookie = "godict_erased_history"
+
+// MyDataContext is the data of the page listing the data stored about a browser.
+type MyDataContext struct {
+	History []historyEntry
+	Watcher *watcher
+	// UndoUntil is when the erasure of the data can no longer be undone, if it was erased.
+	UndoUntil time.Time
+}
+
+// myData is the export of the data stored about a browser.
+type myData struct {
+	History   []historyEntry `json:"history"`
+	Watchlist *watcher       `json:"watchlist,omitempty"`
+}
+
+// handleMyData handles requests to the page listing the data stored about the browser,
+// the search history and the watcher, see watchlists. With "format=json", the data is
+// downloaded as JSON. POST requests depend on the "action" form value:
+//   - "erase" erases the data, see watchlists.erase;
+//   - "undo" restores the data erased less than erasureUndoWindow ago.
+func handleMyData(tmpl *template.Template, key []byte, watchlists *watchlists) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Cache-Control", "private, no-store")
+		id, _ := watchlists.watcherID(req)
+		if req.Method != http.MethodPost {
+			history := readHistory(req, key)
+			if req.FormValue("format") == "json" {
+				w.Header().Set("Content-Disposition", `attachment; filename="godict-data.json"`)
+				writeJSON(w, http.StatusOK, myData{History: history, Watchlist: watchlists.export(id)})
+				return
+			}
+			ctx := MyDataContext{History: history, Watcher: watchlists.export(id)}
+			if erased, ok := watchlists.erasedAt(id); ok {
+				ctx.UndoUntil = erased.Add(erasureUndoWindow)
+			}
+			if err := tmpl.Execute(w, ctx); err != nil {
+				log.Print("failed to execute template: ", err)
+			}
+			return
+		}
+		switch req.FormValue("action") {
+		case "erase":
+			if err := watchlists.erase(id); err != nil {
+				log.Print("failed to save watchlists: ", err)
+				http.Error(w, "Oops", http.StatusInternalServerError)
+				return
+			}
+			if history := readHistory(req, key); len(history) > 0 {
+				setHistoryCookie(w, key, erasedHistoryCookie, history, erasureUndoWindow)
+			}
+			http.SetCookie(w, &http.Cookie{Name: historyCookie, Path: "/", MaxAge: -1})
+		case "undo":
+			if _, err := watchlists.restore(id); err != nil {
+				log.Print("failed to save watchlists: ", err)
+				http.Error(w, "Oops", http.StatusInternalServerError)
+				return
+			}
+			if cookie, err := req.Cookie(erasedHistoryCookie); err == nil {
+				if value, ok := verifyValue(key, cookie.Value); ok {
+					var erased []historyEntry
+					if json.Unmarshal(value, &erased) == nil {
+						writeHistory(w, key, mergeHistory(readHistory(req, key), erased))
+					}
+				}
+				http.SetCookie(w, &http.Cookie{Name: erasedHistoryCookie, Path: "/", MaxAge: -1})
+			}
+		default:
+			http.Error(w, "Oops", http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, req, myDataPath, http.StatusSeeOther)
+	}
+}
+
+// mergeHistory returns the search history entries, followed by the entries of erased not
+// in it, at most historySize of them.
+func mergeHistory(entries, erased []historyEntry) []historyEntry {
+	for _, e := range erased {
+		if len(entries) == historySize {
+			break
+		}
+		found := false
+		for _, f := range entries {
+			if f.Word == e.Word && f.Lang == e.Lang {
+				found = true
+				break
+			}
+		}
+		if !found {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ngramPrefix is the path prefix of the word usage frequency API.
+// Requests to ngramPrefix + "{word}" return the NgramSeries of the word as JSON,
+// or as an SVG sparkline with "?format=svg".
+const ngramPrefix = "/api/ngram/"
+
+const (
+	ngramYearStart = 1800
+	ngramYearEnd   = 2019
+	// ngramTTL is how long frequency data is cached. The corpus is only updated every
+	// few years.
+	ngramTTL = 30 * 24 * time.Hour
+)
+
+// errNoNgram is returned when there is no frequency data for a word.
+var errNoNgram = errors.New("no frequency data")
+
+// NgramSeries is the relative frequency of a word in books in each year from YearStart
+// to YearEnd.
+type NgramSeries struct {
+	Word        string    `json:"word"`
+	YearStart   int       `json:"yearStart"`
+	YearEnd     int       `json:"yearEnd"`
+	Frequencies []float64 `json:"frequencies"`
+}
+
+// ngramSource fetches frequency data from the Google Books Ngram Viewer, or an API
+// compatible with its JSON endpoint.
+type ngramSource struct {
+	URL    string
+	client *http.Client
+}
+
+// initNgram returns the ngram source at $GODICT_NGRAM_URL, or at the Google Books Ngram
+// Viewer if it is not set.
+func initNgram() *ngramSource {
+	u := os.Getenv("GODICT_NGRAM_URL")
+	if u == "" {
+		u = "https://books.google.com/ngrams/json"
+	}
+	return &ngramSource{URL: u, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// fetch returns the frequency data of word from the ngram source.
+func (n *ngramSource) fetch(word string) (*NgramSeries, error) {
+	q := url.Values{}
+	q.Set("content", word)
+	q.Set("year_start", fmt.Sprint(ngramYearStart))
+	q.Set("year_end", fmt.Sprint(ngramYearEnd))
+	q.Set("corpus", "en-2019")
+	q.Set("smoothing", "3")
+	resp, err := n.client.Get(n.URL + "?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ngram source answered %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var results []struct {
+		Ngram      string    `json:"ngram"`
+		Timeseries []float64 `json:"timeseries"`
+	}
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, fmt.Errorf("invalid ngram response: %w", err)
+	}
+	if len(results) == 0 || len(results[0].Timeseries) == 0 {
+		return nil, errNoNgram
+	}
+	return &NgramSeries{
+		Word:        word,
+		YearStart:   ngramYearStart,
+		YearEnd:     ngramYearStart + len(results[0].Timeseries) - 1,
+		Frequencies: results[0].Timeseries,
+	}, nil
+}
+
+// series returns the frequency data of word, from the cache in cacheDir if possible.
+// Frequency data is cached in the ".ngram" subdirectory, in the same format as the
+// JSON API returns it, in a file named by cacheFileName.
+func (n *ngramSource) series(word, cacheDir string) (*NgramSeries, error) {
+	var cacheFile string
+	if cacheDir != "" {
+		dir := path.Join(cacheDir, ".ngram")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Print("failed to create ngram cache dir: ", err)
+		} else {
+			cacheFile = path.Join(dir, cacheFileName(word))
+		}
+	}
+	if cacheFile != "" {
+		data, expires, err := readCacheFile(cacheFile)
+		if err == nil && time.Now().Before(expires) {
+			var s NgramSeries
+			if err := json.Unmarshal(data, &s); err == nil {
+				return &s, nil
+			}
+		}
+	}
+	s, err := n.fetch(word)
+	if err != nil {
+		return nil, err
+	}
+	if cacheFile != "" {
+		data, _ := json.Marshal(s)
+		if err := writeCacheFile(cacheFile, data, time.Now().Add(ngramTTL)); err != nil {
+			log.Print("failed to write ngram cache file: ", err)
+		}
+	}
+	return s, nil
+}
+
+// sparkline returns an SVG line chart of the frequencies in s, width by height pixels,
+// without axes or labels.
+func sparkline(s *NgramSeries, width, height int) string {
+	max := 0.0
+	for _, f := range s.Frequencies {
+		if f > max {
+			max = f
+		}
+	}
+	step := float64(width)
+	if len(s.Frequencies) > 1 {
+		step /= float64(len(s.Frequencies) - 1)
+	}
+	var points []string
+	for i, f := range s.Frequencies {
+		x := step * float64(i)
+		y := float64(height)
+		if max > 0 {
+			y -= f / max * float64(height-2)
+		}
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y-1))
+	}
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+
+		`<title>%s, %d–%d</title>`+
+		`<polyline fill="none" stroke="#495057" stroke-width="1.5" points="%s"/></svg>`,
+		width, height, width, height, html.EscapeString(s.Word), s.YearStart, s.YearEnd, strings.Join(points, " "))
+}
+
+// handleNgram handles requests to the word usage frequency API.
+func handleNgram(cacheDir string, ngram *ngramSource) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		word := strings.TrimPrefix(req.URL.Path, ngramPrefix)
+		logSearch(req.Context(), "handle ngram: %s", word)
+		if word == "" || strings.Contains(word, "/") {
+			writeError(w, req, http.StatusNotFound, "Usage: "+ngramPrefix+"{word}", nil)
+			return
+		}
+		p := requestParams(req)
+		format := p.oneOf("format", "json", "json", "svg")
+		if !p.check(w) {
+			return
+		}
+		s, err := ngram.series(word, cacheDir)
+		if errors.Is(err, errNoNgram) {
+			writeError(w, req, http.StatusNotFound, "No usage data for the word.", nil)
+			return
+		}
+		if err != nil {
+			logSearch(req.Context(), "failed to fetch ngram: %s", err)
+			writeError(w, req, http.StatusBadGateway, "The usage data could not be fetched.", nil)
+			return
+		}
+		if format == "svg" {
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte(sparkline(s, 200, 40)))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s)
+	}
+}
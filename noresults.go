@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// noResultsFile is the name of the no-results log in the data directory.
+const noResultsFile = "noresults.jsonl"
+
+// noResult is a single search that returned no definitions.
+type noResult struct {
+	Term     string    `json:"term"`
+	Time     time.Time `json:"time"`
+	Provider string    `json:"provider"`
+}
+
+// noResultsLog records searches that returned no definitions, so that instance admins
+// can see which vocabulary their users need but the upstream does not cover.
+// The records are appended to a JSON lines file. A nil *noResultsLog records nothing.
+type noResultsLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+// newNoResultsLog returns a no-results log stored in dataDir.
+// If dataDir is empty, nil is returned and nothing is recorded.
+func newNoResultsLog(dataDir string) *noResultsLog {
+	if dataDir == "" {
+		return nil
+	}
+	return &noResultsLog{path: path.Join(dataDir, noResultsFile)}
+}
+
+// record records a search for term that returned no definitions from provider.
+// Searches are recorded through recorder.noResult, which leaves out requests in privacy
+// mode.
+func (l *noResultsLog) record(term, provider string) {
+	if l == nil {
+		return
+	}
+	data, err := json.Marshal(noResult{Term: term, Time: time.Now().UTC(), Provider: provider})
+	if err != nil {
+		log.Print("failed to encode no-results record: ", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Print("failed to open no-results log: ", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Print("failed to write no-results log: ", err)
+	}
+}
+
+// noResultsReport implements the "noresults" subcommand.
+// It prints the terms from the no-results log, most frequently searched first.
+func noResultsReport(args []string) {
+	fs := flag.NewFlagSet("noresults", flag.ExitOnError)
+	since := fs.Duration("since", 0, "only report searches newer than this, e.g. 168h")
+	limit := fs.Int("n", 50, "maximum number of terms to report, 0 for all")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s noresults [flags]\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	if len(parseFlags(fs, args)) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dataDir := initDataDir()
+	if dataDir == "" {
+		fmt.Fprintln(os.Stderr, "data dir not available")
+		os.Exit(1)
+	}
+
+	f, err := os.Open(path.Join(dataDir, noResultsFile))
+	if os.IsNotExist(err) {
+		fmt.Println("no searches without results recorded")
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to open no-results log:", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	type termStats struct {
+		Term      string
+		Count     int
+		LastSeen  time.Time
+		Providers map[string]bool
+	}
+	stats := make(map[string]*termStats)
+	var cutoff time.Time
+	if *since > 0 {
+		cutoff = time.Now().Add(-*since)
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r noResult
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil || r.Time.Before(cutoff) {
+			continue
+		}
+		s, ok := stats[r.Term]
+		if !ok {
+			s = &termStats{Term: r.Term, Providers: make(map[string]bool)}
+			stats[r.Term] = s
+		}
+		s.Count++
+		s.Providers[r.Provider] = true
+		if r.Time.After(s.LastSeen) {
+			s.LastSeen = r.Time
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to read no-results log:", err)
+		os.Exit(1)
+	}
+
+	sorted := make([]*termStats, 0, len(stats))
+	for _, s := range stats {
+		sorted = append(sorted, s)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Term < sorted[j].Term
+	})
+	if *limit > 0 && len(sorted) > *limit {
+		sorted = sorted[:*limit]
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TERM\tCOUNT\tLAST SEEN\tPROVIDERS")
+	for _, s := range sorted {
+		providers := make([]string, 0, len(s.Providers))
+		for p := range s.Providers {
+			providers = append(providers, p)
+		}
+		sort.Strings(providers)
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%v\n", s.Term, s.Count, s.LastSeen.Local().Format("2006-01-02 15:04"), providers)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+//go:embed data/offline.tsv
+var offlineData string
+
+// offlineDictionary is the compact dictionary used when the upstream cannot be reached,
+// or in offline mode. It holds English entries only.
+type offlineDictionary struct {
+	entries map[string][]Word
+}
+
+var (
+	offlineOnce sync.Once
+	offline     *offlineDictionary
+)
+
+// bundledDictionary returns the offline dictionary: the bundled one, an extract of
+// WordNet made by the "offline-dict" subcommand, extended by the dictionary file in
+// $GODICT_OFFLINE_DICT, in the same format, if set.
+func bundledDictionary() *offlineDictionary {
+	offlineOnce.Do(func() {
+		offline = &offlineDictionary{entries: make(map[string][]Word)}
+		offline.add(offlineData)
+		if name := os.Getenv("GODICT_OFFLINE_DICT"); name != "" {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				log.Print("failed to read offline dictionary: ", err)
+				return
+			}
+			offline.add(string(data))
+		}
+	})
+	return offline
+}
+
+// add adds the definitions in data, one per line as word, part of speech and definition
+// separated by tabs. Definitions of the same part of speech are grouped into one meaning.
+func (d *offlineDictionary) add(data string) {
+	for _, line := range dataLines(data) {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		word, pos, def := normalizeWord(fields[0]), fields[1], Definition{Definition: fields[2]}
+		if len(d.entries[word]) == 0 {
+			d.entries[word] = []Word{{Word: word}}
+		}
+		w := &d.entries[word][0]
+		if n := len(w.Meanings); n > 0 && w.Meanings[n-1].PartOfSpeech == pos {
+			w.Meanings[n-1].Definitions = append(w.Meanings[n-1].Definitions, def)
+			continue
+		}
+		w.Meanings = append(w.Meanings, Meaning{PartOfSpeech: pos, Definitions: []Definition{def}})
+	}
+}
+
+// lookup returns the entries of word in language lang. The second return value is false
+// if there are none.
+func (d *offlineDictionary) lookup(word, lang string) ([]Word, bool) {
+	if d == nil || lang != defaultLanguage {
+		return nil, false
+	}
+	words, ok := d.entries[normalizeWord(word)]
+	if !ok {
+		return nil, false
+	}
+	// Return a copy, as callers like assignIDs modify the entries.
+	copied := make([]Word, len(words))
+	for i, w := range words {
+		copied[i] = w
+		copied[i].Meanings = append([]Meaning(nil), w.Meanings...)
+		for j := range copied[i].Meanings {
+			copied[i].Meanings[j].Definitions = append([]Definition(nil), w.Meanings[j].Definitions...)
+		}
+	}
+	return copied, true
+}
+
+// errOffline is returned by Upstream.fetchEntry for words that are not cached in offline
+// mode.
+var errOffline = errors.New("not cached, and offline")
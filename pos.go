@@ -0,0 +1,101 @@
+package main
+
+import (
+	_ "embed"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+//go:embed data/pos.tsv
+var posData string
+
+// posLabel is the human-friendly label of a part of speech in a language.
+type posLabel struct {
+	Label string
+	Abbr  string
+}
+
+// posLabels are the labels of the parts of speech returned by the dictionary, keyed by
+// language and then by the part of speech in lower case.
+var posLabels = parsePOSLabels(posData)
+
+// posLanguages are the languages of posLabels, English first, so that it is the default
+// in posMatcher, which matches the languages of the Accept-Language header to them.
+var (
+	posLanguages []string
+	posMatcher   language.Matcher
+)
+
+func init() {
+	posLanguages = []string{defaultLanguage}
+	for _, l := range languages {
+		if _, ok := posLabels[l.Code]; ok && l.Code != defaultLanguage {
+			posLanguages = append(posLanguages, l.Code)
+		}
+	}
+	tags := make([]language.Tag, len(posLanguages))
+	for i, lang := range posLanguages {
+		tags[i] = language.Make(lang)
+	}
+	posMatcher = language.NewMatcher(tags)
+}
+
+// parsePOSLabels parses the labels in data, see data/pos.tsv for the format.
+func parsePOSLabels(data string) map[string]map[string]posLabel {
+	labels := make(map[string]map[string]posLabel)
+	for _, line := range dataLines(data) {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		if labels[fields[0]] == nil {
+			labels[fields[0]] = make(map[string]posLabel)
+		}
+		labels[fields[0]][fields[1]] = posLabel{Label: fields[2], Abbr: fields[3]}
+	}
+	return labels
+}
+
+// labelFor returns the label of the part of speech pos in language lang, or in English if
+// there is none. Unknown parts of speech are labeled as they are, without abbreviation.
+func labelFor(pos, lang string) posLabel {
+	key := strings.ToLower(strings.TrimSpace(pos))
+	if l, ok := posLabels[lang][key]; ok {
+		return l
+	}
+	if l, ok := posLabels[defaultLanguage][key]; ok {
+		return l
+	}
+	return posLabel{Label: pos}
+}
+
+// labelParts sets the labels of the parts of speech of the meanings of words in language
+// lang.
+func labelParts(words []Word, lang string) {
+	for i := range words {
+		for j := range words[i].Meanings {
+			m := &words[i].Meanings[j]
+			l := labelFor(m.PartOfSpeech, lang)
+			m.PartOfSpeechLabel, m.PartOfSpeechAbbr = l.Label, l.Abbr
+		}
+	}
+}
+
+// labelLanguage returns the language of part of speech labels asked for by the parameter
+// name, one of posLanguages. Without it, the language preferred in the Accept-Language
+// header is returned if negotiate is set, and "" otherwise, meaning no labels.
+func (p *params) labelLanguage(name string, negotiate bool) string {
+	if p.value(name) != "" {
+		return p.oneOf(name, defaultLanguage, posLanguages...)
+	}
+	if !negotiate {
+		return ""
+	}
+	tags, _, err := language.ParseAcceptLanguage(p.req.Header.Get("Accept-Language"))
+	if err != nil {
+		return defaultLanguage
+	}
+	_, i, _ := posMatcher.Match(tags...)
+	return posLanguages[i]
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// prefetchResult is the outcome of looking up a single word during prefetch.
+type prefetchResult struct {
+	Word   string
+	Status string
+}
+
+const (
+	prefetchCached   = "cached"
+	prefetchFetched  = "fetched"
+	prefetchNotFound = "not found"
+	prefetchFailed   = "failed"
+)
+
+// parseFlags parses args using fs and returns the positional arguments.
+// Unlike fs.Parse, flags may also follow positional arguments, so that both
+// "prefetch -concurrency 4 words.txt" and "prefetch words.txt --concurrency 4" work.
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// readWordList reads a word list file with one word per line.
+// Empty lines and lines starting with '#' are skipped, as are duplicate words.
+func readWordList(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseWordList(f)
+}
+
+// parseWordList reads a word list from r, like readWordList.
+func parseWordList(r io.Reader) ([]string, error) {
+	var words []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") || seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	return words, scanner.Err()
+}
+
+// prefetchWord looks up word and stores the result in the cache.
+// Upstream requests are paced by limiter; words with an unexpired cache entry do not
+// consume it.
+func prefetchWord(word string, cache *entryCache, provider Provider, limiter <-chan time.Time) string {
+	if _, expires, err := cache.get(context.Background(), normalizeWord(word), defaultLanguage); err == nil && time.Now().Before(expires) {
+		return prefetchCached
+	}
+	<-limiter
+	_, errResp, err := searchWord(context.Background(), word, provider)
+	switch {
+	case errResp != nil:
+		return prefetchNotFound
+	case err != nil:
+		log.Print(err)
+		return prefetchFailed
+	}
+	return prefetchFetched
+}
+
+// prefetch implements the "prefetch" subcommand.
+// It looks up every word from a word list and stores the results in the cache, so that
+// the words are later available without network access. Processed words are recorded
+// in a progress file next to the word list and skipped on the next run, which makes it
+// possible to resume an interrupted prefetch by running the same command again. Words
+// that failed because of network or upstream errors are not recorded and are retried.
+func prefetch(config AppConfig, args []string) {
+	fs := flag.NewFlagSet("prefetch", flag.ExitOnError)
+	concurrency := fs.Int("concurrency", 1, "number of concurrent lookups")
+	rate := fs.Duration("rate", time.Second, "minimum delay between upstream requests")
+	verbose := fs.Bool("v", false, "log every lookup")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s prefetch [flags] wordlist.txt\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 || *concurrency < 1 || *rate <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	wordList := positional[0]
+
+	cache := openCache(config.initCacheDir())
+	if cache == nil {
+		log.Fatal("cache not available; nothing to prefetch into")
+	}
+	upstream := config.newUpstream()
+	// Refresh expired entries before the process exits.
+	upstream.StaleTTL = 0
+	provider := newDictionaryAPI(upstream, cache)
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	words, err := readWordList(wordList)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to read word list:", err)
+		os.Exit(1)
+	}
+	progressFile := wordList + ".done"
+	done, err := readWordList(progressFile)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, "failed to read progress file:", err)
+		os.Exit(1)
+	}
+	skip := make(map[string]bool)
+	for _, word := range done {
+		skip[word] = true
+	}
+	var todo []string
+	for _, word := range words {
+		if !skip[word] {
+			todo = append(todo, word)
+		}
+	}
+	if len(done) > 0 {
+		fmt.Printf("resuming: %d of %d words already done\n", len(words)-len(todo), len(words))
+	}
+
+	progress, err := os.OpenFile(progressFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to open progress file:", err)
+		os.Exit(1)
+	}
+	defer progress.Close()
+
+	queue := make(chan string)
+	results := make(chan prefetchResult)
+	limiter := time.Tick(*rate)
+	for i := 0; i < *concurrency; i++ {
+		go func() {
+			for word := range queue {
+				results <- prefetchResult{word, prefetchWord(word, cache, provider, limiter)}
+			}
+		}()
+	}
+	go func() {
+		for _, word := range todo {
+			queue <- word
+		}
+		close(queue)
+	}()
+
+	counts := make(map[string]int)
+	for i := range todo {
+		r := <-results
+		counts[r.Status]++
+		fmt.Printf("[%d/%d] %s: %s\n", i+1, len(todo), r.Word, r.Status)
+		if r.Status != prefetchFailed {
+			fmt.Fprintln(progress, r.Word)
+		}
+	}
+	fmt.Printf("done: %d fetched, %d already cached, %d not found, %d failed\n",
+		counts[prefetchFetched], counts[prefetchCached], counts[prefetchNotFound], counts[prefetchFailed])
+	if counts[prefetchFailed] > 0 {
+		os.Exit(1)
+	}
+}
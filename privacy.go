@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Everything recorded about the lookups of a request goes through its recorder, see
+// recorderFrom, which withPrivacy disables for requests in privacy mode:
+//
+//   - the analytics, the co-searches, the search history and the no-results log, see
+//     recorder.search, recorder.coSearch, recorder.history and recorder.noResult;
+//   - the use of cache entries, see recorder.use;
+//   - the log, which is written to stderr and streamed to the admin log page, see
+//     logBroadcaster, for messages with the words looked up, see logSearch;
+//   - the comparisons with the shadow upstream, see recorder.compare.
+//
+// Features recording searches do so with the methods of the recorder rather than with the
+// stores themselves, so that privacy mode is enforced in one place.
+//
+// The caches of dictionary content, i.e. the cache entries and the audio, Datamuse and
+// ngram cache files, are filled by private lookups too, as they are needed to answer
+// requests within the limits of the upstreams; they do not record who looked a word up.
+
+// recorder records the lookups of requests in the stores it holds; nil stores record
+// nothing. A disabled recorder records nothing at all.
+type recorder struct {
+	// disabled is set for requests in privacy mode.
+	disabled   bool
+	analytics  *analytics
+	coSearches *coSearches
+	noResults  *noResultsLog
+	shadow     *shadow
+}
+
+type recorderKey struct{}
+
+// backgroundRecorder records the lookups of work not started by a request, like the
+// prefetching of words or the subcommands: it logs them and records the use of cache
+// entries, but it has no stores.
+var backgroundRecorder = &recorder{}
+
+// withRecorder returns ctx with the recorder r, which records the lookups made with it.
+func withRecorder(ctx context.Context, r *recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// recorderFrom returns the recorder of ctx, see withRecorder, or backgroundRecorder if
+// it has none.
+func recorderFrom(ctx context.Context) *recorder {
+	if r, ok := ctx.Value(recorderKey{}).(*recorder); ok {
+		return r
+	}
+	return backgroundRecorder
+}
+
+// isPrivate reports whether the request with context ctx asked for privacy mode.
+// In privacy mode, nothing about the request is persisted beyond what is needed to answer
+// it, see recorder.
+func isPrivate(ctx context.Context) bool {
+	return recorderFrom(ctx).disabled
+}
+
+// search counts a search of req for word in language lang in the analytics, which found
+// definitions if found is set.
+func (r *recorder) search(req *http.Request, word, lang string, found bool) {
+	if r.disabled {
+		return
+	}
+	r.analytics.record(req, word, lang, found)
+}
+
+// coSearch counts the search for word in language lang along with the earlier searches in
+// history, see coSearches.record.
+func (r *recorder) coSearch(history []historyEntry, word, lang string) {
+	if r.disabled {
+		return
+	}
+	r.coSearches.record(history, word, lang)
+}
+
+// history adds word in language lang to the search history of the session of req, see
+// recordHistory.
+func (r *recorder) history(w http.ResponseWriter, req *http.Request, key []byte, word, lang string) {
+	if r.disabled {
+		return
+	}
+	recordHistory(w, req, key, word, lang)
+}
+
+// noResult records a search for term that returned no definitions from provider in the
+// no-results log.
+func (r *recorder) noResult(term, provider string) {
+	if r.disabled {
+		return
+	}
+	r.noResults.record(term, provider)
+}
+
+// use records a use of the entry of word in language lang in cache, see entryCache.use.
+func (r *recorder) use(cache *entryCache, word, lang string) {
+	if r.disabled {
+		return
+	}
+	cache.use(word, lang)
+}
+
+// compare compares a lookup with the shadow upstream, see shadow.compare.
+func (r *recorder) compare(word, lang string, primary []Word, primaryErr error) {
+	if r.disabled {
+		return
+	}
+	r.shadow.compare(word, lang, primary, primaryErr)
+}
+
+// logSearch logs a message about the lookup of a word for the request with context ctx,
+// like log.Printf, unless the recorder of the request is disabled.
+func logSearch(ctx context.Context, format string, v ...interface{}) {
+	if recorderFrom(ctx).disabled {
+		return
+	}
+	log.Output(2, fmt.Sprintf(format, v...))
+}
+
+// withPrivacy wraps handler so that each request records its lookups with rec, see
+// recorderFrom, or, if it asks for privacy mode, with a disabled recorder. Privacy mode is
+// enabled by the "private=1" query argument or by the DNT and Sec-GPC request headers.
+func withPrivacy(rec *recorder, handler http.Handler) http.Handler {
+	disabled := &recorder{disabled: true}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		private := r.URL.Query().Get("private") == "1" ||
+			r.Header.Get("DNT") == "1" ||
+			r.Header.Get("Sec-GPC") == "1"
+		if private {
+			r = r.WithContext(withRecorder(r.Context(), disabled))
+		} else {
+			r = r.WithContext(withRecorder(r.Context(), rec))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Provider looks up words in a dictionary.
+// When the dictionary answers with an error, e.g. because it has no definitions for the
+// word, Lookup returns a *ProviderError.
+type Provider interface {
+	// Name identifies the provider in logs and reports.
+	Name() string
+	Lookup(ctx context.Context, word string) ([]Word, error)
+}
+
+// ProviderError is an error response of a dictionary.
+type ProviderError struct {
+	// Status is the HTTP status code of the response, e.g. http.StatusNotFound.
+	Status   int
+	Response ErrorResponse
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s (status %d)", e.Response.Title, e.Status)
+}
+
+// dictionaryAPI is the Provider for dictionaryapi.dev and upstreams compatible with it.
+// It looks up entries in the language given by languageFrom, using cache. If the upstream
+// cannot be reached, entries are looked up in the offline dictionary.
+type dictionaryAPI struct {
+	upstream *Upstream
+	cache    *entryCache
+	offline  *offlineDictionary
+}
+
+// newDictionaryAPI returns the Provider for upstream, caching entries in cache.
+func newDictionaryAPI(upstream *Upstream, cache *entryCache) *dictionaryAPI {
+	return &dictionaryAPI{upstream: upstream, cache: cache, offline: bundledDictionary()}
+}
+
+func (d *dictionaryAPI) Name() string {
+	return d.upstream.BaseURL
+}
+
+func (d *dictionaryAPI) Lookup(ctx context.Context, word string) ([]Word, error) {
+	start := time.Now()
+	words, err := d.lookup(ctx, word)
+	lookupDuration.since(start)
+	lookupsTotal.inc(lookupResult(err))
+	return words, err
+}
+
+// lookupSnapshot looks up word in language lang as it was at t, in the snapshots.
+func (d *dictionaryAPI) lookupSnapshot(word, lang string, t time.Time) ([]Word, error) {
+	data, err := d.cache.snapshot(normalizeWord(word), lang, t)
+	if err == errCacheMiss {
+		return nil, &ProviderError{Status: http.StatusNotFound, Response: ErrorResponse{
+			Title:   "No Snapshot Found",
+			Message: "There is no snapshot of the word from that date.",
+		}}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var words []Word
+	if err := json.Unmarshal(data, &words); err != nil {
+		return nil, fmt.Errorf("invalid snapshot of %s: %w", word, err)
+	}
+	return words, nil
+}
+
+// lookupResult returns the result of a lookup that returned err, for metrics.
+func lookupResult(err error) string {
+	var providerErr *ProviderError
+	switch {
+	case err == nil:
+		return "found"
+	case errors.As(err, &providerErr) && providerErr.Status == http.StatusNotFound:
+		return "not_found"
+	}
+	return "error"
+}
+
+func (d *dictionaryAPI) lookup(ctx context.Context, word string) ([]Word, error) {
+	lang := languageFrom(ctx)
+	if t, ok := asOfFrom(ctx); ok {
+		return d.lookupSnapshot(word, lang, t)
+	}
+	status, data, err := d.upstream.fetchEntry(ctx, word, lang, d.cache)
+	if err != nil {
+		if words, ok := d.offline.lookup(word, lang); ok {
+			logSearch(ctx, "serving %s from the offline dictionary: %s", word, err)
+			return words, nil
+		}
+		if errors.Is(err, errOffline) {
+			return nil, &ProviderError{Status: http.StatusNotFound, Response: ErrorResponse{
+				Title:   "No Definitions Found",
+				Message: "The word is not available offline.",
+			}}
+		}
+		return nil, err
+	}
+	if status/100 != 2 {
+		e := &ProviderError{Status: status}
+		if err := json.Unmarshal(data, &e.Response); err != nil {
+			return nil, fmt.Errorf("invalid error response for %s: %w", word, err)
+		}
+		return nil, e
+	}
+	var words []Word
+	if err := json.Unmarshal(data, &words); err != nil {
+		return nil, fmt.Errorf("invalid response for %s: %w", word, err)
+	}
+	return words, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// proxyPrefix is the path prefix of the dictionaryapi.dev mirror.
+// Requests to proxyPrefix + "{lang}/{word}" mirror the upstream API.
+const proxyPrefix = "/proxy/api/v2/entries/"
+
+// writeProxyError writes an error response in the same shape as the upstream API.
+func writeProxyError(w http.ResponseWriter, status int, title, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"title":      title,
+		"message":    message,
+		"resolution": "You can try the search again at later time or head to the web instead.",
+	})
+}
+
+// handleProxy handles requests to the dictionaryapi.dev mirror.
+// The upstream status code and raw JSON body are passed through, so clients
+// written against dictionaryapi.dev can use this server as a drop-in replacement.
+func handleProxy(cache *entryCache, upstream *Upstream) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		lang, word, ok := strings.Cut(strings.TrimPrefix(req.URL.Path, proxyPrefix), "/")
+		logSearch(req.Context(), "handle proxy: %s/%s", lang, word)
+		if !ok || lang == "" || word == "" || strings.Contains(word, "/") {
+			writeProxyError(w, http.StatusNotFound, "No Definitions Found",
+				"Sorry pal, we couldn't find definitions for the word you were looking for.")
+			return
+		}
+		status, data, err := upstream.fetchEntry(req.Context(), word, lang, cache)
+		if err != nil {
+			log.Print(err)
+			writeProxyError(w, http.StatusBadGateway, "Something Went Wrong",
+				"Sorry pal, we couldn't reach the dictionary API.")
+			return
+		}
+		if status == http.StatusNotFound {
+			recorderFrom(req.Context()).noResult(word, upstream.BaseURL)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(data)
+	}
+}
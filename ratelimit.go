@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimit configures the rate limiter of the handlers.
+type rateLimit struct {
+	// Rate is the number of requests per second a client may send on average.
+	Rate float64 `toml:"rate"`
+	// Burst is the number of requests a client may send at once.
+	Burst int `toml:"burst"`
+}
+
+// bucket is the token bucket of one client.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter limits the rate of requests per client with a token bucket: each client
+// may send up to Burst requests at once, and gets Rate more per second.
+type rateLimiter struct {
+	limit rateLimit
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// lastSweep is when buckets were last cleaned of full buckets.
+	lastSweep time.Time
+}
+
+// rateLimiterSweep is the interval at which full buckets, which are no different from
+// new ones, are removed.
+const rateLimiterSweep = time.Minute
+
+func newRateLimiter(limit rateLimit) *rateLimiter {
+	return &rateLimiter{limit: limit, buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// allow reports whether client may send a request now. If not, it also returns how long
+// the client has to wait.
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > rateLimiterSweep {
+		for c, b := range l.buckets {
+			if l.refill(b, now) >= float64(l.limit.Burst) {
+				delete(l.buckets, c)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[client] = b
+	}
+	if l.refill(b, now) < 1 {
+		return false, time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// refill adds the tokens b has gained since it was last refilled and returns them.
+func (l *rateLimiter) refill(b *bucket, now time.Time) float64 {
+	b.tokens = math.Min(float64(l.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+	return b.tokens
+}
+
+// clientAddr returns the IP address of the client that sent req, anonymized if so
+// configured; see withAnonymizedAddr.
+func clientAddr(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// The environment variables passing the listening sockets and the readiness pipe to the
+// new process on an upgrade, as file descriptors.
+const (
+	listenFDEnv      = "GODICT_LISTEN_FD"
+	adminListenFDEnv = "GODICT_ADMIN_LISTEN_FD"
+	readyFDEnv       = "GODICT_READY_FD"
+)
+
+// upgradeTimeout limits how long the new process may take to start serving on an upgrade.
+const upgradeTimeout = 30 * time.Second
+
+// listen returns a listener on addr, or the listener inherited from the previous process
+// on an upgrade in the environment variable fdEnv, see upgradeOnSignal.
+func listen(addr, fdEnv string) (net.Listener, error) {
+	s := os.Getenv(fdEnv)
+	if s == "" {
+		return net.Listen("tcp", addr)
+	}
+	os.Unsetenv(fdEnv)
+	fd, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $%s: %s", fdEnv, s)
+	}
+	f := os.NewFile(uintptr(fd), "listener")
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("inherited listener on %s from the previous process", ln.Addr())
+	return ln, nil
+}
+
+// notifyReady tells the previous process that this one is serving, on an upgrade, so that
+// it can stop.
+func notifyReady() {
+	s := os.Getenv(readyFDEnv)
+	if s == "" {
+		return
+	}
+	os.Unsetenv(readyFDEnv)
+	fd, err := strconv.Atoi(s)
+	if err != nil {
+		log.Printf("invalid $%s: %s", readyFDEnv, s)
+		return
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	if _, err := f.Write([]byte{1}); err != nil {
+		log.Print("failed to notify the previous process: ", err)
+	}
+}
+
+// upgrade starts a new process of the same executable with the same arguments, passing
+// it listeners, keyed by the environment variable passing each, and waits until it
+// serves. The new process reads the configuration anew.
+func upgrade(listeners map[string]net.Listener) error {
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	env := os.Environ()
+	for name, ln := range listeners {
+		tcp, ok := ln.(*net.TCPListener)
+		if !ok {
+			return errors.New("listener cannot be passed on")
+		}
+		f, err := tcp.File()
+		if err != nil {
+			return err
+		}
+		// ExtraFiles start at file descriptor 3.
+		env = append(env, fmt.Sprintf("%s=%d", name, 3+len(files)))
+		files = append(files, f)
+	}
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+	exe, err := os.Executable()
+	if err != nil {
+		readyW.Close()
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(append([]*os.File(nil), files...), readyW)
+	cmd.Env = append(env, fmt.Sprintf("%s=%d", readyFDEnv, 3+len(files)))
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		ready <- err
+	}()
+	select {
+	case err := <-ready:
+		if err != nil {
+			return fmt.Errorf("new process failed to start: %w", err)
+		}
+		return nil
+	case err := <-exited:
+		return fmt.Errorf("new process exited: %v", err)
+	case <-time.After(upgradeTimeout):
+		cmd.Process.Kill()
+		return errors.New("new process did not start in time")
+	}
+}
+
+// upgradeOnSignal replaces the running servers by a new process, without dropping
+// connections, when the process receives SIGHUP: the new process takes over the listening
+// sockets, see upgrade, and servers finish the requests in progress, waiting for at most
+// drainTimeout, before the returned channel is closed and this process may exit. If the
+// new process fails to start, servers continue serving. This picks up a new configuration
+// or a new executable, e.g. after an update.
+func upgradeOnSignal(servers []*http.Server, listeners map[string]net.Listener, drainTimeout time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			log.Print("upgrading")
+			if err := upgrade(listeners); err != nil {
+				log.Print("failed to upgrade: ", err)
+				continue
+			}
+			signal.Stop(signals)
+			drain(servers, drainTimeout)
+			log.Print("upgraded; exiting")
+			close(done)
+			return
+		}
+	}()
+	return done
+}
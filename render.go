@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// pageRenderer renders pages, the AppContext of a request, in one media type.
+type pageRenderer struct {
+	MediaType string
+	// render writes app with the status code status. Renderers for clients other than
+	// browsers answer pages with an error and status 200 OK with 404 Not Found.
+	render func(w http.ResponseWriter, req *http.Request, status int, app *AppContext)
+}
+
+// pageRenderers are the renderers of the pages supporting content negotiation, see render,
+// in order of preference.
+var pageRenderers = []pageRenderer{
+	{"text/html", renderHTML},
+	{"application/json", renderJSON},
+	{"text/plain", renderText},
+}
+
+// negotiateRenderer returns the renderer for the media type req prefers in its Accept
+// header. If it accepts any media type, terminal clients get plain text and others HTML;
+// if it accepts none of pageRenderers, it gets HTML too.
+func negotiateRenderer(req *http.Request) pageRenderer {
+	// The quality of each renderer is that of the most specific media range matching it.
+	quality := make([]float64, len(pageRenderers))
+	specificity := make([]int, len(pageRenderers))
+	accept := req.Header.Get("Accept")
+	if accept == "" {
+		accept = "*/*"
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		for i, r := range pageRenderers {
+			typ, _, _ := strings.Cut(r.MediaType, "/")
+			s := 0
+			switch mediaRange {
+			case r.MediaType:
+				s = 3
+			case typ + "/*":
+				s = 2
+			case "*/*":
+				s = 1
+			}
+			if s > specificity[i] {
+				quality[i], specificity[i] = q, s
+			}
+		}
+	}
+	best := 0
+	for i := range pageRenderers {
+		if quality[i] > quality[best] {
+			best = i
+		}
+	}
+	if quality[best] == 0 {
+		return pageRenderers[0]
+	}
+	if specificity[best] == 1 && isTerminalClient(req) {
+		return pageRenderers[len(pageRenderers)-1]
+	}
+	return pageRenderers[best]
+}
+
+// render writes app with the status code status, in the media type negotiated with req.
+func render(w http.ResponseWriter, req *http.Request, status int, app *AppContext) {
+	w.Header().Add("Vary", "Accept")
+	negotiateRenderer(req).render(w, req, status, app)
+}
+
+// renderHTML renders app with its template, see renderTemplate.
+func renderHTML(w http.ResponseWriter, _ *http.Request, status int, app *AppContext) {
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	renderTemplate(w, app)
+}
+
+// SearchResult is the result of a search, as rendered by renderJSON.
+type SearchResult struct {
+	Query        string        `json:"query"`
+	Lang         string        `json:"lang"`
+	Words        []Word        `json:"words"`
+	AlsoSearched []string      `json:"alsoSearched,omitempty"`
+	Related      *RelatedWords `json:"related,omitempty"`
+	AsOf         string        `json:"asOf,omitempty"`
+}
+
+// SearchErrorDetails are the details of the APIError of a search that failed.
+type SearchErrorDetails struct {
+	Title string `json:"title"`
+	// Suggestions are the words the searched word was probably meant to be.
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// renderJSON renders app as a SearchResult, or an APIError if it has an error.
+func renderJSON(w http.ResponseWriter, req *http.Request, status int, app *AppContext) {
+	if app.Error != nil {
+		if status == http.StatusOK {
+			status = http.StatusNotFound
+		}
+		writeError(w, req, status, app.Error.Message, SearchErrorDetails{Title: app.Error.Title, Suggestions: app.Suggestions})
+		return
+	}
+	words := app.Words
+	if words == nil {
+		words = []Word{}
+	}
+	writeJSON(w, status, SearchResult{
+		Query:        app.Query,
+		Lang:         app.Lang,
+		Words:        words,
+		AlsoSearched: app.AlsoSearched,
+		Related:      app.Related,
+		AsOf:         app.AsOf,
+	})
+}
+
+// renderText renders app as plain text for terminals, see writeWordsStyled, wrapped at
+// terminalWidth. Terminal clients get ANSI colors, unless the "color" query argument is
+// "0"; other clients only get them if it is "1".
+func renderText(w http.ResponseWriter, req *http.Request, status int, app *AppContext) {
+	p := requestParams(req)
+	color := p.oneOf("color", "", "0", "1")
+	if !p.check(w) {
+		return
+	}
+	style := textStyle{Color: isTerminalClient(req), Width: terminalWidth}
+	if color != "" {
+		style.Color = color == "1"
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if app.Error != nil {
+		if status == http.StatusOK {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		fmt.Fprintln(w, style.paint(app.Error.Title, ansiBold))
+		fmt.Fprintln(w, app.Error.Message)
+		if len(app.Suggestions) > 0 {
+			fmt.Fprintf(w, "Did you mean: %s?\n", strings.Join(app.Suggestions, ", "))
+		}
+		return
+	}
+	w.WriteHeader(status)
+	writeWordsStyled(w, app.Words, style)
+	if len(app.AlsoSearched) > 0 {
+		fmt.Fprintln(w)
+		style.writeLine(w, 0, "people also looked up: ", strings.Join(app.AlsoSearched, ", "), "")
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// replHelp is printed by the ":help" command of the REPL.
+const replHelp = `Type a word to look it up. Commands:
+  :syn   synonyms of the current word
+  :ant   antonyms of the current word
+  :ex    examples of the current word
+  :help  this help
+  :quit  quit, as does Ctrl+D
+Tab completes words from the autocomplete word list and the cache.
+`
+
+// repl is the state of an interactive lookup session.
+type repl struct {
+	provider Provider
+	// completions are the words offered by tab completion, sorted.
+	completions []string
+	word        string
+	words       []Word
+}
+
+// collectStrings returns the distinct strings selected by get from all meanings and
+// definitions in words, in order of appearance.
+func collectStrings(words []Word, get func(m *Meaning, d *Definition) []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, w := range words {
+		for i := range w.Meanings {
+			m := &w.Meanings[i]
+			candidates := get(m, nil)
+			for j := range m.Definitions {
+				candidates = append(candidates, get(m, &m.Definitions[j])...)
+			}
+			for _, s := range candidates {
+				if s != "" && !seen[s] {
+					seen[s] = true
+					result = append(result, s)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// eval runs a single line of input and writes the output to w. It returns false if the
+// session should end.
+func (r *repl) eval(w io.Writer, line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return true
+	}
+	if !strings.HasPrefix(line, ":") {
+		words, errResp, err := searchWord(context.Background(), line, r.provider)
+		switch {
+		case errResp != nil:
+			fmt.Fprintln(w, errResp.Title)
+			return true
+		case err != nil:
+			log.Print(err)
+			fmt.Fprintf(w, "Failed to look up %s\n", line)
+			return true
+		}
+		r.word, r.words = line, words
+		writeWordsText(w, r.words)
+		return true
+	}
+
+	var get func(m *Meaning, d *Definition) []string
+	what := ""
+	switch line {
+	case ":q", ":quit":
+		return false
+	case ":help":
+		fmt.Fprint(w, replHelp)
+		return true
+	case ":syn":
+		what = "synonyms"
+		get = func(m *Meaning, d *Definition) []string {
+			if d == nil {
+				return m.Synonyms
+			}
+			return d.Synonyms
+		}
+	case ":ant":
+		what = "antonyms"
+		get = func(m *Meaning, d *Definition) []string {
+			if d == nil {
+				return m.Antonyms
+			}
+			return d.Antonyms
+		}
+	case ":ex":
+		what = "examples"
+		get = func(m *Meaning, d *Definition) []string {
+			if d == nil {
+				return nil
+			}
+			return []string{d.Example}
+		}
+	default:
+		fmt.Fprintf(w, "unknown command %s, see :help\n", line)
+		return true
+	}
+	if r.word == "" {
+		fmt.Fprintln(w, "no word looked up yet")
+		return true
+	}
+	found := collectStrings(r.words, get)
+	if len(found) == 0 {
+		fmt.Fprintf(w, "no %s for %s\n", what, r.word)
+		return true
+	}
+	if what == "examples" {
+		for _, s := range found {
+			fmt.Fprintf(w, "  %s\n", s)
+		}
+		return true
+	}
+	fmt.Fprintf(w, "%s\n", strings.Join(found, ", "))
+	return true
+}
+
+// complete is the tab completion callback of the terminal. It completes the input to the
+// longest common prefix of the matching words.
+func (r *repl) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || pos != len(line) || line == "" || strings.HasPrefix(line, ":") {
+		return "", 0, false
+	}
+	i := sort.SearchStrings(r.completions, line)
+	common := ""
+	for ; i < len(r.completions) && strings.HasPrefix(r.completions[i], line); i++ {
+		if common == "" {
+			common = r.completions[i]
+			continue
+		}
+		for !strings.HasPrefix(r.completions[i], common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(common) <= len(line) {
+		return "", 0, false
+	}
+	return common, len(common), true
+}
+
+// replCompletions returns the words for tab completion: the autocomplete word list, if
+// one is installed, and the cached words.
+func replCompletions(cache *entryCache, dataDir string) []string {
+	words, err := cache.words(defaultLanguage, "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to read cached words:", err)
+	}
+	if dataDir != "" {
+		list, ok, err := activeWordList(dataDir, "autocomplete")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to read word list:", err)
+		} else if ok {
+			words = append(words, list...)
+		}
+	}
+	sort.Strings(words)
+	unique := words[:0]
+	for i, w := range words {
+		if i == 0 || w != words[i-1] {
+			unique = append(unique, w)
+		}
+	}
+	return unique
+}
+
+// replMain implements the "repl" subcommand, an interactive prompt for looking up words.
+// On a terminal, it supports line editing, history and tab completion; otherwise it
+// reads one word or command per line, which makes it scriptable.
+func replMain(config AppConfig, args []string) {
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	verbose := fs.Bool("v", false, "log upstream requests")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s repl [flags]\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	if len(parseFlags(fs, args)) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	cache := openCache(config.initCacheDir())
+	r := &repl{
+		provider:    config.lookupProvider(cache),
+		completions: replCompletions(cache, initDataDir()),
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() && r.eval(os.Stdout, scanner.Text()) {
+		}
+		return
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to set up terminal:", err)
+		os.Exit(1)
+	}
+	defer term.Restore(fd, state)
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "godict> ")
+	t.AutoCompleteCallback = r.complete
+	if w, h, err := term.GetSize(fd); err == nil && w > 0 {
+		t.SetSize(w, h)
+	}
+	fmt.Fprint(t, "Type a word to look it up, :help for commands.\n")
+	for {
+		line, err := t.ReadLine()
+		if err != nil || !r.eval(t, line) {
+			return
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The "rpc" subcommand speaks JSON-RPC 2.0 on stdin and stdout, framed like the Language
+// Server Protocol: each message is preceded by a "Content-Length" header and an empty
+// line. Editor plugins spawn it to show definitions of the word at point. Methods:
+//
+//	define   {"word": "set", "lang": "en"}         the definition of a word
+//	hover    {"line": "a set of", "column": 3}     the definition of the word at the
+//	                                               column (in characters) of the line
+//	shutdown, exit                                 end the session
+//
+// define and hover return an rpcDefinition, or null if the word is not found.
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcLookupFailed   = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// rpcResponse is a response to a request. Exactly one of Result and Error is set.
+type rpcResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      json.RawMessage  `json:"id"`
+	Result  *json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+// rpcDefinition is the result of the define and hover methods.
+type rpcDefinition struct {
+	Word string `json:"word"`
+	// Markdown is the definition rendered for display in a popup.
+	Markdown string `json:"markdown"`
+	Entries  []Word `json:"entries"`
+	// Start and End are the columns of the word in the line, for hover only.
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// readRPCMessage reads a single framed message from r.
+func readRPCMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length: %s", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("missing Content-Length")
+	}
+	data := make([]byte, length)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+// writeRPCMessage writes v as a single framed message to w.
+func writeRPCMessage(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// wordAt returns the word at column, counted in characters, of line and its start and end
+// columns. The word is empty if there is none at the column.
+func wordAt(line string, column int) (string, int, int) {
+	runes := []rune(line)
+	isWordRune := func(i int) bool {
+		return i >= 0 && i < len(runes) && (unicode.IsLetter(runes[i]) || runes[i] == '\'' || runes[i] == '-')
+	}
+	if !isWordRune(column) {
+		// The cursor may be just after the word.
+		column--
+	}
+	if !isWordRune(column) {
+		return "", 0, 0
+	}
+	start, end := column, column
+	for isWordRune(start - 1) {
+		start--
+	}
+	for isWordRune(end) {
+		end++
+	}
+	return strings.Trim(string(runes[start:end]), "'-"), start, end
+}
+
+// rpcServer answers the requests of an rpc session.
+type rpcServer struct {
+	provider Provider
+}
+
+// define looks up word in language lang.
+func (s *rpcServer) define(word, lang string) (*rpcDefinition, *rpcError) {
+	if lang == "" {
+		lang = defaultLanguage
+	}
+	if !validLanguage(lang) {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "unsupported language: " + lang}
+	}
+	words, err := s.provider.Lookup(withLanguage(context.Background(), lang), strings.ToLower(word))
+	var providerErr *ProviderError
+	switch {
+	case errors.As(err, &providerErr):
+		return nil, nil
+	case err != nil:
+		return nil, &rpcError{Code: rpcLookupFailed, Message: err.Error()}
+	}
+	var md strings.Builder
+	writeWordsMarkdown(&md, words)
+	return &rpcDefinition{Word: word, Markdown: md.String(), Entries: words}, nil
+}
+
+// handle returns the result of req.
+func (s *rpcServer) handle(req *rpcRequest) (any, *rpcError) {
+	switch req.Method {
+	case "define":
+		var params struct {
+			Word string `json:"word"`
+			Lang string `json:"lang"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.Word == "" {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "expected {\"word\": string, \"lang\": string}"}
+		}
+		d, rerr := s.define(params.Word, params.Lang)
+		if d == nil {
+			return nil, rerr
+		}
+		return d, rerr
+	case "hover":
+		var params struct {
+			Line   string `json:"line"`
+			Column int    `json:"column"`
+			Lang   string `json:"lang"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil || !utf8.ValidString(params.Line) {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "expected {\"line\": string, \"column\": number, \"lang\": string}"}
+		}
+		word, start, end := wordAt(params.Line, params.Column)
+		if word == "" {
+			return nil, nil
+		}
+		d, rerr := s.define(word, params.Lang)
+		if d == nil {
+			return nil, rerr
+		}
+		d.Start, d.End = start, end
+		return d, nil
+	case "shutdown":
+		return nil, nil
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: "unknown method: " + req.Method}
+}
+
+// rpc implements the "rpc" subcommand.
+func rpc(config AppConfig, args []string) {
+	fs := flag.NewFlagSet("rpc", flag.ExitOnError)
+	verbose := fs.Bool("v", false, "log to stderr")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s rpc [flags]\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	if len(parseFlags(fs, args)) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	s := &rpcServer{provider: config.lookupProvider(openCache(config.initCacheDir()))}
+	in := bufio.NewReader(os.Stdin)
+	for {
+		data, err := readRPCMessage(in)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Print("failed to read message: ", err)
+			return
+		}
+		var req rpcRequest
+		resp := rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null")}
+		switch {
+		case json.Unmarshal(data, &req) != nil:
+			resp.Error = &rpcError{Code: rpcParseError, Message: "invalid JSON"}
+		case req.JSONRPC != "2.0" || req.Method == "":
+			resp.Error = &rpcError{Code: rpcInvalidRequest, Message: "not a JSON-RPC 2.0 request"}
+		case req.Method == "exit":
+			return
+		default:
+			result, rerr := s.handle(&req)
+			// Notifications are not answered.
+			if req.ID == nil {
+				continue
+			}
+			resp.ID = req.ID
+			if resp.Error = rerr; rerr == nil {
+				data, err := json.Marshal(result)
+				if err != nil {
+					log.Print("failed to encode result: ", err)
+					data = []byte("null")
+				}
+				raw := json.RawMessage(data)
+				resp.Result = &raw
+			}
+		}
+		if err := writeRPCMessage(os.Stdout, resp); err != nil {
+			log.Print("failed to write message: ", err)
+			return
+		}
+	}
+}
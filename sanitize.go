@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxCacheFileName is the maximum length of a cache file name; longer names are hashed.
+// Most file systems allow 255 bytes.
+const maxCacheFileName = 200
+
+// normalizeWord returns the canonical form of word, which is used as its cache key and
+// sent upstream: Unicode NFC, lower case, without control characters and with runs of
+// white space collapsed to a single space. This way, differently typed or encoded
+// searches for the same word share a cache entry.
+func normalizeWord(word string) string {
+	word = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, word)
+	return strings.ToLower(norm.NFC.String(strings.Join(strings.Fields(word), " ")))
+}
+
+// cacheFileName returns a file name for key that is safe to use in a cache directory: it
+// is percent-encoded so that it contains no slashes and does not start with a dot, which
+// rules out "." and "..", and hashed if it would be too long.
+func cacheFileName(key string) string {
+	name := url.PathEscape(key)
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+	if name == "" || len(name) > maxCacheFileName {
+		sum := sha256.Sum256([]byte(key))
+		name = "sha256-" + hex.EncodeToString(sum[:])
+	}
+	return name
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// schemaPrefix is the path prefix of the JSON Schemas of the API. Requests to
+// "/api/schema" return all of them as one document, with a definition for each type in
+// "$defs", and requests to schemaPrefix + "{type}", e.g. "/api/schema/Word", a standalone
+// schema of one type.
+const schemaPrefix = "/api/schema/"
+
+// jsonSchemaDialect is the version of JSON Schema the schemas are written in.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaTypes are the types returned by the API, by the names of their schemas. The
+// schemas are generated from the Go types, see schemaGenerator, so that they always match
+// what is served.
+var schemaTypes = []struct {
+	Name string
+	Type reflect.Type
+}{
+	{"Entries", reflect.TypeOf([]Word{})},
+	{"Word", reflect.TypeOf(Word{})},
+	{"Suggestions", reflect.TypeOf(Suggestions{})},
+	{"IndexPage", reflect.TypeOf(IndexPage{})},
+	{"NgramSeries", reflect.TypeOf(NgramSeries{})},
+	{"RelatedWords", reflect.TypeOf(RelatedWords{})},
+	{"SearchResult", reflect.TypeOf(SearchResult{})},
+	{"Job", reflect.TypeOf(jobStatus{})},
+	{"APIError", reflect.TypeOf(APIError{})},
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaGenerator generates JSON Schemas of Go types, as they are encoded by
+// encoding/json. Named struct types are put in defs and referred to by name.
+type schemaGenerator struct {
+	names map[reflect.Type]string
+	defs  map[string]any
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	g := &schemaGenerator{names: make(map[reflect.Type]string), defs: make(map[string]any)}
+	for _, t := range schemaTypes {
+		g.names[t.Type] = t.Name
+	}
+	return g
+}
+
+// name returns the name of the schema of the struct type t.
+func (g *schemaGenerator) name(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	r := []rune(t.Name())
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// schema returns the schema of values of type t.
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]any{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := g.name(t)
+		if _, ok := g.defs[name]; !ok {
+			// The name is taken before the fields are generated, for recursive types.
+			g.defs[name] = nil
+			g.defs[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	// Interfaces can hold any value.
+	return map[string]any{}
+}
+
+// object returns the schema of the struct type t. Fields without "omitempty" are always
+// present, and those that encoding/json encodes as null when unset may be null.
+func (g *schemaGenerator) object(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		s := g.schema(f.Type)
+		omitEmpty := strings.Contains(","+opts+",", ",omitempty,")
+		if !omitEmpty {
+			required = append(required, name)
+			switch f.Type.Kind() {
+			case reflect.Pointer, reflect.Slice, reflect.Map:
+				s = nullable(s)
+			}
+		}
+		properties[name] = s
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// nullable returns the schema s allowing null too.
+func nullable(s map[string]any) map[string]any {
+	if typ, ok := s["type"].(string); ok {
+		n := make(map[string]any, len(s))
+		for k, v := range s {
+			n[k] = v
+		}
+		n["type"] = []string{typ, "null"}
+		return n
+	}
+	return map[string]any{"anyOf": []any{s, map[string]any{"type": "null"}}}
+}
+
+// apiSchemas returns one document with the schemas of all schemaTypes in "$defs".
+func apiSchemas() map[string]any {
+	g := newSchemaGenerator()
+	for _, t := range schemaTypes {
+		if s := g.schema(t.Type); s["$ref"] == nil {
+			g.defs[t.Name] = s
+		}
+	}
+	return map[string]any{
+		"$schema": jsonSchemaDialect,
+		"title":   "Godict API",
+		"$defs":   g.defs,
+	}
+}
+
+// apiSchema returns the standalone schema of the schemaTypes type name.
+func apiSchema(name string) (map[string]any, bool) {
+	for _, t := range schemaTypes {
+		if t.Name != name {
+			continue
+		}
+		g := newSchemaGenerator()
+		s := g.schema(t.Type)
+		s["$schema"] = jsonSchemaDialect
+		s["title"] = name
+		if len(g.defs) > 0 {
+			s["$defs"] = g.defs
+		}
+		return s, true
+	}
+	return nil, false
+}
+
+// handleSchema handles requests to "/api/schema" and schemaPrefix.
+func handleSchema(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, "/api/schema"), "/")
+	if name == "" {
+		w.Header().Set("Content-Type", "application/schema+json")
+		json.NewEncoder(w).Encode(apiSchemas())
+		return
+	}
+	s, ok := apiSchema(name)
+	if !ok {
+		writeError(w, req, http.StatusNotFound, "No such schema.", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// schemaCommand implements the "schema" subcommand, which writes the JSON Schemas of the
+// API, like "/api/schema", for generating clients without a running instance.
+func schemaCommand(args []string) {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s schema [type]\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	args = parseFlags(fs, args)
+	var s map[string]any
+	switch len(args) {
+	case 0:
+		s = apiSchemas()
+	case 1:
+		var ok bool
+		if s, ok = apiSchema(args[0]); !ok {
+			fmt.Fprintln(os.Stderr, "no such schema:", args[0])
+			os.Exit(1)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to write schema:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// shadow sends a sample of lookups to a secondary upstream in the background and logs
+// how its normalized results differ from those of the primary upstream. This helps to
+// evaluate switching upstreams without affecting users. A nil *shadow does nothing.
+type shadow struct {
+	upstream *Upstream
+	// sample is the fraction of lookups compared, between 0 and 1.
+	sample float64
+}
+
+// initShadow returns the shadow upstream configured by the environment variables starting
+// with GODICT_SHADOW_API, analogous to those of AppConfig.newUpstream, and $GODICT_SHADOW_SAMPLE,
+// the fraction of lookups to compare (0.1 by default). If $GODICT_SHADOW_API_URL is not
+// set, nil is returned.
+func initShadow() *shadow {
+	u := upstreamFromEnv("GODICT_SHADOW_API", "")
+	if u == nil {
+		return nil
+	}
+	s := &shadow{upstream: u, sample: 0.1}
+	if v := os.Getenv("GODICT_SHADOW_SAMPLE"); v != "" {
+		sample, err := strconv.ParseFloat(v, 64)
+		if err != nil || sample < 0 || sample > 1 {
+			log.Fatalf("invalid sample in $GODICT_SHADOW_SAMPLE: %s", v)
+		}
+		s.sample = sample
+	}
+	log.Printf("shadow upstream: %s, sampling %g of lookups", u.BaseURL, s.sample)
+	return s
+}
+
+// compare compares the primary result for word in language lang, given by the entries
+// and the error returned by the provider, with the result of the shadow upstream, if the
+// lookup is sampled. The shadow request is sent in the background. Lookups that failed
+// without a response from the primary upstream are not compared.
+func (s *shadow) compare(word, lang string, primary []Word, primaryErr error) {
+	if s == nil || rand.Float64() >= s.sample {
+		return
+	}
+	status := http.StatusOK
+	if primaryErr != nil {
+		var providerErr *ProviderError
+		if !errors.As(primaryErr, &providerErr) {
+			return
+		}
+		status = providerErr.Status
+	}
+	go func() {
+		shadowStatus, shadowData, _, err := s.upstream.fetch(context.Background(), word, lang)
+		if err != nil {
+			log.Printf("shadow %s: %s", word, err)
+			return
+		}
+		if status/100 != 2 || shadowStatus/100 != 2 {
+			if status != shadowStatus {
+				log.Printf("shadow %s: status %d, primary %d", word, shadowStatus, status)
+			}
+			return
+		}
+		var secondary []Word
+		if err := json.Unmarshal(shadowData, &secondary); err != nil {
+			log.Printf("shadow %s: invalid response: %s", word, err)
+			return
+		}
+		diffs := diffWords(primary, secondary)
+		if len(diffs) == 0 {
+			log.Printf("shadow %s: same result", word)
+			return
+		}
+		log.Printf("shadow %s: %d differences: %s", word, len(diffs), strings.Join(diffs, "; "))
+	}()
+}
+
+// diffWords returns a description of each difference between the entries a and b.
+// Entries and their meanings are compared by position.
+func diffWords(a, b []Word) []string {
+	var diffs []string
+	if len(a) != len(b) {
+		diffs = append(diffs, fmt.Sprintf("%d entries vs %d", len(a), len(b)))
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		wa, wb := a[i], b[i]
+		if wa.Word != wb.Word {
+			diffs = append(diffs, fmt.Sprintf("entry %d: word %q vs %q", i+1, wa.Word, wb.Word))
+		}
+		if len(wa.Phonetics) != len(wb.Phonetics) {
+			diffs = append(diffs, fmt.Sprintf("entry %d: %d phonetics vs %d", i+1, len(wa.Phonetics), len(wb.Phonetics)))
+		}
+		if len(wa.Meanings) != len(wb.Meanings) {
+			diffs = append(diffs, fmt.Sprintf("entry %d: %d meanings vs %d", i+1, len(wa.Meanings), len(wb.Meanings)))
+		}
+		for j := 0; j < len(wa.Meanings) && j < len(wb.Meanings); j++ {
+			ma, mb := wa.Meanings[j], wb.Meanings[j]
+			where := fmt.Sprintf("entry %d, meaning %d", i+1, j+1)
+			if ma.PartOfSpeech != mb.PartOfSpeech {
+				diffs = append(diffs, fmt.Sprintf("%s: part of speech %q vs %q", where, ma.PartOfSpeech, mb.PartOfSpeech))
+			}
+			if len(ma.Definitions) != len(mb.Definitions) {
+				diffs = append(diffs, fmt.Sprintf("%s: %d definitions vs %d", where, len(ma.Definitions), len(mb.Definitions)))
+			}
+			for k := 0; k < len(ma.Definitions) && k < len(mb.Definitions); k++ {
+				if ma.Definitions[k].Definition != mb.Definitions[k].Definition {
+					diffs = append(diffs, fmt.Sprintf("%s: definition %d differs", where, k+1))
+				}
+			}
+		}
+	}
+	return diffs
+}
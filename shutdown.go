@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// drain stops servers from accepting connections and waits until the requests in progress
+// are answered, for at most timeout. Streams of server-sent events are ended, see
+// stopStreams.
+func drain(servers []*http.Server, timeout time.Duration) {
+	stopStreams()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				log.Print("failed to finish requests in progress: ", err)
+			}
+		}(server)
+	}
+	wg.Wait()
+}
+
+// shutdownOnSignal shuts servers down gracefully when the process receives SIGINT or
+// SIGTERM, see drain. The returned channel is closed once the requests in progress are
+// answered.
+func shutdownOnSignal(servers []*http.Server, drainTimeout time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		log.Printf("received %s; shutting down", sig)
+		drain(servers, drainTimeout)
+		close(done)
+	}()
+	return done
+}
+
+// flushCache waits for the background refreshes of upstream to write their cache entries,
+// for at most timeout, and closes cache.
+func flushCache(upstream *Upstream, cache *entryCache, timeout time.Duration) {
+	refreshed := make(chan struct{})
+	go func() {
+		upstream.refreshes.Wait()
+		close(refreshed)
+	}()
+	select {
+	case <-refreshed:
+	case <-time.After(timeout):
+		log.Print("gave up waiting for cache refreshes")
+	}
+	if err := cache.close(); err != nil {
+		log.Print("failed to close cache: ", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Snapshots are the versions of cache entries, kept if enabled so that changes of the
+// upstream definitions can be reviewed: a word can be looked up as it was on a given date.
+// Each version is stored once, with the time it was first fetched.
+
+// asOfLayout is the format of the dates of the "asof" query argument.
+const asOfLayout = "2006-01-02"
+
+// createSnapshots creates the table of snapshots, if needed.
+func createSnapshots(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS snapshots (
+			word TEXT NOT NULL,
+			lang TEXT NOT NULL,
+			payload BLOB NOT NULL,
+			since INTEGER NOT NULL,
+			PRIMARY KEY (word, lang, since)
+		);`)
+	return err
+}
+
+// addSnapshot records data as the version of the entry of word in language lang fetched
+// now, unless it is the same as the last version. For entries cached before snapshots
+// were enabled, the cached version is recorded first.
+func (c *entryCache) addSnapshot(word, lang string, data []byte) error {
+	now := time.Now().Unix()
+	var last []byte
+	err := c.db.QueryRow(`SELECT payload FROM snapshots WHERE word = ? AND lang = ? ORDER BY since DESC LIMIT 1`, word, lang).Scan(&last)
+	if err == sql.ErrNoRows {
+		var fetched int64
+		err = c.db.QueryRow(`SELECT payload, fetched_at FROM entries WHERE word = ? AND lang = ?`, word, lang).Scan(&last, &fetched)
+		switch {
+		case err == sql.ErrNoRows:
+			last, err = nil, nil
+		case err == nil && bytes.Equal(last, data):
+			// The entry did not change since it was first cached.
+			now = fetched
+			last = nil
+		case err == nil:
+			_, err = c.db.Exec(`INSERT OR IGNORE INTO snapshots (word, lang, payload, since) VALUES (?, ?, ?, ?)`, word, lang, last, fetched)
+		}
+	}
+	if err != nil || bytes.Equal(last, data) {
+		return err
+	}
+	_, err = c.db.Exec(`INSERT OR REPLACE INTO snapshots (word, lang, payload, since) VALUES (?, ?, ?, ?)`, word, lang, data, now)
+	return err
+}
+
+// snapshot returns the version of the entry of word in language lang that was current
+// at t. It returns errCacheMiss if there is none.
+func (c *entryCache) snapshot(word, lang string, t time.Time) ([]byte, error) {
+	if c == nil {
+		return nil, errCacheMiss
+	}
+	var data []byte
+	err := c.db.QueryRow(`SELECT payload FROM snapshots WHERE word = ? AND lang = ? AND since <= ? ORDER BY since DESC LIMIT 1`, word, lang, t.Unix()).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, errCacheMiss
+	}
+	return data, err
+}
+
+// setSnapshots enables or disables keeping snapshots of entries.
+func (c *entryCache) setSnapshots(enabled bool) {
+	if c != nil {
+		c.snapshots = enabled
+	}
+}
+
+type asOfKey struct{}
+
+// withAsOf returns a copy of ctx asking for lookups of the entries as they were at t,
+// from the snapshots.
+func withAsOf(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, asOfKey{}, t)
+}
+
+// asOfFrom returns the time lookups with context ctx ask for, see withAsOf. The second
+// return value is false for lookups of the current entries.
+func asOfFrom(ctx context.Context) (time.Time, bool) {
+	t, ok := ctx.Value(asOfKey{}).(time.Time)
+	return t, ok
+}
+
+// asOf returns the end of the day given by the parameter name, in the format of
+// asOfLayout, for withAsOf. The second return value is false if it is missing or invalid.
+func (p *params) asOf(name string) (time.Time, bool) {
+	s := p.value(name)
+	if s == "" {
+		return time.Time{}, false
+	}
+	day, err := time.ParseInLocation(asOfLayout, s, time.Local)
+	if err != nil {
+		p.fail(name, "must be a date like 2006-01-02")
+		return time.Time{}, false
+	}
+	return day.AddDate(0, 0, 1).Add(-time.Second), true
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The "spell" subcommand speaks the pipe mode of Ispell and Hunspell ("hunspell -a") on
+// stdin and stdout, so that editors can use godict as a spell checker, e.g. Emacs with
+// ispell-program-name set to a script running "godict spell" with its arguments, or
+// Enchant with its Ispell backend. It prints a banner, and then answers each line of text
+// with a line for each word, followed by an empty line:
+//
+//	*                               the word is spelled correctly
+//	& word count offset: s1, s2     the word is misspelled; suggestions follow
+//	# word offset                   the word is misspelled, without suggestions
+//
+// Offsets are in characters, from the start of the line. Lines starting with one of the
+// following characters are commands, which are not answered:
+//
+//	*word   add the word to the personal dictionary
+//	&word   add the word to the personal dictionary, in lower case
+//	@word   accept the word for the rest of the session
+//	#       save the personal dictionary
+//	!       terse mode: do not answer correctly spelled words
+//	%       leave terse mode
+//	+, -, ~ set the input format, which is ignored
+//	^text   check the text, even if it starts with a command character
+//
+// As an extension, "?word" is answered with the definitions of the word, each line
+// prefixed with "? ", followed by an empty line; words that are not found get a lone "?".
+
+// spellBanner is the first line of output, which editors check for the version.
+const spellBanner = "@(#) International Ispell Version 3.2.06 (but really godict)"
+
+// spellDictionaryFile is the personal dictionary in the data dir, with one word per line.
+const spellDictionaryFile = "dictionary.txt"
+
+// speller checks the spelling of the words of a spell session.
+type speller struct {
+	provider Provider
+	lang     string
+	// words is the word list selected for the "spell" feature, if any, see
+	// activeWordList. Words not in it are misspelled; without it, words are looked up.
+	words map[string]bool
+	// personal are the words of the personal dictionary, saved to personalFile, and
+	// accepted the words accepted for the session.
+	personal     []string
+	personalFile string
+	accepted     map[string]bool
+	// known caches whether words were found by the provider.
+	known map[string]bool
+	terse bool
+}
+
+// correct reports whether word is spelled correctly: if it is accepted, in the word list
+// or bundled word list, or found by the provider. Words in upper case, like acronyms, are
+// checked in lower case too.
+func (s *speller) correct(ctx context.Context, word string) bool {
+	lower := strings.ToLower(word)
+	if s.accepted[word] || s.accepted[lower] {
+		return true
+	}
+	if s.words != nil {
+		return s.words[word] || s.words[lower]
+	}
+	if s.lang == defaultLanguage {
+		commonWordsOnce.Do(func() { commonWords = dataLines(wordsData) })
+		if contains(commonWords, lower) {
+			return true
+		}
+	}
+	ok, seen := s.known[lower]
+	if !seen {
+		_, err := s.provider.Lookup(withLanguage(ctx, s.lang), lower)
+		var providerErr *ProviderError
+		if err != nil && !errors.As(err, &providerErr) {
+			// Words are not reported as misspelled when the dictionary cannot be reached.
+			log.Printf("failed to look up %s: %s", word, err)
+			return true
+		}
+		ok = err == nil
+		s.known[lower] = ok
+	}
+	return ok
+}
+
+// suggestions returns the words that word was probably meant to be, see
+// spellingSuggestions, capitalized like word.
+func (s *speller) suggestions(word string) []string {
+	if s.lang != defaultLanguage {
+		return nil
+	}
+	suggestions := spellingSuggestions(word)
+	if r, _ := utf8.DecodeRuneInString(word); unicode.IsUpper(r) {
+		for i, sugg := range suggestions {
+			r, n := utf8.DecodeRuneInString(sugg)
+			suggestions[i] = string(unicode.ToUpper(r)) + sugg[n:]
+		}
+	}
+	return suggestions
+}
+
+// accept accepts word for the session, adding it to the personal dictionary if add is set.
+func (s *speller) accept(word string, add bool) {
+	if word == "" {
+		return
+	}
+	s.accepted[word] = true
+	if add && !contains(s.personal, word) {
+		s.personal = append(s.personal, word)
+	}
+}
+
+// save writes the personal dictionary to personalFile.
+func (s *speller) save() error {
+	if s.personalFile == "" {
+		return errors.New("no data dir")
+	}
+	tmp := s.personalFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(s.personal, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.personalFile)
+}
+
+// spellWords returns the words of line and their offsets in characters. Words are runs of
+// letters, which may contain apostrophes and hyphens, like "don't" and "well-known".
+func spellWords(line string) ([]string, []int) {
+	var words []string
+	var offsets []int
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) {
+			i++
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && (unicode.IsLetter(runes[end]) ||
+			(runes[end] == '\'' || runes[end] == '-') && end+1 < len(runes) && unicode.IsLetter(runes[end+1])) {
+			end++
+		}
+		words = append(words, string(runes[i:end]))
+		offsets = append(offsets, i)
+		i = end
+	}
+	return words, offsets
+}
+
+// check writes the answer to a line of text to w.
+func (s *speller) check(ctx context.Context, w io.Writer, line string) {
+	words, offsets := spellWords(line)
+	for i, word := range words {
+		if s.correct(ctx, word) {
+			if !s.terse {
+				fmt.Fprintln(w, "*")
+			}
+			continue
+		}
+		if sugg := s.suggestions(word); len(sugg) > 0 {
+			fmt.Fprintf(w, "& %s %d %d: %s\n", word, len(sugg), offsets[i], strings.Join(sugg, ", "))
+		} else {
+			fmt.Fprintf(w, "# %s %d\n", word, offsets[i])
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// define writes the answer to "?word" to w.
+func (s *speller) define(ctx context.Context, w io.Writer, word string) {
+	words, err := s.provider.Lookup(withLanguage(ctx, s.lang), strings.ToLower(word))
+	if err != nil {
+		log.Printf("failed to look up %s: %s", word, err)
+		fmt.Fprint(w, "?\n\n")
+		return
+	}
+	var text strings.Builder
+	writeWordsText(&text, words)
+	for _, l := range strings.Split(strings.TrimRight(text.String(), "\n"), "\n") {
+		fmt.Fprintln(w, strings.TrimRight("? "+l, " "))
+	}
+	fmt.Fprintln(w)
+}
+
+// handle answers a line of input, writing the answer, if any, to w.
+func (s *speller) handle(ctx context.Context, w io.Writer, line string) {
+	if line == "" {
+		fmt.Fprintln(w)
+		return
+	}
+	arg := strings.TrimSpace(line[1:])
+	switch line[0] {
+	case '*':
+		s.accept(arg, true)
+	case '&':
+		s.accept(strings.ToLower(arg), true)
+	case '@':
+		s.accept(arg, false)
+	case '#':
+		if err := s.save(); err != nil {
+			log.Print("failed to save the personal dictionary: ", err)
+		}
+	case '!':
+		s.terse = true
+	case '%':
+		s.terse = false
+	case '+', '-', '~':
+	case '^':
+		s.check(ctx, w, line[1:])
+	case '?':
+		s.define(ctx, w, arg)
+	default:
+		s.check(ctx, w, line)
+	}
+}
+
+// spellLanguage returns the language of the Hunspell dictionary name dict, like "en_US".
+func spellLanguage(dict string) string {
+	if dict == "" {
+		return defaultLanguage
+	}
+	lang, _, _ := strings.Cut(strings.ToLower(dict), "_")
+	lang, _, _ = strings.Cut(lang, "-")
+	return lang
+}
+
+// spell implements the "spell" subcommand. The flags of Hunspell that editors pass are
+// accepted; only -d and -p have an effect.
+func spell(config AppConfig, args []string) {
+	fs := flag.NewFlagSet("spell", flag.ExitOnError)
+	fs.Bool("a", true, "pipe mode, the only mode (for compatibility)")
+	dict := fs.String("d", "", "dictionary, like en_US; only the language is used")
+	personal := fs.String("p", "", "personal dictionary (default "+spellDictionaryFile+" in the data dir)")
+	version := fs.Bool("v", false, "print the version and exit")
+	version2 := fs.Bool("vv", false, "print the version and exit")
+	for _, name := range []string{"m", "B", "C", "t", "n", "H", "X"} {
+		fs.Bool(name, false, "ignored (for compatibility)")
+	}
+	fs.String("i", "", "input encoding; only UTF-8 is supported")
+	verbose := fs.Bool("log", false, "log to stderr")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s spell [flags]\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	if len(parseFlags(fs, args)) != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *version || *version2 {
+		fmt.Println(spellBanner)
+		return
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	lang := spellLanguage(*dict)
+	if !validLanguage(lang) {
+		fmt.Fprintln(os.Stderr, "unsupported language:", lang)
+		os.Exit(2)
+	}
+	dataDir := initDataDir()
+	s := &speller{
+		provider:     config.lookupProvider(openCache(config.initCacheDir())),
+		lang:         lang,
+		personalFile: *personal,
+		accepted:     make(map[string]bool),
+		known:        make(map[string]bool),
+	}
+	if s.personalFile == "" && dataDir != "" {
+		s.personalFile = path.Join(dataDir, spellDictionaryFile)
+	}
+	if s.personalFile != "" {
+		words, err := readWordList(s.personalFile)
+		if err != nil && !os.IsNotExist(err) {
+			log.Print("failed to read the personal dictionary: ", err)
+		}
+		for _, w := range words {
+			s.accept(w, true)
+		}
+	}
+	if dataDir != "" {
+		words, ok, err := activeWordList(dataDir, "spell")
+		if err != nil {
+			log.Print("failed to read the word list: ", err)
+		} else if ok {
+			s.words = make(map[string]bool, len(words))
+			for _, w := range words {
+				s.words[w] = true
+			}
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	fmt.Fprintln(out, spellBanner)
+	out.Flush()
+	in := bufio.NewScanner(os.Stdin)
+	in.Buffer(nil, 1<<20)
+	for in.Scan() {
+		s.handle(context.Background(), out, strings.TrimRight(in.Text(), "\r"))
+		// Editors wait for the answer to each line.
+		out.Flush()
+	}
+	if err := in.Err(); err != nil {
+		log.Print("failed to read input: ", err)
+	}
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
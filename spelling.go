@@ -0,0 +1,104 @@
+package main
+
+import (
+	_ "embed"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed data/words.txt
+var wordsData string
+
+// maxSpellingSuggestions is the maximum number of "did you mean" suggestions.
+const maxSpellingSuggestions = 5
+
+var (
+	commonWordsOnce sync.Once
+	// commonWords is the bundled word list, most frequent first.
+	commonWords []string
+)
+
+// levenshtein returns the edit distance between a and b, i.e. the number of inserted,
+// deleted or substituted characters needed to turn a into b. Swapping two adjacent
+// characters, a common typo, counts as a single edit.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// The rows of the distance matrix before the previous, the previous and the current.
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] && prev2[j-2]+1 < cur[j] {
+				cur[j] = prev2[j-2] + 1
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// spellingSuggestions returns the English words that word was probably meant to be: its
+// known corrections, see spellingVariants, and the words of the bundled word list within a
+// small edit distance, closest and most frequent first. Words in the bundled word list are
+// spelled correctly, so there are no suggestions for them.
+func spellingSuggestions(word string) []string {
+	commonWordsOnce.Do(func() { commonWords = dataLines(wordsData) })
+	word = strings.ToLower(word)
+	var suggestions []string
+	if v, ok := spellingVariants(word); ok {
+		suggestions = append(suggestions, v.MisspellingOf...)
+	}
+	// Allow one typo in short words and two in longer ones.
+	maxDistance := 1
+	if len([]rune(word)) > 4 {
+		maxDistance = 2
+	}
+	type candidate struct {
+		word     string
+		distance int
+		rank     int
+	}
+	var candidates []candidate
+	for rank, w := range commonWords {
+		if w == word {
+			return suggestions
+		}
+		if d := levenshtein(word, w); d <= maxDistance {
+			candidates = append(candidates, candidate{w, d, rank})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].rank < candidates[j].rank
+	})
+	for _, c := range candidates {
+		suggestions = appendUnique(suggestions, c.word)
+	}
+	if len(suggestions) > maxSpellingSuggestions {
+		suggestions = suggestions[:maxSpellingSuggestions]
+	}
+	return suggestions
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	streamsOnce sync.Once
+	// streams is closed when the server shuts down, ending the streams of server-sent
+	// events, which would otherwise keep it waiting; see stopStreams.
+	streams = make(chan struct{})
+)
+
+// stopStreams ends the streams of server-sent events, see openStream. Clients reconnect,
+// e.g. to the process replacing this one.
+func stopStreams() {
+	streamsOnce.Do(func() { close(streams) })
+}
+
+// openStream prepares w for a stream of server-sent events and returns its http.Flusher.
+// Streams stay open for longer than the WriteTimeout of the server, so its write deadline
+// is lifted; ResponseWriters wrapped by middleware must have an Unwrap method for that,
+// see statusRecorder. Handlers must end the stream when the request is canceled or streams
+// is closed.
+func openStream(w http.ResponseWriter) (http.Flusher, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming is not supported")
+	}
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	return flusher, nil
+}
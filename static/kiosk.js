@@ -0,0 +1,14 @@
+// Shows the words of the kiosk as they are sent by /kiosk/events.
+(function () {
+  var kinds = {wotd: "word of the day", random: "random word", trending: "trending"};
+  var events = new EventSource("/kiosk/events");
+  events.addEventListener("word", function (e) {
+    var word = JSON.parse(e.data);
+    document.getElementById("kiosk-kind").textContent = kinds[word.kind] || "";
+    document.getElementById("kiosk-word").textContent = word.word;
+    document.getElementById("kiosk-phonetic").textContent = word.phonetic || "";
+    document.getElementById("kiosk-pos").textContent = word.partOfSpeech || "";
+    document.getElementById("kiosk-definition").textContent = word.definition || "";
+    document.getElementById("kiosk-example").textContent = word.example || "";
+  });
+})();
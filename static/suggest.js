@@ -0,0 +1,27 @@
+// Offers as-you-type suggestions in the search box, from /api/v1/suggest.
+(function () {
+  var input = document.getElementById("w");
+  var list = document.getElementById("suggestions");
+  var lang = document.querySelector("#search select[name=lang]");
+  var timer;
+  input.addEventListener("input", function () {
+    clearTimeout(timer);
+    timer = setTimeout(function () {
+      var q = input.value.trim();
+      if (q === "") {
+        list.replaceChildren();
+        return;
+      }
+      fetch("/api/v1/suggest?q=" + encodeURIComponent(q) + "&lang=" + encodeURIComponent(lang.value))
+        .then(function (resp) { return resp.ok ? resp.json() : {words: []}; })
+        .then(function (data) {
+          list.replaceChildren.apply(list, data.words.map(function (w) {
+            var option = document.createElement("option");
+            option.value = w;
+            return option;
+          }));
+        })
+        .catch(function () {});
+    }, 200);
+  });
+})();
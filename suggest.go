@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// suggestPath is the path of the suggestions API, which returns words starting with a
+// prefix for as-you-type suggestions in the search box.
+const suggestPath = "/api/suggest"
+
+// suggestLimit is the default and suggestMax the maximum number of suggestions returned.
+const (
+	suggestLimit = 10
+	suggestMax   = 100
+)
+
+// suggester suggests the cached words, and in English also the words of the autocomplete
+// word list, starting with a prefix.
+type suggester struct {
+	cache *entryCache
+	// words are the words of the word list, in lower case and sorted. If the word list
+	// does not fit into the memory for the suggestion index, disk is used to search the
+	// word list file instead.
+	words []string
+	disk  *diskWordList
+}
+
+// suggestDiskCandidates is the number of words, per suggestion requested, read from a word
+// list searched on disk. Unlike the words in memory, not all words starting with a prefix
+// are considered, so the shortest ones may be missing from the suggestions.
+const suggestDiskCandidates = 10
+
+// wordIndexOverhead approximates the memory used by a word in memory besides its letters.
+const wordIndexOverhead = 16
+
+// newSuggester returns a suggester for the words in cache and the autocomplete word list
+// in dataDir, if one is selected. Up to maxBytes of memory are used for the word list.
+func newSuggester(cache *entryCache, dataDir string, maxBytes int64) *suggester {
+	s := &suggester{cache: cache}
+	if dataDir == "" {
+		return s
+	}
+	name, err := activeWordListFile(dataDir, "autocomplete")
+	if err == nil && name != "" {
+		var fits bool
+		if s.words, fits, err = loadWordIndex(name, maxBytes); err == nil && !fits {
+			log.Printf("autocomplete word list exceeds %s of memory; searching it on disk", byteSize(maxBytes))
+			s.words = nil
+			s.disk, err = openDiskWordList(name)
+		}
+	}
+	if err != nil {
+		log.Print("failed to read autocomplete word list: ", err)
+	}
+	return s
+}
+
+// loadWordIndex returns the words of the word list file name in lower case and sorted.
+// The second return value is false if they do not fit into maxBytes, in which case the
+// words read so far are returned.
+func loadWordIndex(name string, maxBytes int64) ([]string, bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	var words []string
+	var size int64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		if size += int64(len(word)) + wordIndexOverhead; size > maxBytes {
+			return words, false, nil
+		}
+		words = append(words, strings.ToLower(word))
+	}
+	sort.Strings(words)
+	return words, true, scanner.Err()
+}
+
+// suggest returns up to limit words in language lang starting with prefix, ignoring case,
+// shortest first.
+func (s *suggester) suggest(lang, prefix string, limit int) ([]string, error) {
+	words, err := s.cache.words(lang, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if lang == defaultLanguage {
+		lower := strings.ToLower(prefix)
+		for i := sort.SearchStrings(s.words, lower); i < len(s.words) && strings.HasPrefix(s.words[i], lower); i++ {
+			words = append(words, s.words[i])
+		}
+		if s.disk != nil {
+			// Word lists are sorted when they are installed, but not lowercased, so
+			// words with upper case letters are only found by a prefix in upper case.
+			found, err := s.disk.withPrefix(prefix, limit*suggestDiskCandidates)
+			if err != nil {
+				return nil, err
+			}
+			for _, w := range found {
+				words = append(words, strings.ToLower(w))
+			}
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) < len(words[j])
+		}
+		return words[i] < words[j]
+	})
+	result := []string{}
+	seen := make(map[string]bool)
+	for _, w := range words {
+		if len(result) == limit {
+			break
+		}
+		if !seen[w] {
+			seen[w] = true
+			result = append(result, w)
+		}
+	}
+	return result, nil
+}
+
+// Suggestions is the response of the suggestions API, see handleSuggest.
+type Suggestions struct {
+	Query string   `json:"query"`
+	Words []string `json:"words"`
+}
+
+// handleSuggest handles requests to the suggestions API. It returns the words starting
+// with the "q" query argument in the language of the "lang" query argument, as
+// Suggestions. The "limit" query argument limits their number, to
+// suggestLimit by default.
+func handleSuggest(s *suggester) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		p := requestParams(req)
+		q := p.str("q", "", maxParamLength)
+		limit := p.integer("limit", suggestLimit, 1, math.MaxInt)
+		if !p.check(w) {
+			return
+		}
+		if limit > suggestMax {
+			limit = suggestMax
+		}
+		words := []string{}
+		if q != "" {
+			var err error
+			if words, err = s.suggest(requestLanguage(req), q, limit); err != nil {
+				log.Print("failed to suggest words: ", err)
+				writeError(w, req, http.StatusInternalServerError, "Failed to read the cache.", nil)
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, Suggestions{Query: q, Words: words})
+	}
+}
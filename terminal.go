@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// terminalWidth is the width the definitions are wrapped at for terminal clients.
+const terminalWidth = 80
+
+// terminalClients are the prefixes of the user agents of command-line HTTP clients, in
+// lower case, which get plain text with ANSI colors; see handleTerminal.
+var terminalClients = []string{"curl/", "wget/", "httpie/"}
+
+// isTerminalClient reports whether req is from one of terminalClients.
+func isTerminalClient(req *http.Request) bool {
+	ua := strings.ToLower(req.UserAgent())
+	for _, c := range terminalClients {
+		if strings.HasPrefix(ua, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsText reports whether req asks for plain text: if it prefers text/plain, or accepts
+// anything and is from a terminal client; see negotiateRenderer.
+func wantsText(req *http.Request) bool {
+	return negotiateRenderer(req).MediaType == "text/plain"
+}
+
+// handleTerminal handles requests to "/" and "/{word}" that want plain text, see wantsText,
+// like "curl localhost:8080/cat". It writes the definitions of the word in the language of
+// the "lang" query argument as plain text, see renderText. Requests to "/" get the usage.
+func handleTerminal(provider Provider) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Vary", "Accept, User-Agent")
+		word := strings.TrimPrefix(req.URL.Path, "/")
+		if word == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprintf(w, "Usage: curl %s/{word}[?lang=de][&color=0]\n", req.Host)
+			return
+		}
+		app := AppContext{Query: word, Lang: requestLanguage(req)}
+		if strings.Contains(word, "/") {
+			app.Error = &ErrorResponse{Title: "Not Found", Message: "Usage: /{word}"}
+			renderText(w, req, http.StatusNotFound, &app)
+			return
+		}
+		logSearch(req.Context(), "handle terminal: %s (%s)", word, app.Lang)
+		words, errResp, err := searchWord(withLanguage(req.Context(), app.Lang), word, provider)
+		if err != nil {
+			log.Print(err)
+			app.Error = &ErrorResponse{Title: "Bad Gateway — " + word, Message: "The dictionary could not be reached or returned an invalid response."}
+			renderText(w, req, http.StatusBadGateway, &app)
+			return
+		}
+		recorderFrom(req.Context()).search(req, word, app.Lang, errResp == nil)
+		app.Words, app.Error = words, errResp
+		if errResp != nil && app.Lang == defaultLanguage {
+			app.Suggestions = spellingSuggestions(word)
+		}
+		renderText(w, req, http.StatusOK, &app)
+	}
+}
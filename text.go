@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// writeWordsText writes words as plain text for terminals, e.g.:
+//
+//	hello /həˈləʊ/
+//	  noun
+//	    1. "Hello!" or an equivalent greeting.
+//	       She said hello.
+func writeWordsText(w io.Writer, words []Word) {
+	writeWordsStyled(w, words, textStyle{})
+}
+
+// textStyle is the style of the plain text written by writeWordsStyled.
+type textStyle struct {
+	// Color enables ANSI colors, and Width wraps lines at that many columns if set.
+	Color bool
+	Width int
+}
+
+// ANSI select graphic rendition codes.
+const (
+	ansiBold   = "1"
+	ansiDim    = "2"
+	ansiItalic = "3"
+	ansiGreen  = "32"
+	ansiYellow = "33"
+	ansiCyan   = "36"
+)
+
+// paint returns text in the ANSI style code, if colors are enabled.
+func (s textStyle) paint(text, code string) string {
+	if !s.Color || text == "" || code == "" {
+		return text
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[0m"
+}
+
+// writeLine writes text in the style code after label, indented by indent columns. If it
+// is longer than s.Width, it is wrapped, with the continuation lines aligned with the
+// start of text.
+func (s textStyle) writeLine(w io.Writer, indent int, label, text, code string) {
+	prefix := strings.Repeat(" ", indent)
+	hang := indent + runewidth.StringWidth(label)
+	var lines []string
+	if s.Width == 0 {
+		lines = []string{text}
+	} else {
+		lines = wrapText(text, s.Width-hang)
+	}
+	for i, line := range lines {
+		if i == 0 {
+			fmt.Fprintln(w, prefix+s.paint(label, ansiDim)+s.paint(line, code))
+		} else {
+			fmt.Fprintln(w, strings.Repeat(" ", hang)+s.paint(line, code))
+		}
+	}
+}
+
+// wrapText breaks text into lines of at most width columns, at spaces. Words longer than
+// width are not broken.
+func wrapText(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && runewidth.StringWidth(line)+1+runewidth.StringWidth(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	return append(lines, line)
+}
+
+// writeWordsStyled writes words as plain text like writeWordsText, in style s.
+func writeWordsStyled(w io.Writer, words []Word, s textStyle) {
+	for i, word := range words {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		line := s.paint(word.Word, ansiBold)
+		if len(word.Phonetics) > 0 && word.Phonetics[0].Text != "" {
+			line += " " + s.paint(word.Phonetics[0].Text, ansiCyan)
+		}
+		fmt.Fprintln(w, line)
+		if word.Etymology != "" {
+			s.writeLine(w, 2, "etymology: ", word.Etymology, "")
+		}
+		for _, m := range word.Meanings {
+			fmt.Fprintln(w, "  "+s.paint(m.PartOfSpeech, ansiYellow))
+			for j, d := range m.Definitions {
+				s.writeLine(w, 4, fmt.Sprintf("%d. ", j+1), d.Definition, "")
+				if d.Example != "" {
+					s.writeLine(w, 7, "", d.Example, ansiGreen)
+				}
+			}
+			if len(m.Synonyms) > 0 {
+				s.writeLine(w, 4, "synonyms: ", strings.Join(m.Synonyms, ", "), ansiItalic)
+			}
+			if m.UsageNotes != "" {
+				s.writeLine(w, 4, "usage notes: ", m.UsageNotes, "")
+			}
+		}
+	}
+}
+
+// writeWordsMarkdown writes words as Markdown, e.g. for hover popups in editors.
+func writeWordsMarkdown(w io.Writer, words []Word) {
+	for i, word := range words {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "**%s**", word.Word)
+		if len(word.Phonetics) > 0 && word.Phonetics[0].Text != "" {
+			fmt.Fprintf(w, " %s", word.Phonetics[0].Text)
+		}
+		fmt.Fprintln(w)
+		for _, m := range word.Meanings {
+			fmt.Fprintf(w, "\n*%s*\n\n", m.PartOfSpeech)
+			for j, d := range m.Definitions {
+				fmt.Fprintf(w, "%d. %s\n", j+1, d.Definition)
+				if d.Example != "" {
+					fmt.Fprintf(w, "   > %s\n", d.Example)
+				}
+			}
+		}
+	}
+}
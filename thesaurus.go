@@ -0,0 +1,119 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// thesaurusPath is the path of the thesaurus view of a word, given by the "word" query
+// argument, which shows the synonyms and antonyms of all its meanings and definitions.
+const thesaurusPath = "/thesaurus"
+
+// Thesaurus is the thesaurus view of a word, for rendering instead of its meanings.
+type Thesaurus struct {
+	Groups []ThesaurusGroup
+}
+
+// ThesaurusGroup are the synonyms and antonyms of the meanings of a word with one part of
+// speech, without duplicates, in the order they are listed in.
+type ThesaurusGroup struct {
+	PartOfSpeech      string
+	PartOfSpeechLabel string
+	Synonyms          []string
+	Antonyms          []string
+}
+
+// newThesaurus returns the thesaurus view of words, which were found for word. The groups
+// are in the order in which their part of speech first occurs, and words are deduplicated
+// ignoring case. The word itself, which some entries list as its own synonym, is left out.
+func newThesaurus(word string, words []Word) *Thesaurus {
+	t := &Thesaurus{}
+	index := make(map[string]int)
+	seen := make(map[string]map[string]bool)
+	add := func(list []string, pos, s string) []string {
+		key := strings.ToLower(strings.TrimSpace(s))
+		if key == "" || key == strings.ToLower(word) || seen[pos][key] {
+			return list
+		}
+		seen[pos][key] = true
+		return append(list, strings.TrimSpace(s))
+	}
+	for _, w := range words {
+		for _, m := range w.Meanings {
+			i, ok := index[m.PartOfSpeech]
+			if !ok {
+				i = len(t.Groups)
+				index[m.PartOfSpeech] = i
+				seen[m.PartOfSpeech] = make(map[string]bool)
+				t.Groups = append(t.Groups, ThesaurusGroup{PartOfSpeech: m.PartOfSpeech, PartOfSpeechLabel: m.PartOfSpeechLabel})
+			}
+			g := &t.Groups[i]
+			// A word listed as both a synonym and an antonym is kept where it occurs first.
+			for _, s := range m.Synonyms {
+				g.Synonyms = add(g.Synonyms, m.PartOfSpeech, s)
+			}
+			for _, s := range m.Antonyms {
+				g.Antonyms = add(g.Antonyms, m.PartOfSpeech, s)
+			}
+			for _, d := range m.Definitions {
+				for _, s := range d.Synonyms {
+					g.Synonyms = add(g.Synonyms, m.PartOfSpeech, s)
+				}
+				for _, s := range d.Antonyms {
+					g.Antonyms = add(g.Antonyms, m.PartOfSpeech, s)
+				}
+			}
+		}
+	}
+	// Parts of speech without any synonyms or antonyms are not shown.
+	groups := t.Groups[:0]
+	for _, g := range t.Groups {
+		if len(g.Synonyms) > 0 || len(g.Antonyms) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	t.Groups = groups
+	return t
+}
+
+// handleThesaurus handles requests to thesaurusPath. It renders the main template like
+// handleSearch, with the Thesaurus of the word instead of its meanings.
+func handleThesaurus(tmpl *template.Template, provider Provider) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		p := requestParams(req)
+		word := p.str("word", "", maxParamLength)
+		labels := p.labelLanguage("labels", true)
+		if !p.check(w) {
+			return
+		}
+		app := AppContext{
+			Template:  viewTemplate(tmpl, req),
+			Query:     word,
+			Lang:      requestLanguage(req),
+			Languages: languages,
+			Private:   isPrivate(req.Context()),
+		}
+		logSearch(req.Context(), "handle thesaurus: %s (%s)", word, app.Lang)
+		if word == "" {
+			http.Redirect(w, req, "/", http.StatusSeeOther)
+			return
+		}
+		words, errResp, err := searchWord(withLanguage(req.Context(), app.Lang), word, provider)
+		if err != nil {
+			log.Print(err)
+			app.Error = &ErrorResponse{Title: "Bad Gateway — " + word, Message: "The dictionary could not be reached or returned an invalid response."}
+			w.WriteHeader(http.StatusBadGateway)
+			renderTemplate(w, &app)
+			return
+		}
+		app.Error = errResp
+		if errResp != nil && app.Lang == defaultLanguage {
+			app.Suggestions = spellingSuggestions(word)
+		}
+		labelParts(words, labels)
+		app.Thesaurus = newThesaurus(word, words)
+		renderTemplate(w, &app)
+	}
+}
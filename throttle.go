@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// throttle limits the number of concurrent upstream requests and adapts the limit to the
+// observed upstream latency: when latencies spike, which is a sign that the upstream is
+// struggling, the limit is halved; while they are normal, it is raised again one request
+// at a time. It complements the static rate limiter on the handlers, which cannot tell
+// whether the upstream keeps up.
+type throttle struct {
+	mu sync.Mutex
+	// released is closed when a request is released, waking the requests waiting in
+	// acquire, and then replaced.
+	released chan struct{}
+	inFlight int
+	limit    int
+	maxLimit int
+
+	// latencies is a ring buffer of the most recent request latencies.
+	latencies []time.Duration
+	next      int
+	full      bool
+	// baseline is a moving average of the median latency while the upstream is healthy.
+	baseline   time.Duration
+	lastAdjust time.Time
+}
+
+const (
+	// throttleWindow is the number of latencies the percentiles are computed from.
+	throttleWindow = 100
+	// throttleSpike is how many times the baseline the 95th percentile must exceed to be
+	// considered a spike.
+	throttleSpike = 3
+	// throttleDecrease and throttleIncrease are the minimum intervals between lowering
+	// and raising the limit, respectively. Raising is slower to recover gradually.
+	throttleDecrease = time.Second
+	throttleIncrease = 5 * time.Second
+)
+
+// newThrottle returns a throttle allowing at most maxLimit concurrent requests.
+func newThrottle(maxLimit int) *throttle {
+	return &throttle{
+		released:  make(chan struct{}),
+		limit:     maxLimit,
+		maxLimit:  maxLimit,
+		latencies: make([]time.Duration, throttleWindow),
+	}
+}
+
+// acquire blocks until another request may be sent to the upstream, or ctx is canceled,
+// in which case its error is returned and no request is counted. Each successful call
+// must be followed by a call to release.
+func (t *throttle) acquire(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		if t.inFlight < t.limit {
+			t.inFlight++
+			t.mu.Unlock()
+			return nil
+		}
+		released := t.released
+		t.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release records the latency of a finished request and adjusts the limit.
+func (t *throttle) release(latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inFlight--
+	t.latencies[t.next] = latency
+	t.next = (t.next + 1) % len(t.latencies)
+	t.full = t.full || t.next == 0
+	t.adjust()
+	close(t.released)
+	t.released = make(chan struct{})
+}
+
+// percentile returns the p-th percentile of the recorded latencies.
+func (t *throttle) percentile(p int) time.Duration {
+	n := t.next
+	if t.full {
+		n = len(t.latencies)
+	}
+	sorted := append([]time.Duration(nil), t.latencies[:n]...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[(n-1)*p/100]
+}
+
+// adjust lowers or raises the limit according to the recorded latencies.
+// It must be called with t.mu held.
+func (t *throttle) adjust() {
+	// Wait for enough samples to tell a spike from noise.
+	if !t.full && t.next < throttleWindow/5 {
+		return
+	}
+	p50, p95 := t.percentile(50), t.percentile(95)
+	if t.baseline == 0 {
+		t.baseline = p50
+	}
+	now := time.Now()
+	if p95 > throttleSpike*t.baseline {
+		if t.limit > 1 && now.Sub(t.lastAdjust) >= throttleDecrease {
+			t.limit /= 2
+			t.lastAdjust = now
+			log.Printf("upstream latency spike (p95 %s, baseline %s); concurrency limit lowered to %d", p95, t.baseline, t.limit)
+		}
+		return
+	}
+	t.baseline = (9*t.baseline + p50) / 10
+	if t.limit < t.maxLimit && now.Sub(t.lastAdjust) >= throttleIncrease {
+		t.limit++
+		t.lastAdjust = now
+		log.Printf("upstream latency normal (p95 %s); concurrency limit raised to %d", p95, t.limit)
+	}
+}
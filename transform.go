@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// fieldMapping describes where the fields of word entries are found in upstream responses
+// that do not follow the dictionaryapi.dev schema, so that minor schema differences can be
+// adapted to without recompiling.
+//
+// Each field holds a path in a JSONPath-like syntax: dot-separated object keys, where a
+// key may be followed by "[*]" to select all elements of a list or "[n]" to select a single
+// one. Paths are relative to the enclosing element, e.g. Definition is looked up in each
+// element selected by Definitions. A leading "$" refers to the root of the response.
+// Empty fields default to the dictionaryapi.dev names.
+type fieldMapping struct {
+	Entries       string `json:"entries"`
+	Word          string `json:"word"`
+	Phonetics     string `json:"phonetics"`
+	PhoneticText  string `json:"phoneticText"`
+	PhoneticAudio string `json:"phoneticAudio"`
+	Meanings      string `json:"meanings"`
+	PartOfSpeech  string `json:"partOfSpeech"`
+	Definitions   string `json:"definitions"`
+	Definition    string `json:"definition"`
+	Example       string `json:"example"`
+	Synonyms      string `json:"synonyms"`
+	Antonyms      string `json:"antonyms"`
+	SourceURLs    string `json:"sourceUrls"`
+	LicenseName   string `json:"licenseName"`
+	LicenseURL    string `json:"licenseUrl"`
+
+	// PhoneticSourceURL, PhoneticLicenseName and PhoneticLicenseURL attribute the audio.
+	PhoneticSourceURL   string `json:"phoneticSourceUrl"`
+	PhoneticLicenseName string `json:"phoneticLicenseName"`
+	PhoneticLicenseURL  string `json:"phoneticLicenseUrl"`
+}
+
+// defaultMapping maps the dictionaryapi.dev v2 schema onto itself.
+var defaultMapping = fieldMapping{
+	Entries:       "$[*]",
+	Word:          "word",
+	Phonetics:     "phonetics[*]",
+	PhoneticText:  "text",
+	PhoneticAudio: "audio",
+	Meanings:      "meanings[*]",
+	PartOfSpeech:  "partOfSpeech",
+	Definitions:   "definitions[*]",
+	Definition:    "definition",
+	Example:       "example",
+	Synonyms:      "synonyms[*]",
+	Antonyms:      "antonyms[*]",
+	SourceURLs:    "sourceUrls[*]",
+	LicenseName:   "license.name",
+	LicenseURL:    "license.url",
+
+	PhoneticSourceURL:   "sourceUrl",
+	PhoneticLicenseName: "license.name",
+	PhoneticLicenseURL:  "license.url",
+}
+
+// loadMapping reads a field mapping from the JSON file name.
+// Fields missing in the file are taken from defaultMapping.
+func loadMapping(name string) (*fieldMapping, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	m := defaultMapping
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// selectPath returns the values matched by path in node.
+func selectPath(node any, path string) ([]any, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	nodes := []any{node}
+	if path == "" {
+		return nodes, nil
+	}
+	for _, segment := range strings.Split(path, ".") {
+		key, index, hasIndex := strings.Cut(segment, "[")
+		var next []any
+		for _, n := range nodes {
+			if key != "" {
+				obj, ok := n.(map[string]any)
+				if !ok {
+					continue
+				}
+				if n, ok = obj[key]; !ok {
+					continue
+				}
+			}
+			if !hasIndex {
+				next = append(next, n)
+				continue
+			}
+			list, ok := n.([]any)
+			if !ok {
+				continue
+			}
+			switch index = strings.TrimSuffix(index, "]"); index {
+			case "*":
+				next = append(next, list...)
+			default:
+				i, err := strconv.Atoi(index)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index in path %q", path)
+				}
+				if i >= 0 && i < len(list) {
+					next = append(next, list[i])
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes, nil
+}
+
+// selectString returns the first string matched by path in node, or an empty string.
+func selectString(node any, path string) (string, error) {
+	values, err := selectPath(node, path)
+	if err != nil {
+		return "", err
+	}
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	}
+	return "", nil
+}
+
+// selectStrings returns all strings matched by path in node.
+func selectStrings(node any, path string) ([]string, error) {
+	values, err := selectPath(node, path)
+	if err != nil {
+		return nil, err
+	}
+	strs := []string{}
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs, nil
+}
+
+// selectLicense returns the license whose name and URL are matched by namePath and
+// urlPath in node, or nil if there is none.
+func selectLicense(node any, namePath, urlPath string) (*License, error) {
+	var l License
+	var err error
+	if l.Name, err = selectString(node, namePath); err != nil {
+		return nil, err
+	}
+	if l.URL, err = selectString(node, urlPath); err != nil {
+		return nil, err
+	}
+	if l.Name == "" && l.URL == "" {
+		return nil, nil
+	}
+	return &l, nil
+}
+
+// transform converts a response body to the version 2 format according to the mapping.
+func (m *fieldMapping) transform(data []byte) ([]byte, error) {
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	entries, err := selectPath(root, m.Entries)
+	if err != nil {
+		return nil, err
+	}
+	words := make([]Word, 0, len(entries))
+	for _, e := range entries {
+		var w Word
+		if w.Word, err = selectString(e, m.Word); err != nil {
+			return nil, err
+		}
+		phonetics, err := selectPath(e, m.Phonetics)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range phonetics {
+			var ph Phonetic
+			if ph.Text, err = selectString(p, m.PhoneticText); err != nil {
+				return nil, err
+			}
+			if ph.Audio, err = selectString(p, m.PhoneticAudio); err != nil {
+				return nil, err
+			}
+			if ph.SourceURL, err = selectString(p, m.PhoneticSourceURL); err != nil {
+				return nil, err
+			}
+			if ph.License, err = selectLicense(p, m.PhoneticLicenseName, m.PhoneticLicenseURL); err != nil {
+				return nil, err
+			}
+			w.Phonetics = append(w.Phonetics, ph)
+		}
+		meanings, err := selectPath(e, m.Meanings)
+		if err != nil {
+			return nil, err
+		}
+		for _, mn := range meanings {
+			meaning, err := m.transformMeaning(mn)
+			if err != nil {
+				return nil, err
+			}
+			w.Meanings = append(w.Meanings, meaning)
+		}
+		if w.SourceURLs, err = selectStrings(e, m.SourceURLs); err != nil {
+			return nil, err
+		}
+		if len(w.SourceURLs) == 0 {
+			w.SourceURLs = nil
+		}
+		if w.License, err = selectLicense(e, m.LicenseName, m.LicenseURL); err != nil {
+			return nil, err
+		}
+		words = append(words, w)
+	}
+	return json.Marshal(words)
+}
+
+// transformMeaning converts a single meaning according to the mapping.
+func (m *fieldMapping) transformMeaning(node any) (Meaning, error) {
+	var meaning Meaning
+	var err error
+	if meaning.PartOfSpeech, err = selectString(node, m.PartOfSpeech); err != nil {
+		return meaning, err
+	}
+	if meaning.Synonyms, err = selectStrings(node, m.Synonyms); err != nil {
+		return meaning, err
+	}
+	if meaning.Antonyms, err = selectStrings(node, m.Antonyms); err != nil {
+		return meaning, err
+	}
+	definitions, err := selectPath(node, m.Definitions)
+	if err != nil {
+		return meaning, err
+	}
+	for _, d := range definitions {
+		var def Definition
+		if def.Definition, err = selectString(d, m.Definition); err != nil {
+			return meaning, err
+		}
+		if def.Example, err = selectString(d, m.Example); err != nil {
+			return meaning, err
+		}
+		if def.Synonyms, err = selectStrings(d, m.Synonyms); err != nil {
+			return meaning, err
+		}
+		if def.Antonyms, err = selectStrings(d, m.Antonyms); err != nil {
+			return meaning, err
+		}
+		meaning.Definitions = append(meaning.Definitions, def)
+	}
+	return meaning, nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+// savedWordsFile is the file in the data dir holding the words saved in the TUI, one per
+// line.
+const savedWordsFile = "saved.txt"
+
+// tuiHistoryWidth is the width of the history panel, including its border.
+const tuiHistoryWidth = 20
+
+// tuiLookupMsg is the result of looking up a word in the TUI.
+type tuiLookupMsg struct {
+	word  string
+	words []Word
+	err   string
+}
+
+// tuiModel is the state of the interactive terminal UI.
+type tuiModel struct {
+	provider Provider
+	dataDir  string
+
+	input textinput.Model
+	view  viewport.Model
+	// history holds the words looked up, most recent first. selected is the index of the
+	// selected word while the history panel has focus, -1 otherwise.
+	history  []string
+	selected int
+	// initial is the word to look up on start, if any.
+	initial string
+	word    string
+	status  string
+	width   int
+	height  int
+}
+
+// lookup returns a command looking up word.
+func (m *tuiModel) lookup(word string) tea.Cmd {
+	return func() tea.Msg {
+		words, errResp, err := searchWord(context.Background(), word, m.provider)
+		msg := tuiLookupMsg{word: word, words: words}
+		switch {
+		case errResp != nil:
+			msg.err = errResp.Title
+		case err != nil:
+			log.Print(err)
+			msg.err = "Failed to look up " + word
+		}
+		return msg
+	}
+}
+
+// save appends the current word to the saved words in the data dir.
+func (m *tuiModel) save() {
+	if m.word == "" {
+		return
+	}
+	if m.dataDir == "" {
+		m.status = "cannot save, data dir not available"
+		return
+	}
+	name := path.Join(m.dataDir, savedWordsFile)
+	saved, err := readWordList(name)
+	if err != nil && !os.IsNotExist(err) {
+		m.status = "failed to save: " + err.Error()
+		return
+	}
+	for _, w := range saved {
+		if w == m.word {
+			m.status = m.word + " is already saved"
+			return
+		}
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err == nil {
+		_, err = fmt.Fprintln(f, m.word)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		m.status = "failed to save: " + err.Error()
+		return
+	}
+	m.status = "saved " + m.word
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	if m.initial != "" {
+		return tea.Batch(textinput.Blink, m.lookup(m.initial))
+	}
+	return textinput.Blink
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.view.Width = msg.Width - tuiHistoryWidth
+		// The input line and the status line take two lines.
+		m.view.Height = msg.Height - 2
+		return m, nil
+
+	case tuiLookupMsg:
+		m.word = msg.word
+		m.status = ""
+		if msg.err != "" {
+			m.status = msg.err
+			m.view.SetContent("")
+			return m, nil
+		}
+		var b strings.Builder
+		writeWordsText(&b, msg.words)
+		m.view.SetContent(b.String())
+		m.view.GotoTop()
+		return m, nil
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "esc":
+			return m, tea.Quit
+		case "ctrl+s":
+			m.save()
+			return m, nil
+		case "tab":
+			// Toggle the focus between the search box and the history panel.
+			if m.selected < 0 && len(m.history) > 0 {
+				m.selected = 0
+				m.input.Blur()
+			} else {
+				m.selected = -1
+				m.input.Focus()
+			}
+			return m, nil
+		case "enter":
+			word := strings.TrimSpace(m.input.Value())
+			if m.selected >= 0 {
+				word = m.history[m.selected]
+			}
+			if word == "" {
+				return m, nil
+			}
+			m.input.SetValue("")
+			for i, w := range m.history {
+				if w == word {
+					m.history = append(m.history[:i], m.history[i+1:]...)
+					break
+				}
+			}
+			m.history = append([]string{word}, m.history...)
+			if m.selected >= 0 {
+				m.selected = 0
+			}
+			m.status = "looking up " + word + "..."
+			return m, m.lookup(word)
+		case "up", "down":
+			if m.selected >= 0 {
+				if msg.String() == "up" && m.selected > 0 {
+					m.selected--
+				} else if msg.String() == "down" && m.selected < len(m.history)-1 {
+					m.selected++
+				}
+				return m, nil
+			}
+		}
+	}
+
+	var cmds [2]tea.Cmd
+	m.view, cmds[0] = m.view.Update(msg)
+	if m.selected < 0 {
+		m.input, cmds[1] = m.input.Update(msg)
+	}
+	return m, tea.Batch(cmds[:]...)
+}
+
+func (m *tuiModel) View() string {
+	var b strings.Builder
+	b.WriteString(m.input.View() + "\n")
+	lines := strings.Split(m.view.View(), "\n")
+	for i := 0; i < m.view.Height; i++ {
+		entry := ""
+		if i < len(m.history) {
+			entry = m.history[i]
+			if i == m.selected {
+				entry = "> " + entry
+			}
+		}
+		b.WriteString(runewidth.FillRight(runewidth.Truncate(entry, tuiHistoryWidth-2, "…"), tuiHistoryWidth-2) + "│ ")
+		if i < len(lines) {
+			b.WriteString(lines[i])
+		}
+		b.WriteString("\n")
+	}
+	status := m.status
+	if status == "" {
+		status = "enter: look up  tab: history  ↑/↓ pgup/pgdn: scroll  ctrl+s: save word  esc: quit"
+	}
+	b.WriteString(runewidth.Truncate(status, m.width, "…"))
+	return b.String()
+}
+
+// tui implements the "tui" subcommand, an interactive terminal UI for looking up words
+// with the same cache and upstream as the server, for environments without a browser.
+// Words can be saved to savedWordsFile in the data dir.
+func tui(config AppConfig, args []string) {
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s tui [word]\n", path.Base(os.Args[0]))
+	}
+	rest := parseFlags(fs, args)
+	if len(rest) > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	// Log messages would garble the screen.
+	log.SetOutput(io.Discard)
+	m := &tuiModel{
+		provider: config.lookupProvider(openCache(config.initCacheDir())),
+		dataDir:  initDataDir(),
+		input:    textinput.New(),
+		selected: -1,
+	}
+	if m.dataDir != "" {
+		if f, err := os.OpenFile(path.Join(m.dataDir, "tui.log"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err == nil {
+			defer f.Close()
+			log.SetOutput(f)
+		}
+	}
+	m.input.Placeholder = "Search for a word..."
+	m.input.Prompt = "🔍 "
+	m.input.Focus()
+	m.view = viewport.New(0, 0)
+	if len(rest) == 1 {
+		m.initial = rest[0]
+		m.history = []string{rest[0]}
+	}
+	if _, err := tea.NewProgram(m, tea.WithAltScreen()).Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "tui:", err)
+		os.Exit(1)
+	}
+}
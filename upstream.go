@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upstream describes the dictionary API server that entries are fetched from.
+// Besides https://dictionaryapi.dev, self-hosted mirrors of the free dictionary API
+// can be used.
+type Upstream struct {
+	// BaseURL is the URL of the API without the version, e.g.
+	// "https://api.dictionaryapi.dev/api/".
+	BaseURL string
+	// Version is the API version, either "v1" or "v2".
+	Version string
+	// Mapping, if set, adapts responses with a non-standard schema.
+	Mapping *fieldMapping
+	// MinTTL and MaxTTL bound how long responses are cached, see cacheTTL.
+	MinTTL time.Duration
+	MaxTTL time.Duration
+	// StaleTTL is how long after expiry cache entries are still served while they are
+	// refreshed in the background. Older entries, or all if it is 0, are refreshed before
+	// answering.
+	StaleTTL time.Duration
+	// Retries is how many times failed requests are retried, after RetryBackoff, doubled
+	// with every retry and jittered. Requests fail if the upstream cannot be reached or
+	// answers with a server error or 429 Too Many Requests.
+	Retries      int
+	RetryBackoff time.Duration
+	// Offline disables requests: cache entries are served regardless of their expiry, and
+	// errOffline is returned for words that are not cached.
+	Offline bool
+	// OnChange, if set, is called when a refresh changes the cached entry of word in
+	// language lang, with the payloads before and after.
+	OnChange func(word, lang string, before, after []byte)
+
+	client   *http.Client
+	throttle *throttle
+	breaker  *breaker
+	// chaos, if set, injects faults into requests; see parseChaos.
+	chaos *chaos
+
+	refreshMu sync.Mutex
+	// refreshing holds the cache entries being refreshed in the background, keyed by
+	// language and word, and refreshes waits for them.
+	refreshing map[string]bool
+	refreshes  sync.WaitGroup
+}
+
+// wordV1 is a word entry as returned by version 1 of the API, which groups the
+// definitions in an object keyed by part of speech instead of a list of meanings.
+type wordV1 struct {
+	Word      string                  `json:"word"`
+	Phonetics []Phonetic              `json:"phonetics"`
+	Meaning   map[string][]Definition `json:"meaning"`
+}
+
+// newUpstream returns the configured upstream, the dictionary API at UpstreamURL, with
+// the version in $GODICT_API_VERSION; version 2 by default.
+// For upstreams that require mutual TLS, the client certificate and key are read from
+// $GODICT_API_CERT and $GODICT_API_KEY, and a custom CA from $GODICT_API_CA.
+// Upstreams with a slightly different schema can be adapted to by a field mapping file
+// in $GODICT_API_MAPPING; see fieldMapping.
+// Responses are cached as long as the upstream allows, but at least for
+// $GODICT_CACHE_MIN_TTL (1h by default) and at most for $GODICT_CACHE_MAX_TTL (720h).
+// Expired entries are served for up to $GODICT_CACHE_STALE_TTL (168h) longer while they
+// are refreshed in the background.
+// Requests time out after UpstreamTimeout, or when the request they are made for is
+// canceled. Offline disables them.
+// At most $GODICT_UPSTREAM_CONCURRENCY (8 by default) requests are sent concurrently,
+// fewer while the upstream is slow; see throttle.
+// Failed requests are retried $GODICT_API_RETRIES (2 by default) times, after
+// $GODICT_API_RETRY_BACKOFF (250ms) doubled with every retry. After
+// $GODICT_API_BREAKER_THRESHOLD (5) consecutive failures, no requests are sent for
+// $GODICT_API_BREAKER_COOLDOWN (30s); see breaker. A threshold of 0 disables that.
+// For testing failure handling, $GODICT_API_CHAOS injects faults into the requests; see
+// parseChaos.
+func (c *AppConfig) newUpstream() *Upstream {
+	u := newUpstream("GODICT_API", c.UpstreamURL)
+	u.client.Timeout = c.UpstreamTimeout
+	u.Offline = c.Offline
+	return u
+}
+
+// upstreamFromEnv returns the upstream configured by the environment variables starting
+// with prefix, as described for AppConfig.newUpstream. If $<prefix>_URL is not set,
+// defaultURL is used; if that is empty too, nil is returned.
+func upstreamFromEnv(prefix, defaultURL string) *Upstream {
+	baseURL := os.Getenv(prefix + "_URL")
+	if baseURL == "" {
+		baseURL = defaultURL
+	}
+	return newUpstream(prefix, baseURL)
+}
+
+// newUpstream returns the upstream at baseURL, configured by the other environment
+// variables starting with prefix. If baseURL is empty, nil is returned.
+func newUpstream(prefix, baseURL string) *Upstream {
+	u := &Upstream{
+		BaseURL: baseURL,
+		Version: os.Getenv(prefix + "_VERSION"),
+		MinTTL:  durationEnv("GODICT_CACHE_MIN_TTL", time.Hour),
+		MaxTTL:  durationEnv("GODICT_CACHE_MAX_TTL", 30*24*time.Hour),
+
+		StaleTTL:     durationEnv("GODICT_CACHE_STALE_TTL", 7*24*time.Hour),
+		Retries:      intEnv(prefix+"_RETRIES", 2),
+		RetryBackoff: durationEnv(prefix+"_RETRY_BACKOFF", 250*time.Millisecond),
+		refreshing:   make(map[string]bool),
+	}
+	if u.BaseURL == "" {
+		return nil
+	}
+	if u.Version == "" {
+		u.Version = "v2"
+	}
+	if u.Version != "v1" && u.Version != "v2" {
+		log.Fatalf("unsupported API version: %s", u.Version)
+	}
+	if u.MinTTL > u.MaxTTL {
+		log.Fatalf("minimum cache TTL %s exceeds maximum %s", u.MinTTL, u.MaxTTL)
+	}
+	client, err := newHTTPClient(os.Getenv(prefix+"_CERT"), os.Getenv(prefix+"_KEY"), os.Getenv(prefix+"_CA"))
+	if err != nil {
+		log.Fatal("failed to set up upstream TLS: ", err)
+	}
+	u.client = client
+	u.client.Timeout = durationEnv(prefix+"_TIMEOUT", 10*time.Second)
+	concurrency := intEnv("GODICT_UPSTREAM_CONCURRENCY", 8)
+	if concurrency < 1 {
+		log.Fatal("upstream concurrency must be at least 1")
+	}
+	u.throttle = newThrottle(concurrency)
+	if u.Retries < 0 {
+		log.Fatal("upstream retries must not be negative")
+	}
+	threshold := intEnv(prefix+"_BREAKER_THRESHOLD", 5)
+	if threshold < 0 {
+		log.Fatal("circuit breaker threshold must not be negative")
+	}
+	u.breaker = newBreaker(threshold, durationEnv(prefix+"_BREAKER_COOLDOWN", 30*time.Second))
+	if name := os.Getenv(prefix + "_MAPPING"); name != "" {
+		if u.Mapping, err = loadMapping(name); err != nil {
+			log.Fatal("failed to load field mapping: ", err)
+		}
+		log.Print("field mapping: ", name)
+	}
+	if spec := os.Getenv(prefix + "_CHAOS"); spec != "" {
+		if u.chaos, err = parseChaos(spec); err != nil {
+			log.Fatal("failed to parse chaos specification: ", err)
+		}
+		log.Printf("WARNING: injecting faults into upstream requests: %s", spec)
+	}
+	log.Printf("upstream: %s (%s)", u.BaseURL, u.Version)
+	return u
+}
+
+// durationEnv returns the duration in the environment variable key, or def if it is not set.
+func durationEnv(key string, def time.Duration) time.Duration {
+	s := os.Getenv(key)
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Fatalf("invalid duration in $%s: %s", key, s)
+	}
+	return d
+}
+
+// intEnv returns the integer in the environment variable key, or def if it is not set.
+func intEnv(key string, def int) int {
+	s := os.Getenv(key)
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		log.Fatalf("invalid number in $%s: %s", key, s)
+	}
+	return n
+}
+
+// entryURL returns the URL of the entry for word in language lang.
+func (u *Upstream) entryURL(word, lang string) string {
+	return strings.TrimSuffix(u.BaseURL, "/") + "/" + u.Version + "/entries/" + lang + "/" + url.PathEscape(word)
+}
+
+// fetchEntry returns the status code and the raw JSON body of the upstream response for
+// word in language lang. Successful responses are always in the version 2 format,
+// regardless of the upstream version and schema.
+// The word is normalized first, see normalizeWord.
+// Successful responses are served from and stored to cache. Expired cache entries are
+// refreshed, in the background if they expired less than StaleTTL ago; if the upstream
+// fails to answer, they are served anyway.
+func (u *Upstream) fetchEntry(ctx context.Context, word, lang string, cache *entryCache) (int, []byte, error) {
+	word = normalizeWord(word)
+	// Only cache supported languages, so that arbitrary language codes sent to the
+	// proxy do not fill the cache.
+	useCache := cache != nil && validLanguage(lang)
+	key := lang + "/" + word
+	var stale []byte
+	if u.Offline {
+		if !useCache {
+			return 0, nil, errOffline
+		}
+		if data, _, err := cache.get(ctx, word, lang); err == nil {
+			cacheTotal.inc("hit")
+			return http.StatusOK, data, nil
+		}
+		cacheTotal.inc("miss")
+		return 0, nil, errOffline
+	}
+	if useCache {
+		data, expires, err := cache.get(ctx, word, lang)
+		switch {
+		case err == nil && time.Now().Before(expires):
+			logSearch(ctx, "cache hit: %s", key)
+			cacheTotal.inc("hit")
+			return http.StatusOK, data, nil
+		case err == nil && time.Since(expires) < u.StaleTTL:
+			logSearch(ctx, "cache entry expired, refreshing in background: %s", key)
+			cacheTotal.inc("stale")
+			u.refresh(ctx, cache, word, lang)
+			return http.StatusOK, data, nil
+		case err == nil:
+			logSearch(ctx, "cache entry expired: %s", key)
+			cacheTotal.inc("expired")
+			stale = data
+		case err == errCacheMiss:
+			logSearch(ctx, "cache miss: %s", key)
+			cacheTotal.inc("miss")
+		default:
+			logSearch(ctx, "failed to read cache entry %s: %s", key, err)
+			cacheTotal.inc("error")
+		}
+	}
+
+	status, jsonData, ttl, err := u.fetch(ctx, word, lang)
+	if stale != nil && (err != nil || status/100 == 5) {
+		logSearch(ctx, "serving expired cache entry: %s (status: %d, error: %v)", key, status, err)
+		return http.StatusOK, stale, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Cache the result. Invalid JSON is not cached, so that a malformed response does not
+	// break the word until the entry expires.
+	if useCache && status/100 == 2 && json.Valid(jsonData) {
+		logSearch(ctx, "caching: %s (for %s)", key, ttl)
+		if err := cache.put(word, lang, jsonData, time.Now().Add(ttl)); err != nil {
+			log.Print("failed to write cache: ", err)
+		}
+	}
+	return status, jsonData, nil
+}
+
+// refresh updates the entry of word in language lang in cache in the background, see
+// update, for the request with context ctx.
+func (u *Upstream) refresh(ctx context.Context, cache *entryCache, word, lang string) {
+	key := lang + "/" + word
+	u.refreshMu.Lock()
+	defer u.refreshMu.Unlock()
+	if u.refreshing[key] {
+		return
+	}
+	u.refreshing[key] = true
+	u.refreshes.Add(1)
+	go func() {
+		defer u.refreshes.Done()
+		defer func() {
+			u.refreshMu.Lock()
+			delete(u.refreshing, key)
+			u.refreshMu.Unlock()
+		}()
+		// The refresh outlives the request that started it, but keeps its recorder.
+		ctx := withRecorder(context.Background(), recorderFrom(ctx))
+		if err := u.update(ctx, cache, word, lang); err != nil {
+			logSearch(ctx, "failed to refresh cache entry: %s: %s", key, err)
+		}
+	}()
+}
+
+// update fetches word in language lang and updates its entry in cache. Only successful
+// responses replace the entry.
+func (u *Upstream) update(ctx context.Context, cache *entryCache, word, lang string) error {
+	status, data, ttl, err := u.fetch(ctx, word, lang)
+	if err != nil {
+		return err
+	}
+	if status/100 != 2 || !json.Valid(data) {
+		return fmt.Errorf("upstream answered %d", status)
+	}
+	logSearch(ctx, "refreshed: %s/%s (for %s)", lang, word, ttl)
+	before, err := cache.payload(word, lang)
+	if err != nil && err != errCacheMiss {
+		logSearch(ctx, "failed to read cache entry %s/%s: %s", lang, word, err)
+	}
+	if err := cache.put(word, lang, data, time.Now().Add(ttl)); err != nil {
+		return err
+	}
+	if before != nil && u.OnChange != nil {
+		u.OnChange(word, lang, before, data)
+	}
+	return nil
+}
+
+// fetch requests the entry for word in language lang from the upstream. It returns the
+// status code, the body converted to the version 2 format if successful, and how long the
+// response may be cached. Failed requests are retried, see Upstream.Retries, unless the
+// circuit breaker is open, in which case errCircuitOpen is returned.
+func (u *Upstream) fetch(ctx context.Context, word, lang string) (int, []byte, time.Duration, error) {
+	if !u.breaker.allow() {
+		upstreamTotal.inc("circuit_open")
+		return 0, nil, 0, errCircuitOpen
+	}
+	for attempt := 0; ; attempt++ {
+		status, data, ttl, err := u.fetchOnce(ctx, word, lang)
+		failed := err != nil || status/100 == 5 || status == http.StatusTooManyRequests
+		if ctx.Err() != nil {
+			u.breaker.skip()
+			return status, data, ttl, err
+		}
+		if !failed || attempt == u.Retries {
+			u.breaker.record(!failed)
+			return status, data, ttl, err
+		}
+		delay := jitter(u.RetryBackoff << attempt)
+		logSearch(ctx, "upstream request for %s/%s failed (status: %d, error: %v); retrying in %s", lang, word, status, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			u.breaker.skip()
+			return status, data, ttl, err
+		}
+	}
+}
+
+// fetchOnce sends a single request for fetch.
+func (u *Upstream) fetchOnce(ctx context.Context, word, lang string) (int, []byte, time.Duration, error) {
+	if err := u.throttle.acquire(ctx); err != nil {
+		return 0, nil, 0, err
+	}
+	start := time.Now()
+	if status, body, err := u.chaos.before(ctx); status != 0 || err != nil {
+		u.throttle.release(time.Since(start))
+		if err != nil {
+			return 0, nil, 0, fmt.Errorf("failed to GET %s: %w", u.BaseURL, err)
+		}
+		return status, body, 0, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.entryURL(word, lang), nil)
+	if err != nil {
+		u.throttle.release(time.Since(start))
+		return 0, nil, 0, err
+	}
+	resp, err := u.client.Do(req)
+	upstreamDuration.since(start)
+	if err != nil {
+		upstreamTotal.inc("error")
+		u.throttle.release(time.Since(start))
+		return 0, nil, 0, fmt.Errorf("failed to GET %s: %w", u.BaseURL, err)
+	}
+	defer resp.Body.Close()
+	upstreamTotal.inc(statusClass(resp.StatusCode))
+
+	jsonData, err := io.ReadAll(resp.Body)
+	u.throttle.release(time.Since(start))
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("failed to read response body: %w", err)
+	}
+	log.Print("response status code: ", resp.Status)
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, jsonData, 0, nil
+	}
+	jsonData = u.chaos.after(jsonData)
+	if u.Mapping != nil {
+		if jsonData, err = u.Mapping.transform(jsonData); err != nil {
+			return 0, nil, 0, fmt.Errorf("failed to transform response: %w", err)
+		}
+	} else if u.Version == "v1" {
+		if jsonData, err = convertV1(jsonData); err != nil {
+			return 0, nil, 0, fmt.Errorf("failed to convert v1 response: %w", err)
+		}
+	}
+	return resp.StatusCode, jsonData, cacheTTL(resp.Header, u.MinTTL, u.MaxTTL), nil
+}
+
+// convertV1 converts a version 1 response body to the version 2 format.
+// Parts of speech are sorted alphabetically, as the version 1 format does not keep
+// their order.
+func convertV1(data []byte) ([]byte, error) {
+	var entries []wordV1
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	words := make([]Word, 0, len(entries))
+	for _, e := range entries {
+		w := Word{Word: e.Word, Phonetics: e.Phonetics}
+		pos := make([]string, 0, len(e.Meaning))
+		for p := range e.Meaning {
+			pos = append(pos, p)
+		}
+		sort.Strings(pos)
+		for _, p := range pos {
+			w.Meanings = append(w.Meanings, Meaning{PartOfSpeech: p, Definitions: e.Meaning[p]})
+		}
+		words = append(words, w)
+	}
+	return json.Marshal(words)
+}
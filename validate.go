@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxParamLength is the maximum length of string parameters, unless given otherwise.
+const maxParamLength = 256
+
+// FieldError describes why a request parameter or a field of a request body is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// params reads the typed parameters of an API request and checks their limits. Errors
+// are collected rather than returned, so that all invalid parameters are reported at once
+// by check; the getters return the default of invalid parameters. Handlers of the API use
+// params instead of reading FormValue themselves, so that they answer invalid requests
+// alike:
+//
+//	p := requestParams(req)
+//	limit := p.integer("limit", 50, 1, 1000)
+//	format := p.oneOf("format", "csv", "csv", "anki")
+//	if !p.check(w) {
+//		return
+//	}
+type params struct {
+	req   *http.Request
+	value func(name string) string
+	errs  []FieldError
+}
+
+// requestParams returns the parameters of req, from the query and the form body.
+func requestParams(req *http.Request) *params {
+	return &params{req: req, value: req.FormValue}
+}
+
+// queryParams returns the parameters in the query of req only, for requests whose body
+// is not a form.
+func queryParams(req *http.Request) *params {
+	q := req.URL.Query()
+	return &params{req: req, value: q.Get}
+}
+
+// fail records that the parameter name is invalid.
+func (p *params) fail(name, format string, args ...any) {
+	p.errs = append(p.errs, FieldError{Field: name, Message: fmt.Sprintf(format, args...)})
+}
+
+// str returns the parameter name, with surrounding space trimmed, or def if it is missing.
+// It must be valid UTF-8 of at most maxLen bytes.
+func (p *params) str(name, def string, maxLen int) string {
+	s := strings.TrimSpace(p.value(name))
+	switch {
+	case s == "":
+		return def
+	case !utf8.ValidString(s):
+		p.fail(name, "must be valid UTF-8")
+		return def
+	case len(s) > maxLen:
+		p.fail(name, "must be at most %d bytes long", maxLen)
+		return def
+	}
+	return s
+}
+
+// required returns the parameter name like str, but records an error if it is missing.
+func (p *params) required(name string, maxLen int) string {
+	if strings.TrimSpace(p.value(name)) == "" {
+		p.fail(name, "is required")
+		return ""
+	}
+	return p.str(name, "", maxLen)
+}
+
+// integer returns the integer parameter name, between min and max, or def if it is
+// missing. A max of math.MaxInt means no upper limit.
+func (p *params) integer(name string, def, min, max int) int {
+	s := p.value(name)
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		p.fail(name, "must be an integer")
+		return def
+	}
+	if n < min || n > max {
+		if max == math.MaxInt {
+			p.fail(name, "must be at least %d", min)
+		} else {
+			p.fail(name, "must be between %d and %d", min, max)
+		}
+		return def
+	}
+	return n
+}
+
+// boolean returns the boolean parameter name, "1" or "true" for true and "0" or "false"
+// for false, or false if it is missing.
+func (p *params) boolean(name string) bool {
+	switch p.value(name) {
+	case "", "0", "false":
+		return false
+	case "1", "true":
+		return true
+	}
+	p.fail(name, "must be 0 or 1")
+	return false
+}
+
+// duration returns the duration parameter name, like "1s", between min and max, or def
+// if it is missing.
+func (p *params) duration(name string, def, min, max time.Duration) time.Duration {
+	s := p.value(name)
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		p.fail(name, "must be a duration like 1s or 500ms")
+		return def
+	}
+	if d < min || d > max {
+		p.fail(name, "must be between %s and %s", min, max)
+		return def
+	}
+	return d
+}
+
+// timestamp returns the time parameter name, a date in the format 2006-01-02, meaning its
+// start in UTC, or a time in RFC 3339 format. The second return value is false if it is
+// missing or invalid.
+func (p *params) timestamp(name string) (time.Time, bool) {
+	s := p.value(name)
+	if s == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, true
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		p.fail(name, "must be a date like 2006-01-02 or a time like 2006-01-02T15:04:05Z")
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// oneOf returns the parameter name, which must be one of values, or def if it is missing.
+func (p *params) oneOf(name, def string, values ...string) string {
+	s := p.value(name)
+	if s == "" {
+		return def
+	}
+	for _, v := range values {
+		if s == v {
+			return s
+		}
+	}
+	p.fail(name, "must be one of %s", strings.Join(values, ", "))
+	return def
+}
+
+// language returns the language code parameter name, which must be a supported language,
+// or def if it is missing.
+func (p *params) language(name, def string) string {
+	s := p.value(name)
+	if s == "" {
+		return def
+	}
+	if !validLanguage(s) {
+		p.fail(name, "must be a supported language code, like %s", defaultLanguage)
+		return def
+	}
+	return s
+}
+
+// decodeJSON decodes the JSON request body, of at most maxBytes, into v. Unknown
+// fields and values of the wrong type are recorded as errors of the field, anything else
+// as an error of "body".
+func (p *params) decodeJSON(w http.ResponseWriter, v any, maxBytes int64) {
+	dec := json.NewDecoder(http.MaxBytesReader(w, p.req.Body, maxBytes))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil && dec.More() {
+		err = errors.New("unexpected data after the JSON value")
+	}
+	var typeErr *json.UnmarshalTypeError
+	var maxErr *http.MaxBytesError
+	switch {
+	case err == nil:
+	case errors.As(err, &typeErr):
+		p.fail(typeErr.Field, "must be %s", jsonTypeName(typeErr.Type.Kind()))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		p.fail(strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`), "is not a known field")
+	case errors.As(err, &maxErr):
+		p.fail("body", "must be at most %d bytes long", maxBytes)
+	case errors.Is(err, io.EOF):
+		p.fail("body", "is required")
+	default:
+		p.fail("body", "must be valid JSON: %s", err)
+	}
+}
+
+// jsonTypeName returns the name of the JSON type values of kind are decoded from.
+func jsonTypeName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	}
+	return "a valid value"
+}
+
+// check reports whether all parameters read so far are valid. If not, it writes a 400
+// Bad Request APIError listing the invalid parameters.
+func (p *params) check(w http.ResponseWriter) bool {
+	if len(p.errs) == 0 {
+		return true
+	}
+	names := make([]string, len(p.errs))
+	for i, e := range p.errs {
+		names[i] = e.Field
+	}
+	writeError(w, p.req, http.StatusBadRequest, "Invalid parameters: "+strings.Join(names, ", ")+".", p.errs)
+	return false
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	_ "embed"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed data/homophones.txt
+var homophonesData string
+
+//go:embed data/misspellings.txt
+var misspellingsData string
+
+// SpellingVariants are the words that are easily confused with a word.
+type SpellingVariants struct {
+	// Homophones are words pronounced like the word.
+	Homophones []string `json:"homophones,omitempty"`
+	// Misspellings are common misspellings of the word.
+	Misspellings []string `json:"misspellings,omitempty"`
+	// MisspellingOf are the words the word is a common misspelling of.
+	MisspellingOf []string `json:"misspellingOf,omitempty"`
+}
+
+// variantIndex holds the bundled homophone and misspelling datasets.
+type variantIndex struct {
+	homophones   map[string][]string
+	misspellings map[string][]string
+	corrections  map[string][]string
+}
+
+var (
+	variantsOnce sync.Once
+	variants     variantIndex
+)
+
+// dataLines returns the non-empty lines of a bundled dataset without comments.
+func dataLines(data string) []string {
+	var lines []string
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// appendUnique appends s to list unless it is already there.
+func appendUnique(list []string, s string) []string {
+	for _, x := range list {
+		if x == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// loadVariants parses the bundled datasets.
+func loadVariants() {
+	variants = variantIndex{
+		homophones:   make(map[string][]string),
+		misspellings: make(map[string][]string),
+		corrections:  make(map[string][]string),
+	}
+	for _, line := range dataLines(homophonesData) {
+		group := strings.Split(line, ",")
+		for _, w := range group {
+			for _, h := range group {
+				if h != w {
+					variants.homophones[w] = appendUnique(variants.homophones[w], h)
+				}
+			}
+		}
+	}
+	for _, line := range dataLines(misspellingsData) {
+		wrong, right, ok := strings.Cut(line, "->")
+		if !ok {
+			continue
+		}
+		variants.misspellings[right] = appendUnique(variants.misspellings[right], wrong)
+		variants.corrections[wrong] = appendUnique(variants.corrections[wrong], right)
+	}
+	for _, m := range []map[string][]string{variants.homophones, variants.misspellings, variants.corrections} {
+		for _, list := range m {
+			sort.Strings(list)
+		}
+	}
+}
+
+// spellingVariants returns the spelling variants of word.
+// The second return value is false if there are none.
+func spellingVariants(word string) (SpellingVariants, bool) {
+	variantsOnce.Do(loadVariants)
+	word = strings.ToLower(word)
+	v := SpellingVariants{
+		Homophones:    variants.homophones[word],
+		Misspellings:  variants.misspellings[word],
+		MisspellingOf: variants.corrections[word],
+	}
+	return v, len(v.Homophones)+len(v.Misspellings)+len(v.MisspellingOf) > 0
+}
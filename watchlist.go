@@ -0,0 +1,817 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// watchlistPath is the path of the watchlist page. Watching words and changing the
+// notification preferences is done by POST requests to it.
+const watchlistPath = "/watchlist"
+
+// watchlistsFile is the name of the file holding the watchlists in the data directory.
+const watchlistsFile = "watchlists.json"
+
+// watcherCookie is the cookie identifying the watcher of a browser, and watcherCookieAge
+// how long it is kept.
+const (
+	watcherCookie    = "godict_watcher"
+	watcherCookieAge = 365 * 24 * time.Hour
+)
+
+// maxWebNotifications is the number of notifications kept for the web channel at most.
+const maxWebNotifications = 50
+
+// maxWatchedWords is the number of words a watcher can watch at most.
+const maxWatchedWords = 200
+
+// An email address is only notified once the link sent to it is followed, see
+// watchlists.confirmEmail. The link expires after emailConfirmationAge, and it is sent at
+// most once every emailConfirmationInterval.
+const (
+	emailConfirmationAge      = 24 * time.Hour
+	emailConfirmationInterval = 10 * time.Minute
+)
+
+// Errors of the changes of watchers.
+var (
+	errWatchlistFull     = fmt.Errorf("Your watchlist is full: watch at most %d words.", maxWatchedWords)
+	errConfirmationLimit = fmt.Errorf("A confirmation link was sent less than %d minutes ago. Try again later.", int(emailConfirmationInterval.Minutes()))
+)
+
+// The events watchers are notified about.
+const (
+	eventChange = "change"
+	eventAudio  = "audio"
+	eventWOTD   = "wotd"
+)
+
+// The channels watchers are notified on. Notifications on the web channel are shown on
+// the watchlist page.
+const (
+	channelEmail = "email"
+	channelNtfy  = "ntfy"
+	channelWeb   = "web"
+)
+
+// watchEvent is an event watchers can be notified about, for the watchlist page.
+type watchEvent struct {
+	Name        string
+	Description string
+}
+
+// watchEvents are the events watchers can be notified about.
+var watchEvents = []watchEvent{
+	{eventChange, "The definitions change"},
+	{eventAudio, "A pronunciation becomes available"},
+	{eventWOTD, "The word is the word of the day"},
+}
+
+// ntfyTopicPattern matches valid ntfy topics.
+var ntfyTopicPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// watchedWord is a word on a watchlist.
+type watchedWord struct {
+	Word  string    `json:"word"`
+	Lang  string    `json:"lang"`
+	Added time.Time `json:"added"`
+}
+
+// notification is a notification about an event of a watched word.
+type notification struct {
+	Word    string    `json:"word"`
+	Lang    string    `json:"lang"`
+	Event   string    `json:"event"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// watcher is the watchlist and the notification preferences of a browser.
+type watcher struct {
+	Words []watchedWord `json:"words"`
+	// Events are the channels to notify on for each event.
+	Events map[string][]string `json:"events"`
+	// Email is the confirmed email address. An address entered on the watchlist page is
+	// pending until the link with EmailToken, sent at EmailSent, is followed.
+	Email        string    `json:"email,omitempty"`
+	PendingEmail string    `json:"pending_email,omitempty"`
+	EmailToken   string    `json:"email_token,omitempty"`
+	EmailSent    time.Time `json:"email_sent"`
+	NtfyTopic    string    `json:"ntfy_topic,omitempty"`
+	// Notifications are the notifications on the web channel, most recent first.
+	Notifications []notification `json:"notifications,omitempty"`
+}
+
+// newWatcher returns a watcher notified about all events on the web channel.
+func newWatcher() *watcher {
+	w := &watcher{Events: make(map[string][]string)}
+	for _, e := range watchEvents {
+		w.Events[e.Name] = []string{channelWeb}
+	}
+	return w
+}
+
+// index returns the index of word in language lang in w.Words, or -1.
+func (w *watcher) index(word, lang string) int {
+	for i, ww := range w.Words {
+		if ww.Word == word && ww.Lang == lang {
+			return i
+		}
+	}
+	return -1
+}
+
+// WatchlistContext is the data of the watchlist page.
+type WatchlistContext struct {
+	Words         []watchedWord
+	Notifications []notification
+	Events        []watchEvent
+	Channels      []string
+	// Enabled holds the chosen channels of the events, as "event.channel".
+	Enabled map[string]bool
+	// Email is the confirmed email address, and PendingEmail the address waiting for
+	// confirmation, if any.
+	Email        string
+	PendingEmail string
+	NtfyTopic    string
+	// Error describes why the preferences were not saved, if they were not.
+	Error string
+	// Notice is a message about a change, like the confirmation of the email address.
+	Notice string
+}
+
+// watchlists are the watchlists of the browsers using this instance, identified by a
+// signed cookie. They are stored as a JSON file, which is rewritten on every change. A nil
+// *watchlists stores and notifies nothing.
+//
+// Watchers are notified by email if $GODICT_SMTP_ADDR, the host:port of an SMTP server,
+// is set, from $GODICT_SMTP_FROM and authenticated by $GODICT_SMTP_USER and
+// $GODICT_SMTP_PASSWORD, if set; on ntfy, to a topic on $GODICT_NTFY_URL,
+// https://ntfy.sh/ by default; and on the watchlist page.
+type watchlists struct {
+	mu   sync.Mutex
+	path string
+	key  []byte
+	// watchers are keyed by the ID in their cookie, and erased are the watchers erased
+	// less than erasureUndoWindow ago, which can still be restored; see erase.
+	watchers map[string]*watcher
+	erased   map[string]*erasedWatcher
+	// lastWOTD is the day the watchers of the word of the day were last notified.
+	lastWOTD string
+
+	smtpAddr, smtpFrom string
+	smtpAuth           smtp.Auth
+	ntfyURL            string
+	client             *http.Client
+}
+
+// watchlistsData is the file format of watchlists.
+type watchlistsData struct {
+	Watchers map[string]*watcher       `json:"watchers"`
+	Erased   map[string]*erasedWatcher `json:"erased,omitempty"`
+	LastWOTD string                    `json:"last_wotd,omitempty"`
+}
+
+// erasedWatcher is an erased watcher, kept until its erasure can no longer be undone.
+type erasedWatcher struct {
+	Watcher *watcher  `json:"watcher"`
+	Erased  time.Time `json:"erased"`
+}
+
+// loadWatchlists returns the watchlists stored in dataDir, identifying watchers by
+// cookies signed by key. If dataDir is empty, nil is returned and watchlists are disabled.
+func loadWatchlists(dataDir string, key []byte) *watchlists {
+	if dataDir == "" {
+		return nil
+	}
+	l := &watchlists{
+		path:     path.Join(dataDir, watchlistsFile),
+		key:      key,
+		watchers: make(map[string]*watcher),
+		erased:   make(map[string]*erasedWatcher),
+		smtpAddr: os.Getenv("GODICT_SMTP_ADDR"),
+		smtpFrom: os.Getenv("GODICT_SMTP_FROM"),
+		ntfyURL:  os.Getenv("GODICT_NTFY_URL"),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	if l.smtpFrom == "" {
+		l.smtpFrom = "godict@localhost"
+	}
+	if user := os.Getenv("GODICT_SMTP_USER"); user != "" {
+		host, _, _ := net.SplitHostPort(l.smtpAddr)
+		l.smtpAuth = smtp.PlainAuth("", user, os.Getenv("GODICT_SMTP_PASSWORD"), host)
+	}
+	if l.ntfyURL == "" {
+		l.ntfyURL = "https://ntfy.sh/"
+	}
+	if !strings.HasSuffix(l.ntfyURL, "/") {
+		l.ntfyURL += "/"
+	}
+	var data watchlistsData
+	b, err := os.ReadFile(l.path)
+	if err == nil {
+		err = json.Unmarshal(b, &data)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Print("failed to read watchlists: ", err)
+	}
+	if data.Watchers != nil {
+		l.watchers = data.Watchers
+	}
+	if data.Erased != nil {
+		l.erased = data.Erased
+	}
+	l.lastWOTD = data.LastWOTD
+	// Erased watchers are removed for good once their erasure can no longer be undone.
+	go func() {
+		for ; ; time.Sleep(time.Hour) {
+			if err := l.purgeErased(time.Now()); err != nil {
+				log.Print("failed to save watchlists: ", err)
+			}
+		}
+	}()
+	return l
+}
+
+// channels returns the channels available on this instance.
+func (l *watchlists) channels() []string {
+	if l.smtpAddr == "" {
+		return []string{channelNtfy, channelWeb}
+	}
+	return []string{channelEmail, channelNtfy, channelWeb}
+}
+
+// save writes the watchlists to their file. The caller must hold l.mu.
+func (l *watchlists) save() error {
+	data, err := json.MarshalIndent(watchlistsData{Watchers: l.watchers, Erased: l.erased, LastWOTD: l.lastWOTD}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// watcherID returns the ID of the watcher in the cookie of req. The second return value is
+// false if there is none.
+func (l *watchlists) watcherID(req *http.Request) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	cookie, err := req.Cookie(watcherCookie)
+	if err != nil {
+		return "", false
+	}
+	id, ok := verifyValue(l.key, cookie.Value)
+	return string(id), ok
+}
+
+// ensureWatcher returns the ID of the watcher of req, setting the cookie of a new watcher
+// if there is none.
+func (l *watchlists) ensureWatcher(w http.ResponseWriter, req *http.Request) (string, error) {
+	if id, ok := l.watcherID(req); ok {
+		return id, nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     watcherCookie,
+		Value:    signValue(l.key, []byte(id)),
+		Path:     "/",
+		MaxAge:   int(watcherCookieAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id, nil
+}
+
+// watcher returns the watcher with ID id, creating it if needed. The caller must hold
+// l.mu.
+func (l *watchlists) watcher(id string) *watcher {
+	w, ok := l.watchers[id]
+	if !ok {
+		w = newWatcher()
+		l.watchers[id] = w
+	}
+	return w
+}
+
+// watching reports whether the watcher with ID id watches word in language lang.
+func (l *watchlists) watching(id, word, lang string) bool {
+	if l == nil || id == "" {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w, ok := l.watchers[id]
+	return ok && w.index(word, lang) >= 0
+}
+
+// watch adds word in language lang to the watchlist of the watcher with ID id or, if
+// watched is false, removes it.
+func (l *watchlists) watch(id, word, lang string, watched bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := l.watcher(id)
+	i := w.index(word, lang)
+	switch {
+	case watched && i < 0:
+		if len(w.Words) >= maxWatchedWords {
+			return errWatchlistFull
+		}
+		w.Words = append(w.Words, watchedWord{Word: word, Lang: lang, Added: time.Now().UTC()})
+	case !watched && i >= 0:
+		w.Words = append(w.Words[:i], w.Words[i+1:]...)
+	default:
+		return nil
+	}
+	return l.save()
+}
+
+// setPreferences sets the notification preferences of the watcher with ID id: the
+// channels of each event, the email address and the ntfy topic. A new email address is
+// pending until it is confirmed, see confirmEmail; the token of the confirmation link to
+// send to it is returned, or "" if there is none to send. Sending another link within
+// emailConfirmationInterval fails with errConfirmationLimit.
+func (l *watchlists) setPreferences(id string, events map[string][]string, email, ntfyTopic string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := l.watcher(id)
+	token := ""
+	switch {
+	case email == "" || email == w.Email:
+		w.Email = email
+		w.PendingEmail, w.EmailToken = "", ""
+	case email == w.PendingEmail && time.Since(w.EmailSent) < emailConfirmationInterval:
+		// The link was just sent.
+	case time.Since(w.EmailSent) < emailConfirmationInterval:
+		return "", errConfirmationLimit
+	default:
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		token = hex.EncodeToString(b)
+		w.PendingEmail, w.EmailToken, w.EmailSent = email, token, time.Now().UTC()
+	}
+	w.Events, w.NtfyTopic = events, ntfyTopic
+	return token, l.save()
+}
+
+// confirmEmail confirms the pending email address of the watcher the confirmation link
+// with token was sent to, see setPreferences, which is then notified by email. It
+// returns the address, or "" if the token is unknown or expired.
+func (l *watchlists) confirmEmail(token string) (string, error) {
+	if l == nil || token == "" {
+		return "", nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, w := range l.watchers {
+		if w.EmailToken != token {
+			continue
+		}
+		if time.Since(w.EmailSent) >= emailConfirmationAge {
+			return "", nil
+		}
+		w.Email = w.PendingEmail
+		w.PendingEmail, w.EmailToken = "", ""
+		return w.Email, l.save()
+	}
+	return "", nil
+}
+
+// clearNotifications removes the notifications on the web channel of the watcher with ID
+// id.
+func (l *watchlists) clearNotifications(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w, ok := l.watchers[id]
+	if !ok || len(w.Notifications) == 0 {
+		return nil
+	}
+	w.Notifications = nil
+	return l.save()
+}
+
+// export returns a copy of the watcher with ID id, or nil if there is none.
+func (l *watchlists) export(id string) *watcher {
+	if l == nil || id == "" {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w, ok := l.watchers[id]
+	if !ok {
+		return nil
+	}
+	c := *w
+	c.Words = append([]watchedWord(nil), w.Words...)
+	c.Notifications = append([]notification(nil), w.Notifications...)
+	c.Events = make(map[string][]string, len(w.Events))
+	for e, channels := range w.Events {
+		c.Events[e] = append([]string(nil), channels...)
+	}
+	return &c
+}
+
+// erase erases the watcher with ID id: its watchlist, notification preferences and
+// notifications. It is kept for erasureUndoWindow, so that restore can undo the erasure,
+// and then removed for good.
+func (l *watchlists) erase(id string) error {
+	if l == nil || id == "" {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w, ok := l.watchers[id]
+	if !ok {
+		return nil
+	}
+	delete(l.watchers, id)
+	l.erased[id] = &erasedWatcher{Watcher: w, Erased: time.Now().UTC()}
+	return l.save()
+}
+
+// erasedAt returns when the watcher with ID id was erased. The second return value is
+// false if it was not, or can no longer be restored.
+func (l *watchlists) erasedAt(id string) (time.Time, bool) {
+	if l == nil || id == "" {
+		return time.Time{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.erased[id]
+	if !ok || time.Since(e.Erased) >= erasureUndoWindow {
+		return time.Time{}, false
+	}
+	return e.Erased, true
+}
+
+// restore undoes the erasure of the watcher with ID id, see erase. Words watched since
+// the erasure are kept. It reports whether there was an erased watcher to restore.
+func (l *watchlists) restore(id string) (bool, error) {
+	if l == nil || id == "" {
+		return false, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.erased[id]
+	if !ok || time.Since(e.Erased) >= erasureUndoWindow {
+		return false, nil
+	}
+	if w, ok := l.watchers[id]; ok {
+		for _, ww := range w.Words {
+			if e.Watcher.index(ww.Word, ww.Lang) < 0 {
+				e.Watcher.Words = append(e.Watcher.Words, ww)
+			}
+		}
+	}
+	l.watchers[id] = e.Watcher
+	delete(l.erased, id)
+	return true, l.save()
+}
+
+// purgeErased removes the watchers erased erasureUndoWindow or longer before now.
+func (l *watchlists) purgeErased(now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	purged := false
+	for id, e := range l.erased {
+		if now.Sub(e.Erased) >= erasureUndoWindow {
+			delete(l.erased, id)
+			purged = true
+		}
+	}
+	if !purged {
+		return nil
+	}
+	return l.save()
+}
+
+// context returns the data of the watchlist page of the watcher with ID id.
+func (l *watchlists) context(id string) WatchlistContext {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w, ok := l.watchers[id]
+	if !ok {
+		w = newWatcher()
+	}
+	ctx := WatchlistContext{
+		Words:         append([]watchedWord(nil), w.Words...),
+		Notifications: append([]notification(nil), w.Notifications...),
+		Events:        watchEvents,
+		Channels:      l.channels(),
+		Enabled:       make(map[string]bool),
+		Email:         w.Email,
+		PendingEmail:  w.PendingEmail,
+		NtfyTopic:     w.NtfyTopic,
+	}
+	for event, channels := range w.Events {
+		for _, c := range channels {
+			ctx.Enabled[event+"."+c] = true
+		}
+	}
+	return ctx
+}
+
+// notify notifies the watchers of word in language lang about event, described by
+// message, on the channels they chose for it.
+func (l *watchlists) notify(word, lang, event, message string) {
+	if l == nil {
+		return
+	}
+	n := notification{Word: word, Lang: lang, Event: event, Message: message, Time: time.Now().UTC()}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	changed := false
+	for _, w := range l.watchers {
+		if w.index(word, lang) < 0 {
+			continue
+		}
+		for _, c := range w.Events[event] {
+			switch {
+			case c == channelWeb:
+				w.Notifications = append([]notification{n}, w.Notifications...)
+				if len(w.Notifications) > maxWebNotifications {
+					w.Notifications = w.Notifications[:maxWebNotifications]
+				}
+				changed = true
+			case c == channelEmail && w.Email != "" && l.smtpAddr != "":
+				go l.sendEmail(w.Email, n)
+			case c == channelNtfy && w.NtfyTopic != "":
+				go l.postNtfy(w.NtfyTopic, n)
+			}
+		}
+	}
+	if changed {
+		if err := l.save(); err != nil {
+			log.Print("failed to save watchlists: ", err)
+		}
+	}
+}
+
+// definitionsChanged notifies the watchers of the word of change.
+func (l *watchlists) definitionsChanged(c entryChange) {
+	msg := fmt.Sprintf("The definitions of %s changed: %d added, %d removed.", c.Word, len(c.Added), len(c.Removed))
+	l.notify(c.Word, c.Lang, eventChange, msg)
+}
+
+// audioAvailable notifies the watchers of word in language lang that a pronunciation
+// became available.
+func (l *watchlists) audioAvailable(word, lang string) {
+	l.notify(word, lang, eventAudio, fmt.Sprintf("A pronunciation of %s is available.", word))
+}
+
+// wordOfTheDay notifies the watchers of word that it is the word of the day of day, once
+// a day.
+func (l *watchlists) wordOfTheDay(day, word string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if l.lastWOTD == day {
+		l.mu.Unlock()
+		return
+	}
+	l.lastWOTD = day
+	err := l.save()
+	l.mu.Unlock()
+	if err != nil {
+		log.Print("failed to save watchlists: ", err)
+	}
+	l.notify(word, defaultLanguage, eventWOTD, fmt.Sprintf("%s is the word of the day.", word))
+}
+
+// subject returns the subject of the email or the title of the ntfy message of n.
+func (n notification) subject() string {
+	return fmt.Sprintf("Godict: %s (%s)", strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, n.Word), n.Event)
+}
+
+// sendEmail sends n by email to the address to.
+func (l *watchlists) sendEmail(to string, n notification) {
+	if err := l.sendMail(to, n.subject(), n.Message); err != nil {
+		log.Print("failed to send notification email: ", err)
+	}
+}
+
+// sendConfirmation sends the link to confirm the email address to, see confirmEmail.
+func (l *watchlists) sendConfirmation(to, link string) {
+	body := "Follow this link to be notified about the words you watch on Godict at this address:\r\n\r\n" +
+		link + "\r\n\r\n" +
+		"The link expires in 24 hours. If you did not ask for these notifications, ignore this email."
+	if err := l.sendMail(to, "Godict: confirm your email address", body); err != nil {
+		log.Print("failed to send confirmation email: ", err)
+	}
+}
+
+// sendMail sends an email with subject and body to the address to.
+func (l *watchlists) sendMail(to, subject, body string) error {
+	msg := "From: " + l.smtpFrom + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body + "\r\n"
+	return smtp.SendMail(l.smtpAddr, l.smtpAuth, l.smtpFrom, []string{to}, []byte(msg))
+}
+
+// confirmationLink returns the link to confirm an email address with token for the server
+// of req, see confirmEmail.
+func confirmationLink(req *http.Request, token string) string {
+	scheme := "http"
+	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host + watchlistPath + "?confirm=" + token
+}
+
+// postNtfy publishes n to the ntfy topic.
+func (l *watchlists) postNtfy(topic string, n notification) {
+	req, err := http.NewRequest(http.MethodPost, l.ntfyURL+topic, strings.NewReader(n.Message))
+	if err != nil {
+		log.Print("failed to publish notification: ", err)
+		return
+	}
+	req.Header.Set("Title", mime.QEncoding.Encode("utf-8", n.subject()))
+	resp, err := l.client.Do(req)
+	if err != nil {
+		log.Print("failed to publish notification: ", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("failed to publish notification: ntfy answered %s", resp.Status)
+	}
+}
+
+// parsePreferences returns the notification preferences in the form of req: the channels
+// of each event from the checkboxes named "event.channel", the email address and the ntfy
+// topic.
+func (l *watchlists) parsePreferences(req *http.Request) (map[string][]string, string, string, error) {
+	events := make(map[string][]string)
+	needEmail, needNtfy := false, false
+	for _, e := range watchEvents {
+		events[e.Name] = []string{}
+		for _, c := range l.channels() {
+			if req.FormValue(e.Name+"."+c) == "" {
+				continue
+			}
+			events[e.Name] = append(events[e.Name], c)
+			needEmail = needEmail || c == channelEmail
+			needNtfy = needNtfy || c == channelNtfy
+		}
+	}
+	email := strings.TrimSpace(req.FormValue("email"))
+	if email != "" {
+		addr, err := mail.ParseAddress(email)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("Invalid email address: %s.", email)
+		}
+		email = addr.Address
+	} else if needEmail {
+		return nil, "", "", errors.New("Enter an email address to be notified by email.")
+	}
+	topic := strings.TrimSpace(req.FormValue("ntfy_topic"))
+	if topic != "" && !ntfyTopicPattern.MatchString(topic) {
+		return nil, "", "", fmt.Errorf("Invalid ntfy topic: %s. Use letters, digits, - and _.", topic)
+	} else if topic == "" && needNtfy {
+		return nil, "", "", errors.New("Enter an ntfy topic to be notified on ntfy.")
+	}
+	return events, email, topic, nil
+}
+
+// handleWatchlist handles requests to the watchlist page, which lists the watched words,
+// the notification preferences and the notifications on the web channel. POST requests
+// depend on the "action" form value:
+//   - "watch" watches the word of the "word" and "lang" form values, or stops watching it
+//     if "watched" is "0", and redirects back to the result page of the word;
+//   - "preferences" sets the notification preferences, see parsePreferences, and sends
+//     the confirmation link to a new email address;
+//   - "clear" clears the notifications on the web channel.
+//
+// GET requests with the "confirm" query argument follow a confirmation link, see
+// watchlists.confirmEmail.
+func handleWatchlist(tmpl *template.Template, watchlists *watchlists) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if watchlists == nil {
+			http.Error(w, "Oops", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Cache-Control", "private, no-store")
+		if req.Method != http.MethodPost {
+			id, _ := watchlists.watcherID(req)
+			ctx := watchlists.context(id)
+			if token := req.FormValue("confirm"); token != "" {
+				email, err := watchlists.confirmEmail(token)
+				switch {
+				case err != nil:
+					log.Print("failed to save watchlists: ", err)
+					http.Error(w, "Oops", http.StatusInternalServerError)
+					return
+				case email == "":
+					ctx.Error = "The confirmation link is invalid or expired."
+					w.WriteHeader(http.StatusNotFound)
+				default:
+					ctx = watchlists.context(id)
+					ctx.Notice = "Notifications will be sent to " + email + "."
+				}
+			}
+			if err := tmpl.Execute(w, ctx); err != nil {
+				log.Print("failed to execute template: ", err)
+			}
+			return
+		}
+		id, err := watchlists.ensureWatcher(w, req)
+		if err != nil {
+			log.Print("failed to create watcher: ", err)
+			http.Error(w, "Oops", http.StatusInternalServerError)
+			return
+		}
+		switch req.FormValue("action") {
+		case "watch":
+			word := strings.TrimSpace(req.FormValue("word"))
+			if word == "" {
+				http.Error(w, "Oops", http.StatusBadRequest)
+				return
+			}
+			lang := requestLanguage(req)
+			if err := watchlists.watch(id, word, lang, req.FormValue("watched") != "0"); errors.Is(err, errWatchlistFull) {
+				ctx := watchlists.context(id)
+				ctx.Error = err.Error()
+				w.WriteHeader(http.StatusConflict)
+				if err := tmpl.Execute(w, ctx); err != nil {
+					log.Print("failed to execute template: ", err)
+				}
+				return
+			} else if err != nil {
+				log.Print("failed to save watchlists: ", err)
+				http.Error(w, "Oops", http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, req, wordURL(word, lang), http.StatusSeeOther)
+			return
+		case "preferences":
+			events, email, topic, err := watchlists.parsePreferences(req)
+			if err != nil {
+				ctx := watchlists.context(id)
+				ctx.Error = err.Error()
+				w.WriteHeader(http.StatusBadRequest)
+				if err := tmpl.Execute(w, ctx); err != nil {
+					log.Print("failed to execute template: ", err)
+				}
+				return
+			}
+			var token string
+			token, err = watchlists.setPreferences(id, events, email, topic)
+			if errors.Is(err, errConfirmationLimit) {
+				ctx := watchlists.context(id)
+				ctx.Error = err.Error()
+				w.WriteHeader(http.StatusTooManyRequests)
+				if err := tmpl.Execute(w, ctx); err != nil {
+					log.Print("failed to execute template: ", err)
+				}
+				return
+			}
+			if token != "" && watchlists.smtpAddr != "" {
+				go watchlists.sendConfirmation(email, confirmationLink(req, token))
+			}
+		case "clear":
+			err = watchlists.clearNotifications(id)
+		default:
+			http.Error(w, "Oops", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Print("failed to save watchlists: ", err)
+			http.Error(w, "Oops", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, req, watchlistPath, http.StatusSeeOther)
+	}
+}
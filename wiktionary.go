@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// wiktionaryUserAgent identifies godict to Wiktionary, which asks clients of its API to.
+const wiktionaryUserAgent = "godict (https://github.com/jsynacek/dict-go)"
+
+// wiktionary is the Provider for the Wiktionary REST API. Besides definitions, Wiktionary
+// has the etymology of words, usage notes, and entries in other languages, which are
+// mapped to Word.Etymology, Meaning.UsageNotes and Word.OtherLanguages. The definitions
+// come from the definition endpoint of the API, and the rest is parsed from the HTML of the
+// page of the word; see wiktionary.page. Wiktionary has no snapshots.
+type wiktionary struct {
+	// URL is the URL of the wiki, e.g. "https://en.wiktionary.org".
+	URL    string
+	client *http.Client
+}
+
+// newWiktionary returns the Provider for the Wiktionary at baseURL.
+func newWiktionary(baseURL string, timeout time.Duration) *wiktionary {
+	return &wiktionary{URL: strings.TrimSuffix(baseURL, "/"), client: &http.Client{Timeout: timeout}}
+}
+
+func (wk *wiktionary) Name() string {
+	return wk.URL
+}
+
+func (wk *wiktionary) Lookup(ctx context.Context, word string) ([]Word, error) {
+	start := time.Now()
+	words, err := wk.lookup(ctx, word)
+	lookupDuration.since(start)
+	lookupsTotal.inc(lookupResult(err))
+	return words, err
+}
+
+// wiktionaryUsage is an entry of the definition endpoint: the definitions of a word with
+// one part of speech, in one language.
+type wiktionaryUsage struct {
+	PartOfSpeech string `json:"partOfSpeech"`
+	Language     string `json:"language"`
+	Definitions  []struct {
+		Definition     string   `json:"definition"`
+		Examples       []string `json:"examples"`
+		ParsedExamples []struct {
+			Example string `json:"example"`
+		} `json:"parsedExamples"`
+	} `json:"definitions"`
+}
+
+func (wk *wiktionary) lookup(ctx context.Context, word string) ([]Word, error) {
+	if _, ok := asOfFrom(ctx); ok {
+		return nil, &ProviderError{Status: http.StatusNotFound, Response: ErrorResponse{
+			Title:   "No Snapshot Found",
+			Message: "There are no snapshots of Wiktionary.",
+		}}
+	}
+	lang := languageFrom(ctx)
+	var usages map[string][]wiktionaryUsage
+	if err := wk.get(ctx, "/api/rest_v1/page/definition/"+url.PathEscape(word), func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&usages)
+	}); err != nil {
+		return nil, err
+	}
+	entries := usages[wiktionaryLanguage(lang)]
+	if len(entries) == 0 {
+		return nil, &ProviderError{Status: http.StatusNotFound, Response: ErrorResponse{
+			Title:   "No Definitions Found",
+			Message: "Wiktionary has no definitions for the word in the language.",
+		}}
+	}
+	w := Word{
+		Word:       word,
+		Phonetics:  []Phonetic{},
+		License:    &License{Name: "CC BY-SA 4.0", URL: "https://creativecommons.org/licenses/by-sa/4.0"},
+		SourceURLs: []string{wk.URL + "/wiki/" + url.PathEscape(word)},
+		Language:   entries[0].Language,
+	}
+	for _, l := range languages {
+		if l.Code != lang && len(usages[wiktionaryLanguage(l.Code)]) > 0 {
+			w.OtherLanguages = append(w.OtherLanguages, l.Code)
+		}
+	}
+	for _, e := range entries {
+		m := Meaning{PartOfSpeech: strings.ToLower(e.PartOfSpeech), Synonyms: []string{}, Antonyms: []string{}}
+		for _, d := range e.Definitions {
+			def := Definition{Definition: wikiText(d.Definition), Synonyms: []string{}, Antonyms: []string{}}
+			if def.Definition == "" {
+				// Definitions of forms of other words, like plurals, are sometimes empty.
+				continue
+			}
+			if len(d.ParsedExamples) > 0 {
+				def.Example = wikiText(d.ParsedExamples[0].Example)
+			} else if len(d.Examples) > 0 {
+				def.Example = wikiText(d.Examples[0])
+			}
+			m.Definitions = append(m.Definitions, def)
+		}
+		if len(m.Definitions) > 0 {
+			w.Meanings = append(w.Meanings, m)
+		}
+	}
+	// The rest of the entry is not essential: if the page cannot be fetched, the
+	// definitions are returned without it.
+	var page *wiktionaryPage
+	err := wk.get(ctx, "/api/rest_v1/page/html/"+url.PathEscape(word), func(r io.Reader) error {
+		body, err := io.ReadAll(r)
+		if err == nil {
+			page = parseWiktionaryPage(string(body), w.Language)
+		}
+		return err
+	})
+	if err != nil {
+		logSearch(ctx, "failed to fetch Wiktionary page of %s: %s", word, err)
+		return []Word{w}, nil
+	}
+	w.Etymology = page.Etymology
+	if page.Pronunciation != "" {
+		w.Phonetics = []Phonetic{{Text: page.Pronunciation}}
+	}
+	for i := range w.Meanings {
+		w.Meanings[i].UsageNotes = page.UsageNotes[w.Meanings[i].PartOfSpeech]
+	}
+	return []Word{w}, nil
+}
+
+// get requests the path of the API and passes the body of the response to read. Responses
+// other than 200 OK are returned as a ProviderError.
+func (wk *wiktionary) get(ctx context.Context, path string, read func(io.Reader) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wk.URL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", wiktionaryUserAgent)
+	resp, err := wk.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return &ProviderError{Status: http.StatusNotFound, Response: ErrorResponse{
+			Title:   "No Definitions Found",
+			Message: "Wiktionary has no entry for the word.",
+		}}
+	case resp.StatusCode != http.StatusOK:
+		return &ProviderError{Status: resp.StatusCode, Response: ErrorResponse{
+			Title:   "Wiktionary Error",
+			Message: fmt.Sprintf("Wiktionary answered %s.", resp.Status),
+		}}
+	}
+	if err := read(resp.Body); err != nil {
+		return fmt.Errorf("invalid Wiktionary response: %w", err)
+	}
+	return nil
+}
+
+// wiktionaryLanguage returns the code of the language lang on Wiktionary, which does not
+// tell regional variants apart.
+func wiktionaryLanguage(lang string) string {
+	code, _, _ := strings.Cut(lang, "-")
+	return code
+}
+
+// wiktionaryPage is what is taken from the page of a word for one language.
+type wiktionaryPage struct {
+	// Etymology is the etymology of the word; if the word has several, they are separated
+	// by blank lines.
+	Etymology     string
+	Pronunciation string
+	// UsageNotes are the usage notes by the part of speech they are about, in lower case.
+	UsageNotes map[string]string
+}
+
+var (
+	// wikiHeading matches the headings of sections of a page, e.g. "<h2 id="English">English</h2>".
+	wikiHeading = regexp.MustCompile(`(?s)<h([2-6])[^>]*>(.*?)</h[2-6]>`)
+	wikiIPA     = regexp.MustCompile(`(?s)<span[^>]*class="IPA"[^>]*>(.*?)</span>`)
+	// wikiOmitted matches the parts of the HTML that are not text of the page: styles,
+	// and references to footnotes, e.g. "[1]".
+	wikiOmitted = regexp.MustCompile(`(?s)<style[^>]*>.*?</style>|<sup[^>]*class="[^"]*reference[^"]*"[^>]*>.*?</sup>`)
+	wikiTag     = regexp.MustCompile(`<[^>]*>`)
+)
+
+// parseWiktionaryPage parses the HTML of the page of a word, as rendered by Parsoid, for
+// the section of the language named language. The sections of a page are only known from
+// their headings, which are at the levels the editors chose; a language has a level 2
+// heading, and anything with the name of a part of speech that has a heading is its own
+// section, e.g. "Usage notes" after "Noun".
+func parseWiktionaryPage(body, language string) *wiktionaryPage {
+	p := &wiktionaryPage{UsageNotes: make(map[string]string)}
+	headings := wikiHeading.FindAllStringSubmatchIndex(body, -1)
+	inLanguage := false
+	pos := ""
+	var etymologies []string
+	for i, h := range headings {
+		end := len(body)
+		if i+1 < len(headings) {
+			end = headings[i+1][0]
+		}
+		level, title, content := body[h[2]:h[3]], wikiText(body[h[4]:h[5]]), body[h[1]:end]
+		if level == "2" {
+			inLanguage = title == language
+			pos = ""
+			continue
+		}
+		if !inLanguage {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(title, "Etymology"):
+			if text := wikiText(content); text != "" {
+				etymologies = append(etymologies, text)
+			}
+		case strings.HasPrefix(title, "Pronunciation"):
+			if m := wikiIPA.FindStringSubmatch(content); m != nil && p.Pronunciation == "" {
+				p.Pronunciation = wikiText(m[1])
+			}
+		case title == "Usage notes":
+			if text := wikiText(content); text != "" && pos != "" {
+				if p.UsageNotes[pos] != "" {
+					text = p.UsageNotes[pos] + " " + text
+				}
+				p.UsageNotes[pos] = text
+			}
+		case wiktionaryParts[strings.ToLower(title)]:
+			pos = strings.ToLower(title)
+		}
+	}
+	p.Etymology = strings.Join(etymologies, "\n\n")
+	return p
+}
+
+// wiktionaryParts are the parts of speech with sections on Wiktionary, in lower case.
+var wiktionaryParts = map[string]bool{
+	"adjective": true, "adverb": true, "article": true, "conjunction": true, "determiner": true,
+	"interjection": true, "noun": true, "numeral": true, "particle": true, "phrase": true,
+	"postposition": true, "prefix": true, "preposition": true, "pronoun": true,
+	"proper noun": true, "suffix": true, "verb": true,
+}
+
+// wikiText returns the text of the HTML s, on one line.
+func wikiText(s string) string {
+	s = wikiOmitted.ReplaceAllString(s, "")
+	s = html.UnescapeString(wikiTag.ReplaceAllString(s, ""))
+	return strings.Join(strings.Fields(s), " ")
+}
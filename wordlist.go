@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Word lists are installed in the "wordlists" subdirectory of the data dir, one file
+// per list named after it, with one word per line. Which list each feature uses is
+// stored in wordListConfigFile; features without a list of their own use the
+// default one.
+
+const (
+	wordListDir        = "wordlists"
+	wordListConfigFile = "wordlists.json"
+	// wordListDefault is the feature name that selects the default word list.
+	wordListDefault = "default"
+)
+
+// wordListFeatures are the features that can select a word list.
+var wordListFeatures = []string{wordListDefault, "autocomplete", "pattern", "random", "games", "spell"}
+
+// wordListConfig maps feature names to the names of the word lists they use.
+type wordListConfig map[string]string
+
+// validWordListName reports whether name can be used as a word list name.
+func validWordListName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`)
+}
+
+// readWordListConfig reads the word list selection from dataDir.
+func readWordListConfig(dataDir string) (wordListConfig, error) {
+	config := wordListConfig{}
+	data, err := os.ReadFile(path.Join(dataDir, wordListConfigFile))
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", wordListConfigFile, err)
+	}
+	return config, nil
+}
+
+// writeWordListConfig stores the word list selection in dataDir.
+func writeWordListConfig(dataDir string, config wordListConfig) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(dataDir, wordListConfigFile), append(data, '\n'), 0644)
+}
+
+// wordListFor returns the name of the word list used by feature, or "" if none is
+// selected.
+func (c wordListConfig) wordListFor(feature string) string {
+	if name := c[feature]; name != "" {
+		return name
+	}
+	return c[wordListDefault]
+}
+
+// activeWordListFile returns the file of the word list that feature uses, or "" if no word
+// list is selected for the feature.
+func activeWordListFile(dataDir, feature string) (string, error) {
+	config, err := readWordListConfig(dataDir)
+	if err != nil {
+		return "", err
+	}
+	name := config.wordListFor(feature)
+	if name == "" {
+		return "", nil
+	}
+	return path.Join(dataDir, wordListDir, name), nil
+}
+
+// activeWordList returns the words of the list that feature uses. The second return value
+// is false if no word list is selected for the feature.
+func activeWordList(dataDir, feature string) ([]string, bool, error) {
+	name, err := activeWordListFile(dataDir, feature)
+	if err != nil || name == "" {
+		return nil, false, err
+	}
+	words, err := readWordList(name)
+	return words, true, err
+}
+
+// openWordListSource opens src, a local file or an http(s) URL.
+func openWordListSource(src string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.Open(src)
+	}
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s answered %s", src, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// installWordList installs the word list from src under name in dataDir and returns the
+// number of words in it. The list is normalized like by readWordList and sorted.
+func installWordList(dataDir, name, src string) (int, error) {
+	r, err := openWordListSource(src)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	dir := path.Join(dataDir, wordListDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(dir, ".install-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	words, err := readWordList(tmp.Name())
+	if err != nil {
+		return 0, err
+	}
+	if len(words) == 0 {
+		return 0, errors.New("word list is empty")
+	}
+	sort.Strings(words)
+	data := strings.Join(words, "\n") + "\n"
+	if err := os.WriteFile(tmp.Name(), []byte(data), 0644); err != nil {
+		return 0, err
+	}
+	return len(words), os.Rename(tmp.Name(), path.Join(dir, name))
+}
+
+// wordListUsage prints the usage of the "wordlist" subcommand.
+func wordListUsage() {
+	prog := path.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, "usage: %s wordlist install <name> <file or URL>\n", prog)
+	fmt.Fprintf(os.Stderr, "       %s wordlist list\n", prog)
+	fmt.Fprintf(os.Stderr, "       %s wordlist use [-feature name] <name>\n", prog)
+	fmt.Fprintf(os.Stderr, "       %s wordlist remove <name>\n", prog)
+	fmt.Fprintf(os.Stderr, "features: %s\n", strings.Join(wordListFeatures, ", "))
+	os.Exit(2)
+}
+
+// wordList implements the "wordlist" subcommand, which manages the installed word lists
+// and selects the one used by each feature.
+func wordList(args []string) {
+	if len(args) == 0 {
+		wordListUsage()
+	}
+	dataDir := initDataDir()
+	if dataDir == "" {
+		fmt.Fprintln(os.Stderr, "data dir not available")
+		os.Exit(1)
+	}
+	config, err := readWordListConfig(dataDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to read word list selection:", err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "install":
+		if len(args) != 3 {
+			wordListUsage()
+		}
+		name := args[1]
+		if !validWordListName(name) {
+			fmt.Fprintf(os.Stderr, "invalid word list name: %s\n", name)
+			os.Exit(2)
+		}
+		n, err := installWordList(dataDir, name, args[2])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to install word list:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("installed %s: %d words\n", name, n)
+		// The first list installed becomes the default.
+		if config[wordListDefault] == "" {
+			config[wordListDefault] = name
+			if err := writeWordListConfig(dataDir, config); err != nil {
+				fmt.Fprintln(os.Stderr, "failed to write word list selection:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("using %s by default\n", name)
+		}
+
+	case "list":
+		if len(args) != 1 {
+			wordListUsage()
+		}
+		entries, err := os.ReadDir(path.Join(dataDir, wordListDir))
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintln(os.Stderr, "failed to list word lists:", err)
+			os.Exit(1)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tWORDS\tUSED BY")
+		for _, e := range entries {
+			if !e.Type().IsRegular() || !validWordListName(e.Name()) {
+				continue
+			}
+			words, err := readWordList(path.Join(dataDir, wordListDir, e.Name()))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "failed to read word list:", err)
+				os.Exit(1)
+			}
+			var usedBy []string
+			for _, feature := range wordListFeatures {
+				if config.wordListFor(feature) == e.Name() {
+					usedBy = append(usedBy, feature)
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", e.Name(), len(words), strings.Join(usedBy, ", "))
+		}
+		tw.Flush()
+
+	case "use":
+		fs := flag.NewFlagSet("wordlist use", flag.ExitOnError)
+		feature := fs.String("feature", wordListDefault, "the feature to use the word list for")
+		fs.Usage = wordListUsage
+		rest := parseFlags(fs, args[1:])
+		if len(rest) != 1 {
+			wordListUsage()
+		}
+		known := false
+		for _, f := range wordListFeatures {
+			known = known || f == *feature
+		}
+		if !known {
+			fmt.Fprintf(os.Stderr, "unknown feature: %s\n", *feature)
+			os.Exit(2)
+		}
+		name := rest[0]
+		if _, err := os.Stat(path.Join(dataDir, wordListDir, name)); !validWordListName(name) || err != nil {
+			fmt.Fprintf(os.Stderr, "word list not installed: %s\n", name)
+			os.Exit(1)
+		}
+		config[*feature] = name
+		if err := writeWordListConfig(dataDir, config); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to write word list selection:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("using %s for %s\n", name, *feature)
+
+	case "remove":
+		if len(args) != 2 {
+			wordListUsage()
+		}
+		name := args[1]
+		if !validWordListName(name) {
+			fmt.Fprintf(os.Stderr, "invalid word list name: %s\n", name)
+			os.Exit(2)
+		}
+		if err := os.Remove(path.Join(dataDir, wordListDir, name)); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to remove word list:", err)
+			os.Exit(1)
+		}
+		for feature, n := range config {
+			if n == name {
+				delete(config, feature)
+			}
+		}
+		if err := writeWordListConfig(dataDir, config); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to write word list selection:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("removed %s\n", name)
+
+	default:
+		wordListUsage()
+	}
+}
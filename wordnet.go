@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The bundled offline dictionary, data/offline.tsv, is an extract of WordNet 3.0, see
+// data/LICENSE.wordnet, made by the "offline-dict" subcommand from the database files of
+// WordNet, the "dict" directory of its distribution:
+//
+//	godict offline-dict /usr/share/wordnet > data/offline.tsv
+
+// wordNetFiles are the parts of speech of WordNet, by the suffix of their database files.
+var wordNetFiles = []struct{ file, name string }{
+	{"noun", "noun"},
+	{"verb", "verb"},
+	{"adj", "adjective"},
+	{"adv", "adverb"},
+}
+
+// wordNetGloss is a definition of a word in the WordNet database.
+type wordNetGloss struct {
+	word, pos, definition string
+}
+
+// readWordNet returns the definitions of the words in the WordNet database in dir, at
+// most senses of each word and part of speech, most frequent first. Unless all is set,
+// only words found in the sense-tagged corpus of WordNet are included, which leaves out
+// the rare ones.
+func readWordNet(dir string, senses int, all bool) ([]wordNetGloss, error) {
+	var defs []wordNetGloss
+	for _, part := range wordNetFiles {
+		glosses, err := readWordNetGlosses(path.Join(dir, "data."+part.file))
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(path.Join(dir, "index."+part.file))
+		if err != nil {
+			return nil, err
+		}
+		s := bufio.NewScanner(f)
+		s.Buffer(nil, 1<<20)
+		for s.Scan() {
+			// Lines starting with a space are the license.
+			fields := strings.Fields(s.Text())
+			if strings.HasPrefix(s.Text(), " ") || len(fields) < 6 {
+				continue
+			}
+			// lemma pos synset_cnt p_cnt [ptr_symbol...] sense_cnt tagsense_cnt synset_offset...
+			pointers, err := strconv.Atoi(fields[3])
+			if err != nil || len(fields) < 6+pointers {
+				f.Close()
+				return nil, fmt.Errorf("invalid index line: %q", s.Text())
+			}
+			tagged, _ := strconv.Atoi(fields[5+pointers])
+			if tagged == 0 && !all {
+				continue
+			}
+			word := strings.ReplaceAll(fields[0], "_", " ")
+			for i, offset := range fields[6+pointers:] {
+				if i == senses {
+					break
+				}
+				if gloss, ok := glosses[offset]; ok {
+					defs = append(defs, wordNetGloss{word: word, pos: part.name, definition: gloss})
+				}
+			}
+		}
+		f.Close()
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+	}
+	// The offline dictionary groups consecutive definitions of the same part of speech.
+	sort.SliceStable(defs, func(i, j int) bool { return defs[i].word < defs[j].word })
+	return defs, nil
+}
+
+// readWordNetGlosses returns the definitions of the synsets in the WordNet data file
+// name, keyed by their offset, without the examples following them.
+func readWordNetGlosses(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	glosses := make(map[string]string)
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, " ") {
+			continue
+		}
+		offset, _, _ := strings.Cut(line, " ")
+		_, gloss, ok := strings.Cut(line, " | ")
+		if !ok {
+			continue
+		}
+		gloss, _, _ = strings.Cut(gloss, `; "`)
+		gloss = strings.TrimSpace(gloss)
+		if gloss != "" {
+			glosses[offset] = gloss
+		}
+	}
+	return glosses, s.Err()
+}
+
+// offlineDict implements the "offline-dict" subcommand, which writes an offline
+// dictionary in the format of data/offline.tsv made from a WordNet database.
+func offlineDict(args []string) {
+	fs := flag.NewFlagSet("offline-dict", flag.ExitOnError)
+	senses := fs.Int("senses", 3, "definitions of each word and part of speech")
+	all := fs.Bool("all", false, "include words not in the sense-tagged corpus")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s offline-dict [flags] wordnet-dict-dir\n", path.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	args = parseFlags(fs, args)
+	if len(args) != 1 || *senses < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	defs, err := readWordNet(args[0], *senses, *all)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to read WordNet:", err)
+		os.Exit(1)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	fmt.Fprint(w, offlineDictHeader)
+	for _, d := range defs {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", d.word, d.pos, d.definition)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to write dictionary:", err)
+		os.Exit(1)
+	}
+}
+
+// offlineDictHeader is the comment at the top of the dictionaries made by offlineDict.
+const offlineDictHeader = `# Compact dictionary for offline lookups, one definition per line as
+# word<TAB>part of speech<TAB>definition. Larger dictionaries in the same format can be
+# loaded from $GODICT_OFFLINE_DICT.
+#
+# Made from WordNet 3.0 by "godict offline-dict". WordNet is a trademark of Princeton
+# University; see LICENSE.wordnet for its license.
+#
+# Princeton University "About WordNet." WordNet. Princeton University. 2010.
+`
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"hash/fnv"
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//go:embed data/wotd.txt
+var wotdData string
+
+// wotdPath is the path of the word of the day page.
+const wotdPath = "/wotd"
+
+// wotdWords are the curated words the word of the day is picked from.
+var wotdWords = dataLines(wotdData)
+
+// sharedLookupTimeout bounds the lookups of the words shared by all requests, like the
+// word of the day, which are not made with the context of the request that happens to ask
+// first, so that its cancellation does not fail the lookup for everybody.
+const sharedLookupTimeout = 15 * time.Second
+
+// wordOfTheDay returns the word of the day of t, which is the same for the whole day and
+// for all instances.
+func wordOfTheDay(t time.Time) string {
+	h := fnv.New32a()
+	h.Write([]byte(t.Format("2006-01-02")))
+	return wotdWords[h.Sum32()%uint32(len(wotdWords))]
+}
+
+// wotd holds the definitions of the word of the day, which are fetched once a day.
+type wotd struct {
+	provider   Provider
+	watchlists *watchlists
+
+	mu   sync.Mutex
+	word string
+	// words and errResp are the result of looking up word, see searchWord.
+	words   []Word
+	errResp *ErrorResponse
+}
+
+// newWOTD returns the word of the day, looked up with provider. The watchers of the word
+// in watchlists are notified when it becomes the word of the day.
+func newWOTD(provider Provider, watchlists *watchlists) *wotd {
+	return &wotd{provider: provider, watchlists: watchlists}
+}
+
+// get returns the word of the day and the result of looking it up, with IDs assigned. The
+// result is cached until the word changes; lookups that fail are retried on the next call.
+// The lookup is made in the background, see sharedLookupTimeout, without holding d.mu.
+func (d *wotd) get() (string, []Word, *ErrorResponse, error) {
+	now := time.Now()
+	word := wordOfTheDay(now)
+	d.mu.Lock()
+	if d.word == word {
+		words, errResp := d.words, d.errResp
+		d.mu.Unlock()
+		return word, words, errResp, nil
+	}
+	d.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), sharedLookupTimeout)
+	defer cancel()
+	words, errResp, err := searchWord(ctx, word, d.provider)
+	if err != nil {
+		return word, nil, nil, err
+	}
+	assignIDs(words)
+	d.mu.Lock()
+	d.word, d.words, d.errResp = word, words, errResp
+	d.mu.Unlock()
+	d.watchlists.wordOfTheDay(now.Format("2006-01-02"), word)
+	return word, words, errResp, nil
+}
+
+// prefetch looks up the word of the day right away and then every day after midnight, so
+// that it is in the cache before anyone asks for it. It does not return.
+func (d *wotd) prefetch() {
+	for {
+		if word, _, _, err := d.get(); err != nil {
+			log.Printf("failed to prefetch the word of the day %s: %s", word, err)
+		}
+		now := time.Now()
+		y, m, day := now.Date()
+		time.Sleep(time.Date(y, m, day+1, 0, 1, 0, 0, now.Location()).Sub(now))
+	}
+}
+
+// handleWOTD handles requests to the word of the day page, which shows the definitions of
+// the word of the day like a search for it.
+func handleWOTD(tmpl *template.Template, d *wotd) func(_ http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		p := requestParams(req)
+		labels := p.labelLanguage("labels", true)
+		if !p.check(w) {
+			return
+		}
+		app := AppContext{
+			Template:  viewTemplate(tmpl, req),
+			Lang:      defaultLanguage,
+			Languages: languages,
+			Private:   isPrivate(req.Context()),
+		}
+		word, words, errResp, err := d.get()
+		app.Query, app.WordOfTheDay = word, word
+		if err != nil {
+			log.Print(err)
+			app.Error = &ErrorResponse{Title: "Bad Gateway — " + word, Message: "The dictionary could not be reached or returned an invalid response."}
+			w.WriteHeader(http.StatusBadGateway)
+			renderTemplate(w, &app)
+			return
+		}
+		// The cached result is shared by all requests, so the meanings are copied before
+		// they are labeled.
+		app.Words = make([]Word, len(words))
+		for i, w := range words {
+			w.Meanings = append([]Meaning(nil), w.Meanings...)
+			app.Words[i] = w
+		}
+		app.Error = errResp
+		labelParts(app.Words, labels)
+		renderTemplate(w, &app)
+	}
+}